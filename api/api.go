@@ -28,6 +28,7 @@ const (
 	CodeUnauthorized             StatusCode = 2006
 	CodeErrorInternalServerError StatusCode = 2007
 	CodeErrorForbidden           StatusCode = 2008
+	CodeErrorTooManyRequests     StatusCode = 2009
 )
 
 var (
@@ -40,6 +41,7 @@ var (
 	StatusUnauthorized        = Status{Code: CodeUnauthorized, Msg: "unauthorized"}
 	StatusForbidden           = Status{Code: CodeErrorForbidden, Msg: "forbidden"}
 	StatusInternalServerError = Status{Code: CodeErrorInternalServerError, Msg: "internal server error"}
+	StatusTooManyRequests     = Status{Code: CodeErrorTooManyRequests, Msg: "too many requests"}
 )
 
 type PageInfo struct {
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/doraemonkeys/doraemon"
+	"github.com/gin-gonic/gin"
+)
+
+// BulkheadMiddleware limits the concurrent requests handled by the next handlers with b,
+// each request acquires a weight of 1. A request that cannot enter the bulkhead is
+// aborted with 503 Service Unavailable and StatusTooManyRequests.
+func BulkheadMiddleware(b *doraemon.Bulkhead) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := b.Acquire(c.Request.Context(), 1); err != nil {
+			abortBulkhead(c, err)
+			return
+		}
+		defer b.Release(1)
+		c.Next()
+	}
+}
+
+// KeyedBulkheadMiddleware is like BulkheadMiddleware with a bulkhead per key, e.g. per client IP:
+//
+//	KeyedBulkheadMiddleware(kb, func(c *gin.Context) string { return c.ClientIP() })
+func KeyedBulkheadMiddleware(kb *doraemon.KeyedBulkhead, key func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		b := kb.Get(key(c))
+		if err := b.Acquire(c.Request.Context(), 1); err != nil {
+			abortBulkhead(c, err)
+			return
+		}
+		defer b.Release(1)
+		c.Next()
+	}
+}
+
+func abortBulkhead(c *gin.Context, err error) {
+	if errors.Is(err, doraemon.ErrBulkheadFull) || errors.Is(err, doraemon.ErrBulkheadTimeout) {
+		FailHttpCode(c, http.StatusServiceUnavailable, StatusTooManyRequests)
+	} else {
+		// the client went away
+		c.Status(http.StatusServiceUnavailable)
+	}
+	c.Abort()
+}
@@ -0,0 +1,502 @@
+// Package archive creates and extracts zip, tar, tar.gz and tar.zst archives.
+//
+// Archives are streamed: Create writes to any io.Writer and Extract reads from any io.Reader.
+// Entry names are relative slash paths, and file modes, modification times and symbolic links
+// are preserved. Extraction refuses entries escaping the destination (zip-slip) and can limit
+// the extracted sizes against archive bombs.
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// Format is an archive format.
+type Format int
+
+const (
+	Zip Format = iota
+	Tar
+	TarGz
+	TarZst
+)
+
+func (f Format) String() string {
+	switch f {
+	case Zip:
+		return "zip"
+	case Tar:
+		return "tar"
+	case TarGz:
+		return "tar.gz"
+	case TarZst:
+		return "tar.zst"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrUnsafePath is returned by Extract for an entry that would be written outside the destination.
+	ErrUnsafePath = errors.New("archive: unsafe path")
+	// ErrTooLarge is returned by Extract when a limit of the Options is exceeded.
+	ErrTooLarge = errors.New("archive: too large")
+	// ErrUnknownFormat is returned by FormatFromName.
+	ErrUnknownFormat = errors.New("archive: unknown format")
+)
+
+// FormatFromName returns the format of an archive from its file name extension:
+// .zip, .tar, .tar.gz or .tgz, .tar.zst or .tzst.
+func FormatFromName(name string) (Format, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, nil
+	case strings.HasSuffix(name, ".tar"):
+		return Tar, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGz, nil
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return TarZst, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+}
+
+// Progress is reported after each entry written or extracted.
+type Progress struct {
+	// Entry is the name of the last entry.
+	Entry string
+	// Entries is the number of entries so far.
+	Entries int
+	// Bytes is the uncompressed size of the file contents so far.
+	Bytes int64
+}
+
+// Options configures Create and Extract. The zero value has no limits.
+type Options struct {
+	// Exclude lists globs of the paths not added by Create, see doraemon.MatchGlob.
+	Exclude []string
+	// Progress is called after each entry.
+	Progress func(Progress)
+
+	// MaxFileSize limits the size of each extracted file, 0 for no limit.
+	MaxFileSize int64
+	// MaxTotalSize limits the total size of the extracted files, 0 for no limit.
+	MaxTotalSize int64
+	// MaxEntries limits the number of extracted entries, 0 for no limit.
+	MaxEntries int
+}
+
+// entry is a file, directory or symbolic link, read from the file system or from an archive.
+type entry struct {
+	name    string // slash path, without trailing slash
+	mode    fs.FileMode
+	modTime time.Time
+	size    int64
+	target  string // of a symbolic link
+}
+
+func (o *Options) report(p *Progress, name string, n int64) {
+	p.Entry = name
+	p.Entries++
+	p.Bytes += n
+	if o.Progress != nil {
+		o.Progress(*p)
+	}
+}
+
+// archiveWriter adds entries to an archive.
+type archiveWriter interface {
+	add(e entry, content io.Reader) error
+	Close() error
+}
+
+// Create writes an archive of root to w. If root is a directory, its content is added with names
+// relative to it; if it is a file, it is added under its base name. Symbolic links are stored as links.
+func Create(w io.Writer, format Format, root string, opts Options) error {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	var progress Progress
+	err = walk(root, opts.Exclude, func(e entry, fullPath string) error {
+		var content io.Reader
+		if e.mode.IsRegular() {
+			f, err := os.Open(fullPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			content = f
+		}
+		if err := aw.add(e, content); err != nil {
+			return fmt.Errorf("add %s: %w", e.name, err)
+		}
+		opts.report(&progress, e.name, e.size)
+		return nil
+	})
+	if err != nil {
+		_ = aw.Close()
+		return err
+	}
+	return aw.Close()
+}
+
+// CreateFile writes an archive of root to the file archivePath, whose format is given by its name,
+// see FormatFromName. The file is replaced atomically once the archive is complete.
+func CreateFile(archivePath, root string, opts Options) error {
+	format, err := FormatFromName(archivePath)
+	if err != nil {
+		return err
+	}
+	if doraemon.IsSubPath(root, archivePath) {
+		// the archive would contain itself
+		opts.Exclude = append(opts.Exclude[:len(opts.Exclude):len(opts.Exclude)], "/"+relSlash(root, archivePath))
+	}
+	w, err := doraemon.NewAtomicWriter(archivePath, doraemon.AtomicWriteOptions{Perm: 0644})
+	if err != nil {
+		return err
+	}
+	if err := Create(w, format, root, opts); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// walk calls fn for each entry under root, parents before children.
+func walk(root string, exclude []string, fn func(e entry, fullPath string) error) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		e, err := newEntry(filepath.Base(root), root, info)
+		if err != nil {
+			return err
+		}
+		return fn(e, root)
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		name := relSlash(root, p)
+		if doraemon.MatchAnyGlob(exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			// devices, sockets and pipes are not archived
+			return nil
+		}
+		e, err := newEntry(name, p, info)
+		if err != nil {
+			return err
+		}
+		return fn(e, p)
+	})
+}
+
+func newEntry(name, fullPath string, info fs.FileInfo) (entry, error) {
+	e := entry{name: name, mode: info.Mode(), modTime: info.ModTime()}
+	switch {
+	case info.Mode().IsRegular():
+		e.size = info.Size()
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(fullPath)
+		if err != nil {
+			return e, err
+		}
+		e.target = filepath.ToSlash(target)
+	}
+	return e, nil
+}
+
+func relSlash(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Extract extracts the archive read from r into the directory dest, which is created if needed.
+// A zip archive is spooled to a temporary file if r is not an *os.File.
+func Extract(r io.Reader, format Format, dest string, opts Options) error {
+	x, err := newExtractor(dest, opts)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case Zip:
+		err = extractZipReader(r, x)
+	case Tar, TarGz, TarZst:
+		err = extractTar(r, format, x)
+	default:
+		err = fmt.Errorf("%w: %d", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return err
+	}
+	return x.finish()
+}
+
+// ExtractFile extracts the archive file archivePath into dest, its format is given by its name,
+// see FormatFromName.
+func ExtractFile(archivePath, dest string, opts Options) error {
+	format, err := FormatFromName(archivePath)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Extract(f, format, dest, opts)
+}
+
+// extractor writes the entries of an archive under dest.
+type extractor struct {
+	dest     string
+	opts     Options
+	progress Progress
+	// dirs are the extracted directories, their times are set at the end
+	dirs []entry
+	// links are the symbolic links extracted, other links may resolve through them
+	links map[string]bool
+}
+
+func newExtractor(dest string, opts Options) (*extractor, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	return &extractor{dest: abs, opts: opts, links: make(map[string]bool)}, nil
+}
+
+// target returns the path of the entry name under dest, checking that it cannot escape dest.
+func (x *extractor) target(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == "." {
+		return x.dest, nil
+	}
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(filepath.FromSlash(clean)) != "" {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	target := filepath.Join(x.dest, filepath.FromSlash(clean))
+	// an entry must not be written through a symbolic link extracted before
+	for dir := filepath.Dir(target); dir != x.dest; dir = filepath.Dir(dir) {
+		info, err := os.Lstat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("%w: %s is inside a symbolic link", ErrUnsafePath, name)
+		}
+	}
+	return target, nil
+}
+
+// extract writes the entry e, content is the content of a regular file.
+func (x *extractor) extract(e entry, content io.Reader) error {
+	if e.mode.Perm() == 0 {
+		// archives made on Windows may have no Unix permissions
+		e.mode |= 0644
+		if e.mode.IsDir() {
+			e.mode |= 0755
+		}
+	}
+	if x.opts.MaxEntries > 0 && x.progress.Entries >= x.opts.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrTooLarge, x.opts.MaxEntries)
+	}
+	target, err := x.target(e.name)
+	if err != nil {
+		return err
+	}
+	var written int64
+	switch {
+	case e.mode.IsDir():
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, entry{name: target, mode: e.mode, modTime: e.modTime})
+	case e.mode&fs.ModeSymlink != 0:
+		if err := x.checkLinkTarget(target, e); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if x.links[target] {
+			// a link checked before may resolve through it
+			return fmt.Errorf("%w: %s replaces a symbolic link", ErrUnsafePath, e.name)
+		}
+		if err := removeIfNotDir(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.FromSlash(e.target), target); err != nil {
+			return err
+		}
+		x.links[target] = true
+	case e.mode.IsRegular():
+		if written, err = x.writeFile(target, e, content); err != nil {
+			return err
+		}
+	default:
+		// devices, sockets and pipes are not extracted
+	}
+	x.opts.report(&x.progress, e.name, written)
+	return nil
+}
+
+// checkLinkTarget checks that the symbolic link e at target points inside dest, following
+// the links already extracted, e.g. "b" -> "a/.." escapes when "a" -> ".".
+func (x *extractor) checkLinkTarget(target string, e entry) error {
+	if e.target == "" || path.IsAbs(e.target) || filepath.IsAbs(filepath.FromSlash(e.target)) {
+		return fmt.Errorf("%w: %s links to %q", ErrUnsafePath, e.name, e.target)
+	}
+	if _, ok := x.resolveLink(filepath.Dir(target), e.target, 0); !ok {
+		return fmt.Errorf("%w: %s links to %q", ErrUnsafePath, e.name, e.target)
+	}
+	return nil
+}
+
+// maxLinkDepth is the number of nested links followed by resolveLink, like the ELOOP limit of Linux.
+const maxLinkDepth = 40
+
+// resolveLink returns the path of the relative link target, in the directory dir under dest,
+// and reports whether it stays inside dest. Each component is resolved on disk like the kernel does, so that ".."
+// applies to the target of a link and not to the link itself. The components that do not
+// exist yet are plain directories or files.
+func (x *extractor) resolveLink(dir, target string, depth int) (string, bool) {
+	cur := dir
+	for _, name := range strings.Split(filepath.ToSlash(target), "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if cur == x.dest {
+				return "", false
+			}
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, name)
+		info, err := os.Lstat(next)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		link, err := os.Readlink(next)
+		if err != nil || depth >= maxLinkDepth || filepath.IsAbs(link) || path.IsAbs(filepath.ToSlash(link)) {
+			return "", false
+		}
+		// the link is resolved from its directory, the next components from its target
+		resolved, ok := x.resolveLink(cur, link, depth+1)
+		if !ok {
+			return "", false
+		}
+		cur = resolved
+	}
+	return cur, true
+}
+
+func (x *extractor) writeFile(target string, e entry, content io.Reader) (int64, error) {
+	limit := int64(-1)
+	if x.opts.MaxFileSize > 0 {
+		limit = x.opts.MaxFileSize
+	}
+	if x.opts.MaxTotalSize > 0 {
+		if remaining := x.opts.MaxTotalSize - x.progress.Bytes; limit < 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+	// the size in the header may lie, the limit is enforced on the actual content
+	if limit >= 0 && e.size > limit {
+		return 0, fmt.Errorf("%w: %s has %d bytes", ErrTooLarge, e.name, e.size)
+	}
+	if limit >= 0 {
+		content = io.LimitReader(content, limit+1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	if err := removeIfNotDir(target); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, content)
+	if err == nil && limit >= 0 && n > limit {
+		err = fmt.Errorf("%w: %s exceeds the size limit", ErrTooLarge, e.name)
+	}
+	if err == nil {
+		err = f.Chmod(e.mode.Perm())
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(target)
+		return n, err
+	}
+	return n, os.Chtimes(target, time.Now(), e.modTime)
+}
+
+// removeIfNotDir removes the file or link at p, so that an existing link is replaced and not followed.
+func removeIfNotDir(p string) error {
+	info, err := os.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", p)
+	}
+	return os.Remove(p)
+}
+
+// finish sets the modes and times of the directories, children first.
+func (x *extractor) finish() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		d := x.dirs[i]
+		if err := os.Chmod(d.name, d.mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(d.name, time.Now(), d.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
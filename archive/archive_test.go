@@ -0,0 +1,193 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTree(t *testing.T, root string) {
+	t.Helper()
+	files := map[string]string{
+		"a.txt":         "hello",
+		"dir/b.sh":      "#!/bin/sh",
+		"dir/sub/c.bin": strings.Repeat("c", 10000),
+		"skip/ignored":  "x",
+		"dir/notes.tmp": "tmp",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(root, "dir/b.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(root, "a.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Symlink("sub/c.bin", filepath.Join(root, "dir/link"))
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{Zip, Tar, TarGz, TarZst} {
+		t.Run(format.String(), func(t *testing.T) {
+			src, dest := t.TempDir(), t.TempDir()
+			writeTree(t, src)
+
+			var buf bytes.Buffer
+			var created Progress
+			opts := Options{Exclude: []string{"skip", "*.tmp"}, Progress: func(p Progress) { created = p }}
+			if err := Create(&buf, format, src, opts); err != nil {
+				t.Fatal(err)
+			}
+			if created.Bytes != 5+9+10000 {
+				t.Fatalf("unexpected progress %+v", created)
+			}
+
+			var extracted Progress
+			err := Extract(bytes.NewReader(buf.Bytes()), format, dest, Options{Progress: func(p Progress) { extracted = p }})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if extracted.Entries != created.Entries || extracted.Bytes != created.Bytes {
+				t.Fatalf("created %+v, extracted %+v", created, extracted)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dest, "dir/sub/c.bin")); len(data) != 10000 {
+				t.Fatalf("unexpected content of length %d", len(data))
+			}
+			if info, _ := os.Stat(filepath.Join(dest, "dir/b.sh")); info.Mode().Perm() != 0755 {
+				t.Fatalf("mode not preserved: %v", info.Mode())
+			}
+			info, _ := os.Stat(filepath.Join(dest, "a.txt"))
+			if !info.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Fatalf("mtime not preserved: %v", info.ModTime())
+			}
+			for _, name := range []string{"skip", "dir/notes.tmp"} {
+				if _, err := os.Lstat(filepath.Join(dest, name)); err == nil {
+					t.Fatalf("%s should be excluded", name)
+				}
+			}
+			if target, err := os.Readlink(filepath.Join(dest, "dir/link")); err == nil && target != "sub/c.bin" {
+				t.Fatalf("unexpected link target %q", target)
+			}
+		})
+	}
+}
+
+func TestCreateFileAndExtractFile(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src)
+	archivePath := filepath.Join(src, "self.tar.gz")
+	if err := CreateFile(archivePath, src, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := ExtractFile(archivePath, dest, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "self.tar.gz")); err == nil {
+		t.Fatal("the archive contains itself")
+	}
+	if _, err := FormatFromName("x.rar"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func tarOf(t *testing.T, headers ...*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		content := strings.Repeat("x", int(h.Size))
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtract_UnsafePaths(t *testing.T) {
+	tests := map[string][]*tar.Header{
+		"parent":   {{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}},
+		"absolute": {{Name: "/etc/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}},
+		"link out": {{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}},
+		"through link": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		},
+		"link chain": {
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "a/.."},
+		},
+		"nested link chain": {
+			{Name: "x/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "x/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "x/out", Typeflag: tar.TypeSymlink, Linkname: "up/../evil"},
+		},
+		"replaced link": {
+			{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "sub"},
+			{Name: "b", Typeflag: tar.TypeSymlink, Linkname: "a/.."},
+			{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "."},
+		},
+	}
+	for name, headers := range tests {
+		t.Run(name, func(t *testing.T) {
+			parent := t.TempDir()
+			dest := filepath.Join(parent, "dest")
+			err := Extract(bytes.NewReader(tarOf(t, headers...)), Tar, dest, Options{})
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Fatalf("expected ErrUnsafePath, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "evil")); err == nil {
+				t.Fatal("file written outside the destination")
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	_, _ = zw.Create("../../evil")
+	_ = zw.Close()
+	if err := Extract(&buf, Zip, t.TempDir(), Options{}); !errors.Is(err, ErrUnsafePath) {
+		t.Fatalf("expected ErrUnsafePath for zip, got %v", err)
+	}
+}
+
+func TestExtract_Limits(t *testing.T) {
+	data := tarOf(t,
+		&tar.Header{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 600},
+		&tar.Header{Name: "b", Typeflag: tar.TypeReg, Mode: 0644, Size: 600},
+	)
+	for name, opts := range map[string]Options{
+		"file":    {MaxFileSize: 500},
+		"total":   {MaxTotalSize: 1000},
+		"entries": {MaxEntries: 1},
+	} {
+		err := Extract(bytes.NewReader(data), Tar, t.TempDir(), opts)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Fatalf("%s: expected ErrTooLarge, got %v", name, err)
+		}
+	}
+	if err := Extract(bytes.NewReader(data), Tar, t.TempDir(), Options{MaxTotalSize: 1200}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func newArchiveWriter(w io.Writer, format Format) (archiveWriter, error) {
+	switch format {
+	case Zip:
+		return newZipWriter(w), nil
+	case Tar:
+		return &tarWriter{tw: tar.NewWriter(w)}, nil
+	case TarGz:
+		gw := gzip.NewWriter(w)
+		return &tarWriter{tw: tar.NewWriter(gw), compressor: gw}, nil
+	case TarZst:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		return &tarWriter{tw: tar.NewWriter(zw), compressor: zw}, nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownFormat, format)
+}
+
+type tarWriter struct {
+	tw         *tar.Writer
+	compressor io.WriteCloser
+}
+
+func (w *tarWriter) add(e entry, content io.Reader) error {
+	hdr := &tar.Header{
+		Name:    e.name,
+		Mode:    int64(e.mode.Perm()),
+		ModTime: e.modTime,
+		Format:  tar.FormatPAX,
+	}
+	switch {
+	case e.mode.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case e.mode&fs.ModeSymlink != 0:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = e.target
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = e.size
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	// the file may have grown since it was listed, the header size is what fits
+	_, err := io.CopyN(w.tw, content, e.size)
+	return err
+}
+
+func (w *tarWriter) Close() error {
+	err := w.tw.Close()
+	if w.compressor != nil {
+		err = errors.Join(err, w.compressor.Close())
+	}
+	return err
+}
+
+func extractTar(r io.Reader, format Format, x *extractor) error {
+	switch format {
+	case TarGz:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	case TarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := entry{name: hdr.Name, modTime: hdr.ModTime, size: hdr.Size, target: hdr.Linkname}
+		perm := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.mode = fs.ModeDir | perm
+		case tar.TypeSymlink:
+			e.mode = fs.ModeSymlink | perm
+		case tar.TypeReg, tar.TypeRegA:
+			e.mode = perm
+		default:
+			// hard links, devices and pipes are skipped
+			e.mode = fs.ModeIrregular
+		}
+		if err := x.extract(e, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func newZipWriter(w io.Writer) *zipWriter {
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+func (w *zipWriter) add(e entry, content io.Reader) error {
+	hdr := &zip.FileHeader{Name: e.name, Modified: e.modTime, Method: zip.Deflate}
+	hdr.SetMode(e.mode)
+	switch {
+	case e.mode.IsDir():
+		hdr.Name += "/"
+		hdr.Method = zip.Store
+	case e.mode&fs.ModeSymlink != 0:
+		// a link is stored as a file with the link mode, its content is the target
+		content = strings.NewReader(e.target)
+		hdr.Method = zip.Store
+	}
+	fw, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		return nil
+	}
+	if e.mode.IsRegular() {
+		_, err = io.CopyN(fw, content, e.size)
+	} else {
+		_, err = io.Copy(fw, content)
+	}
+	return err
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// extractZipReader reads the zip archive from r, which needs random access.
+func extractZipReader(r io.Reader, x *extractor) error {
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(f, info.Size(), x)
+	}
+	tmp, err := os.CreateTemp("", "archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+	return extractZip(tmp, size, x)
+}
+
+func extractZip(r io.ReaderAt, size int64, x *extractor) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := extractZipFile(f, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(f *zip.File, x *extractor) error {
+	mode := f.Mode()
+	e := entry{
+		name:    strings.TrimSuffix(f.Name, "/"),
+		mode:    mode,
+		modTime: f.Modified,
+		size:    int64(f.UncompressedSize64),
+	}
+	if strings.HasSuffix(f.Name, "/") {
+		e.mode = fs.ModeDir | mode.Perm()
+	}
+	if e.mode.IsDir() {
+		return x.extract(e, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if e.mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, 4096))
+		if err != nil {
+			return err
+		}
+		e.target = string(target)
+		return x.extract(e, nil)
+	}
+	return x.extract(e, rc)
+}
@@ -0,0 +1,224 @@
+package doraemon
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// AtomicWriteOptions configures an AtomicWriter.
+type AtomicWriteOptions struct {
+	// Perm is the mode of a new file before the umask, 0644 if 0. An existing file keeps
+	// its mode and owner.
+	Perm fs.FileMode
+	// Backup keeps the previous content of the file in "<name>.bak", replacing an older backup.
+	Backup bool
+}
+
+// AtomicWriter writes a file atomically: the data is written to a temporary file in the
+// same directory, which is synced and renamed over the target on Close, and the directory
+// is synced. After a crash the target has either its old or its new content, never a part.
+//
+// A symbolic link is followed, the file it points to is replaced. Like os.WriteFile, a file
+// that cannot be opened for writing, e.g. read-only, is not replaced: NewAtomicWriter returns
+// the permission error. A target that is not a regular file, e.g. a FIFO or a device such as
+// /dev/null, is never replaced: it is written in place like os.WriteFile does, without atomicity
+// nor backup.
+type AtomicWriter struct {
+	name string
+	tmp  *os.File
+	// inPlace is set when tmp is the target itself, see NewAtomicWriter
+	inPlace bool
+	opts    AtomicWriteOptions
+	err     error
+	closed  bool
+}
+
+// NewAtomicWriter creates the temporary file of an atomic write of name.
+// Write the content, then call Close to commit it, or Abort to discard it.
+func NewAtomicWriter(name string, opts AtomicWriteOptions) (*AtomicWriter, error) {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	existing, err := os.Stat(name)
+	if err == nil && !existing.Mode().IsRegular() && !existing.IsDir() {
+		// renaming over a FIFO, a device or a socket would replace it by a regular file
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &AtomicWriter{name: name, tmp: f, inPlace: true, opts: opts}, nil
+	}
+	if err == nil {
+		// like os.WriteFile, a file that cannot be opened for writing is not replaced
+		if existing.Mode().IsRegular() {
+			f, err := os.OpenFile(name, os.O_WRONLY, 0)
+			if err != nil {
+				return nil, err
+			}
+			_ = f.Close()
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// a new file gets perm minus the umask, like os.WriteFile
+	tmp, err := createTempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp", perm)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		// the mode of the existing file is set explicitly, so the umask does not apply
+		if err := tmp.Chmod(existing.Mode().Perm()); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return nil, err
+		}
+		// keeping the owner needs privileges, a failure leaves the file to the current user
+		_ = preserveOwner(tmp, existing)
+	}
+	return &AtomicWriter{name: name, tmp: tmp, opts: opts}, nil
+}
+
+func (w *AtomicWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.tmp.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// ReadFrom copies r to the temporary file, see io.ReaderFrom.
+func (w *AtomicWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := io.Copy(w.tmp, r)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Close commits the write. If a write failed, the write is aborted and the error returned.
+func (w *AtomicWriter) Close() error {
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.err != nil {
+		_ = w.Abort()
+		return w.err
+	}
+	w.closed = true
+	if w.inPlace {
+		return w.tmp.Close()
+	}
+	tmpName := w.tmp.Name()
+	if err := w.tmp.Sync(); err != nil {
+		_ = w.tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := w.tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if w.opts.Backup {
+		if err := backupFile(w.name); err != nil {
+			_ = os.Remove(tmpName)
+			return err
+		}
+	}
+	if err := os.Rename(tmpName, w.name); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return syncDir(filepath.Dir(w.name))
+}
+
+// Abort discards the write, the target is left untouched unless it is written in place.
+func (w *AtomicWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.inPlace {
+		// what was written cannot be taken back
+		return w.tmp.Close()
+	}
+	_ = w.tmp.Close()
+	return os.Remove(w.tmp.Name())
+}
+
+// createTempFile creates a new file in dir named prefix followed by a random number. Unlike
+// os.CreateTemp, its mode is perm minus the umask.
+func createTempFile(dir, prefix string, perm fs.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if errors.Is(err, fs.ErrExist) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// backupFile replaces name.bak with the current content of name, if it exists.
+// A hard link is used when possible, so that name exists at all times.
+func backupFile(name string) error {
+	bak := name + ".bak"
+	if err := os.Remove(bak); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err := os.Link(name, bak)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	// no hard links on this file system
+	return copyFileContent(name, bak)
+}
+
+func copyFileContent(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// WriteFileAtomic writes data to name atomically, see AtomicWriter.
+func WriteFileAtomic(name string, data []byte, opts AtomicWriteOptions) error {
+	w, err := NewAtomicWriter(name, opts)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
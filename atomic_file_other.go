@@ -0,0 +1,18 @@
+//go:build !unix
+
+package doraemon
+
+import (
+	"io/fs"
+	"os"
+)
+
+// preserveOwner is a no-op, the owner of a file cannot be set this way on this platform.
+func preserveOwner(f *os.File, existing fs.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op, directories cannot be synced on this platform.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,131 @@
+package doraemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.json")
+
+	if err := WriteFileAtomic(name, []byte("v1"), AtomicWriteOptions{Perm: 0600, Backup: true}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+	if FileOrDirIsExist(name + ".bak") {
+		t.Fatal("no backup expected for a new file")
+	}
+
+	// the mode of an existing file is kept
+	if err := os.Chmod(name, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(name, []byte("v2"), AtomicWriteOptions{Perm: 0600, Backup: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(name, []byte("v3"), AtomicWriteOptions{Backup: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "v3" {
+		t.Fatalf("unexpected content %q", data)
+	}
+	if data, _ := os.ReadFile(name + ".bak"); string(data) != "v2" {
+		t.Fatalf("unexpected backup %q", data)
+	}
+	if info, _ := os.Stat(name); info.Mode().Perm() != 0640 {
+		t.Fatalf("expected mode 0640, got %v", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp") {
+			t.Fatalf("temporary file %s left", e.Name())
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestWriteFileFromReader_KeepsOldContentOnError(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.txt")
+	if err := WriteFile(name, 0644, []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileFromReader(name, 0644, failingReader{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if data, _ := os.ReadFile(name); string(data) != "old" {
+		t.Fatalf("unexpected content %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("expected only the target file, got %d entries", len(entries))
+	}
+}
+
+func TestAtomicWriter_FollowsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := WriteFilePreservePerms(link, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("the link was replaced")
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestWriteFileAtomic_PermAndReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	// os.WriteFile applies the umask, so does WriteFile
+	ref := filepath.Join(dir, "ref")
+	if err := os.WriteFile(ref, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "new")
+	if err := WriteFile(name, 0666, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	refInfo, _ := os.Stat(ref)
+	info, _ := os.Stat(name)
+	if info.Mode().Perm() != refInfo.Mode().Perm() {
+		t.Fatalf("mode %v, os.WriteFile gives %v", info.Mode().Perm(), refInfo.Mode().Perm())
+	}
+
+	if err := os.Chmod(name, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.OpenFile(name, os.O_WRONLY, 0); err == nil {
+		f.Close()
+		t.Skip("read-only files are writable by this user, e.g. root")
+	}
+	if err := WriteFile(name, 0644, []byte("replaced")); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "data" {
+		t.Fatalf("read-only file replaced: %q", data)
+	}
+}
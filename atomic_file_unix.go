@@ -0,0 +1,31 @@
+//go:build unix
+
+package doraemon
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives f the owner and group of the file described by existing.
+func preserveOwner(f *os.File, existing fs.FileInfo) error {
+	st, ok := existing.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(st.Uid) == os.Geteuid() && int(st.Gid) == os.Getegid() {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir flushes the directory entries of dir, e.g. after a rename in it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
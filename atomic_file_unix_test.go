@@ -0,0 +1,38 @@
+//go:build unix
+
+package doraemon
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileAtomic_FIFO(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		t.Skip("mkfifo:", err)
+	}
+	read := make(chan []byte, 1)
+	go func() {
+		data, _ := os.ReadFile(name)
+		read <- data
+	}()
+	if err := WriteFileAtomic(name, []byte("data"), AtomicWriteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-read; string(data) != "data" {
+		t.Fatalf("unexpected content read from the FIFO %q", data)
+	}
+	info, err := os.Lstat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("FIFO replaced by %s", info.Mode())
+	}
+	if matches, _ := filepath.Glob(name + "*.tmp*"); len(matches) != 0 {
+		t.Fatalf("temporary files left: %v", matches)
+	}
+}
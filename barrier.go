@@ -0,0 +1,338 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrBrokenBarrier is returned to the parties waiting at a Barrier or Phaser when
+	// one of them gave up, the barrier was reset, or the action of a Barrier failed.
+	ErrBrokenBarrier = errors.New("broken barrier")
+	// ErrPhaserTerminated is returned by a terminated Phaser.
+	ErrPhaserTerminated = errors.New("phaser terminated")
+)
+
+// barrierGeneration is one use of a Barrier or one phase of a Phaser,
+// done is closed when it is tripped or broken.
+type barrierGeneration struct {
+	done    chan struct{}
+	broken  bool
+	arrived int
+}
+
+func newBarrierGeneration() *barrierGeneration {
+	return &barrierGeneration{done: make(chan struct{})}
+}
+
+// breakLocked breaks the generation if it is not over yet.
+func (g *barrierGeneration) breakLocked() {
+	select {
+	case <-g.done:
+	default:
+		g.broken = true
+		close(g.done)
+	}
+}
+
+// Barrier lets a fixed number of parties wait for each other. It is reusable: once all the parties
+// have arrived, it is tripped, they are released and it can be used by the next round.
+//
+// If a party gives up waiting (its context is done), the barrier is broken: the other waiting
+// parties and the next callers of Await get ErrBrokenBarrier until Reset is called.
+type Barrier struct {
+	mu      sync.Mutex
+	parties int
+	action  func() error
+	gen     *barrierGeneration
+}
+
+// NewBarrier creates a Barrier for parties parties. The optional action is run by the last
+// arriving party when the barrier is tripped, before the others are released; if it fails
+// or panics, the barrier is broken.
+func NewBarrier(parties int, action func() error) *Barrier {
+	if parties <= 0 {
+		panic("parties must be greater than 0")
+	}
+	return &Barrier{parties: parties, action: action, gen: newBarrierGeneration()}
+}
+
+// Await waits until all the parties have called Await, ctx is done, or the barrier is broken.
+// The arrival index is parties-1 for the first party to arrive and 0 for the last one.
+func (b *Barrier) Await(ctx context.Context) (arrivalIndex int, err error) {
+	b.mu.Lock()
+	gen := b.gen
+	if gen.broken {
+		b.mu.Unlock()
+		return 0, ErrBrokenBarrier
+	}
+	gen.arrived++
+	arrivalIndex = b.parties - gen.arrived
+	if arrivalIndex == 0 {
+		// the next round can start while the action runs
+		b.gen = newBarrierGeneration()
+		b.mu.Unlock()
+		err := b.runAction()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if err != nil {
+			gen.breakLocked()
+			// the barrier stays broken until Reset, including for the parties of the next round
+			b.gen.breakLocked()
+			return 0, fmt.Errorf("%w: %w", ErrBrokenBarrier, err)
+		}
+		if gen.broken {
+			// a waiting party gave up while the action ran, it already closed done
+			b.gen.breakLocked()
+			return 0, ErrBrokenBarrier
+		}
+		close(gen.done)
+		return 0, nil
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-gen.done:
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-gen.done:
+			// tripped while giving up
+		default:
+			gen.breakLocked()
+			return arrivalIndex, fmt.Errorf("%w: %w", ErrBrokenBarrier, ctx.Err())
+		}
+	}
+	b.mu.Lock()
+	broken := gen.broken
+	b.mu.Unlock()
+	if broken {
+		return arrivalIndex, ErrBrokenBarrier
+	}
+	return arrivalIndex, nil
+}
+
+func (b *Barrier) runAction() (err error) {
+	if b.action == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+	return b.action()
+}
+
+// Reset breaks the current round, the waiting parties get ErrBrokenBarrier,
+// and makes the barrier usable again.
+func (b *Barrier) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gen.breakLocked()
+	b.gen = newBarrierGeneration()
+}
+
+func (b *Barrier) IsBroken() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen.broken
+}
+
+func (b *Barrier) Parties() int {
+	return b.parties
+}
+
+// Waiting returns the number of parties waiting in the current round.
+func (b *Barrier) Waiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gen.arrived
+}
+
+// Phaser is a reusable barrier whose parties can register and deregister at any time.
+// Each time all the registered parties have arrived, the phase advances.
+//
+// If a party gives up waiting in ArriveAndAwait (its context is done), the current phase
+// is broken, the waiting parties get ErrBrokenBarrier, and the phaser is terminated.
+// The phaser is also terminated when the last party deregisters, or when onAdvance returns true.
+type Phaser struct {
+	mu         sync.Mutex
+	phase      int
+	parties    int
+	gen        *barrierGeneration
+	terminated bool
+	onAdvance  func(phase, parties int) (terminate bool)
+}
+
+// NewPhaser creates a Phaser with parties registered parties. The optional onAdvance
+// is called when a phase advances, with the completed phase, under the lock of the phaser.
+func NewPhaser(parties int, onAdvance func(phase, parties int) (terminate bool)) *Phaser {
+	if parties < 0 {
+		panic("parties must not be negative")
+	}
+	return &Phaser{parties: parties, gen: newBarrierGeneration(), onAdvance: onAdvance}
+}
+
+// Register adds a party and returns the current phase.
+func (p *Phaser) Register() (int, error) {
+	return p.BulkRegister(1)
+}
+
+// BulkRegister adds n parties and returns the current phase.
+func (p *Phaser) BulkRegister(n int) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.checkLocked(); err != nil {
+		return p.phase, err
+	}
+	p.parties += n
+	return p.phase, nil
+}
+
+// Arrive arrives at the current phase without waiting and returns the arrival phase.
+func (p *Phaser) Arrive() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	phase, _, err := p.arriveLocked(false)
+	return phase, err
+}
+
+// ArriveAndDeregister arrives at the current phase and deregisters the party, without waiting.
+func (p *Phaser) ArriveAndDeregister() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	phase, _, err := p.arriveLocked(true)
+	return phase, err
+}
+
+// Await is ArriveAndAwait.
+func (p *Phaser) Await(ctx context.Context) (int, error) {
+	return p.ArriveAndAwait(ctx)
+}
+
+// ArriveAndAwait arrives at the current phase and waits for the other parties,
+// it returns the next phase.
+func (p *Phaser) ArriveAndAwait(ctx context.Context) (int, error) {
+	p.mu.Lock()
+	phase, gen, err := p.arriveLocked(false)
+	p.mu.Unlock()
+	if err != nil {
+		return phase, err
+	}
+
+	select {
+	case <-gen.done:
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-gen.done:
+		default:
+			gen.breakLocked()
+			p.terminated = true
+			return phase, fmt.Errorf("%w: %w", ErrBrokenBarrier, ctx.Err())
+		}
+	}
+	p.mu.Lock()
+	broken := gen.broken
+	p.mu.Unlock()
+	if broken {
+		return phase, ErrBrokenBarrier
+	}
+	return phase + 1, nil
+}
+
+// AwaitAdvance waits until the phaser leaves phase, without arriving, and returns the new phase.
+// It returns immediately if the current phase is not phase.
+func (p *Phaser) AwaitAdvance(ctx context.Context, phase int) (int, error) {
+	p.mu.Lock()
+	if p.phase != phase || p.terminated {
+		current := p.phase
+		p.mu.Unlock()
+		return current, nil
+	}
+	gen := p.gen
+	p.mu.Unlock()
+
+	select {
+	case <-gen.done:
+	case <-ctx.Done():
+		return phase, ctx.Err()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if gen.broken {
+		return phase, ErrBrokenBarrier
+	}
+	return phase + 1, nil
+}
+
+func (p *Phaser) checkLocked() error {
+	if p.terminated {
+		if p.gen.broken {
+			return ErrBrokenBarrier
+		}
+		return ErrPhaserTerminated
+	}
+	return nil
+}
+
+// arriveLocked records an arrival and advances the phase if it was the last one.
+func (p *Phaser) arriveLocked(deregister bool) (int, *barrierGeneration, error) {
+	phase, gen := p.phase, p.gen
+	if err := p.checkLocked(); err != nil {
+		return phase, gen, err
+	}
+	if gen.arrived >= p.parties {
+		return phase, gen, fmt.Errorf("phaser: arrival of an unregistered party in phase %d", phase)
+	}
+	if deregister {
+		p.parties--
+	} else {
+		gen.arrived++
+	}
+	if gen.arrived == p.parties {
+		p.advanceLocked()
+	}
+	return phase, gen, nil
+}
+
+func (p *Phaser) advanceLocked() {
+	terminate := p.parties == 0
+	if p.onAdvance != nil && p.onAdvance(p.phase, p.parties) {
+		terminate = true
+	}
+	close(p.gen.done)
+	p.phase++
+	p.gen = newBarrierGeneration()
+	p.terminated = terminate
+}
+
+func (p *Phaser) Phase() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.phase
+}
+
+func (p *Phaser) RegisteredParties() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.parties
+}
+
+// ArrivedParties returns the number of parties that arrived at the current phase.
+func (p *Phaser) ArrivedParties() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.gen.arrived
+}
+
+func (p *Phaser) IsTerminated() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.terminated
+}
@@ -0,0 +1,166 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBarrier(t *testing.T) {
+	const parties = 4
+	var trips atomic.Int32
+	b := NewBarrier(parties, func() error { trips.Add(1); return nil })
+
+	var counter atomic.Int32
+	var wg sync.WaitGroup
+	for range parties {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := range 3 {
+				counter.Add(1)
+				if _, err := b.Await(context.Background()); err != nil {
+					t.Error(err)
+					return
+				}
+				// every party sees the arrivals of the whole round
+				if n := counter.Load(); n < int32(parties*(round+1)) {
+					t.Errorf("round %d released early: %d arrivals", round, n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if trips.Load() != 3 {
+		t.Fatalf("expected 3 trips, got %d", trips.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := b.Await(context.Background())
+		waiter <- err
+	}()
+	if _, err := b.Await(ctx); !errors.Is(err, ErrBrokenBarrier) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a broken barrier timeout, got %v", err)
+	}
+	if err := <-waiter; !errors.Is(err, ErrBrokenBarrier) {
+		t.Fatalf("waiting party not released with ErrBrokenBarrier: %v", err)
+	}
+	if _, err := b.Await(context.Background()); !errors.Is(err, ErrBrokenBarrier) || !b.IsBroken() {
+		t.Fatal("barrier not broken")
+	}
+
+	b.Reset()
+	if b.IsBroken() || b.Waiting() != 0 {
+		t.Fatal("Reset did not repair the barrier")
+	}
+
+	failing := NewBarrier(1, func() error { panic("boom") })
+	if _, err := failing.Await(context.Background()); !errors.Is(err, ErrBrokenBarrier) || !failing.IsBroken() {
+		t.Fatalf("a panicking action did not break the barrier: %v", err)
+	}
+}
+
+func TestBarrier_TimeoutDuringAction(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	b := NewBarrier(2, func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := b.Await(ctx)
+		waiter <- err
+	}()
+	for b.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	last := make(chan error, 1)
+	go func() {
+		_, err := b.Await(context.Background())
+		last <- err
+	}()
+	<-started
+	// the waiting party gives up while the action runs
+	cancel()
+	if err := <-waiter; !errors.Is(err, ErrBrokenBarrier) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a broken barrier cancellation, got %v", err)
+	}
+	close(release)
+	if err := <-last; !errors.Is(err, ErrBrokenBarrier) {
+		t.Fatalf("expected ErrBrokenBarrier for the last party, got %v", err)
+	}
+	if !b.IsBroken() {
+		t.Fatal("barrier not broken")
+	}
+}
+
+func TestPhaser(t *testing.T) {
+	var advanced []int
+	p := NewPhaser(1, func(phase, parties int) bool {
+		advanced = append(advanced, phase)
+		return false
+	})
+	ctx := context.Background()
+
+	phase, err := p.Register()
+	if err != nil || phase != 0 {
+		t.Fatal(phase, err)
+	}
+	done := make(chan int, 1)
+	go func() {
+		next, err := p.ArriveAndAwait(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- next
+	}()
+	for p.ArrivedParties() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := p.ArriveAndDeregister(); err != nil {
+		t.Fatal(err)
+	}
+	if next := <-done; next != 1 || p.Phase() != 1 || p.RegisteredParties() != 1 {
+		t.Fatalf("unexpected phase %d, registered %d", next, p.RegisteredParties())
+	}
+
+	// a single party advances alone
+	if next, err := p.Await(ctx); err != nil || next != 2 {
+		t.Fatal(next, err)
+	}
+	if next, _ := p.AwaitAdvance(ctx, 1); next != 2 {
+		t.Fatalf("AwaitAdvance of a past phase returned %d", next)
+	}
+
+	if _, err := p.Register(); err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.ArriveAndAwait(timeout); !errors.Is(err, ErrBrokenBarrier) {
+		t.Fatalf("expected a broken phase, got %v", err)
+	}
+	if _, err := p.Arrive(); !errors.Is(err, ErrBrokenBarrier) || !p.IsTerminated() {
+		t.Fatal("broken phaser not terminated")
+	}
+	if len(advanced) != 2 || advanced[1] != 1 {
+		t.Fatalf("unexpected advanced phases %v", advanced)
+	}
+
+	last := NewPhaser(1, nil)
+	if _, err := last.ArriveAndDeregister(); err != nil || !last.IsTerminated() {
+		t.Fatal("phaser not terminated by the deregistration of the last party")
+	}
+	if _, err := last.Register(); !errors.Is(err, ErrPhaserTerminated) {
+		t.Fatalf("expected ErrPhaserTerminated, got %v", err)
+	}
+}
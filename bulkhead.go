@@ -0,0 +1,358 @@
+package doraemon
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBulkheadFull is returned by Bulkhead.Acquire when the wait queue is full.
+	ErrBulkheadFull = errors.New("bulkhead is full")
+	// ErrBulkheadTimeout is returned by Bulkhead.Acquire when the queue timeout elapses.
+	ErrBulkheadTimeout = errors.New("bulkhead queue timeout")
+)
+
+// BulkheadStats is a snapshot of the usage of a Bulkhead.
+type BulkheadStats struct {
+	// Size is the total weight of the bulkhead.
+	Size int64
+	// InFlight is the weight currently acquired.
+	InFlight int64
+	// Waiting is the number of callers in the wait queue.
+	Waiting int
+	// Acquired, Rejected and TimedOut count the Acquire and TryAcquire calls by outcome.
+	// Rejected includes the calls canceled by their context.
+	Acquired uint64
+	Rejected uint64
+	TimedOut uint64
+}
+
+type bulkheadWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+// Bulkhead is a weighted semaphore limiting the concurrent operations on a dependency,
+// with a bounded FIFO wait queue and a queue timeout. It is safe for concurrent use.
+type Bulkhead struct {
+	mu       sync.Mutex
+	size     int64
+	cur      int64
+	waiters  list.List
+	lastUsed time.Time
+	stats    BulkheadStats
+	// pins counts the calls of a KeyedBulkhead in progress, a pinned bulkhead is not idle
+	pins int
+
+	maxQueue     int
+	queueTimeout time.Duration
+}
+
+// BulkheadOption configures a Bulkhead.
+type BulkheadOption func(*Bulkhead)
+
+// BulkheadWithMaxQueue bounds the number of callers waiting in Acquire, 0 means no limit.
+// When the queue is full, Acquire fails with ErrBulkheadFull.
+func BulkheadWithMaxQueue(n int) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.maxQueue = n
+	}
+}
+
+// BulkheadWithQueueTimeout bounds the time spent waiting in Acquire, 0 means no limit.
+// When it elapses, Acquire fails with ErrBulkheadTimeout.
+func BulkheadWithQueueTimeout(d time.Duration) BulkheadOption {
+	return func(b *Bulkhead) {
+		b.queueTimeout = d
+	}
+}
+
+// NewBulkhead creates a Bulkhead with a total weight of size.
+func NewBulkhead(size int64, opts ...BulkheadOption) *Bulkhead {
+	if size <= 0 {
+		panic("size must be greater than 0")
+	}
+	b := &Bulkhead{size: size, lastUsed: time.Now()}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Acquire acquires a weight of n, waiting in FIFO order until it is available,
+// ctx is done, or the queue timeout elapses. On failure nothing is acquired.
+// n must be in [1, size].
+func (b *Bulkhead) Acquire(ctx context.Context, n int64) error {
+	b.mu.Lock()
+	b.lastUsed = time.Now()
+	if err := b.checkWeight(n); err != nil {
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return err
+	}
+	if b.size-b.cur >= n && b.waiters.Len() == 0 {
+		b.cur += n
+		b.stats.Acquired++
+		b.mu.Unlock()
+		return nil
+	}
+	if b.maxQueue > 0 && b.waiters.Len() >= b.maxQueue {
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return ErrBulkheadFull
+	}
+	ready := make(chan struct{})
+	elem := b.waiters.PushBack(bulkheadWaiter{n: n, ready: ready})
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if b.queueTimeout > 0 {
+		timer := time.NewTimer(b.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrBulkheadTimeout
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-ready:
+		// acquired while giving up, keep it
+		return nil
+	default:
+	}
+	isFront := b.waiters.Front() == elem
+	b.waiters.Remove(elem)
+	if err == ErrBulkheadTimeout {
+		b.stats.TimedOut++
+	} else {
+		b.stats.Rejected++
+	}
+	// the callers behind the first waiter may fit now
+	if isFront && b.size > b.cur {
+		b.notifyWaitersLocked()
+	}
+	return err
+}
+
+// checkWeight returns an error if n is not a weight that can be acquired.
+func (b *Bulkhead) checkWeight(n int64) error {
+	if n <= 0 || n > b.size {
+		return fmt.Errorf("bulkhead: weight %d out of range [1, %d]", n, b.size)
+	}
+	return nil
+}
+
+// TryAcquire acquires a weight of n without waiting and reports whether it succeeded.
+// It fails if n is not in [1, size].
+func (b *Bulkhead) TryAcquire(n int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastUsed = time.Now()
+	if b.checkWeight(n) == nil && b.size-b.cur >= n && b.waiters.Len() == 0 {
+		b.cur += n
+		b.stats.Acquired++
+		return true
+	}
+	b.stats.Rejected++
+	return false
+}
+
+// Release releases a weight of n, it panics if n is not in [1, size] or if more than the
+// acquired weight is released.
+func (b *Bulkhead) Release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.checkWeight(n); err != nil {
+		panic(err.Error())
+	}
+	b.lastUsed = time.Now()
+	b.cur -= n
+	if b.cur < 0 {
+		panic("bulkhead: released more than held")
+	}
+	b.notifyWaitersLocked()
+}
+
+func (b *Bulkhead) notifyWaitersLocked() {
+	for {
+		front := b.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(bulkheadWaiter)
+		// FIFO: the first waiter is not overtaken by smaller ones
+		if b.size-b.cur < w.n {
+			return
+		}
+		b.cur += w.n
+		b.stats.Acquired++
+		b.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// Stats returns a snapshot of the usage of the bulkhead.
+func (b *Bulkhead) Stats() BulkheadStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := b.stats
+	stats.Size = b.size
+	stats.InFlight = b.cur
+	stats.Waiting = b.waiters.Len()
+	return stats
+}
+
+// idle reports whether the bulkhead is unused since before deadline.
+func (b *Bulkhead) idle(deadline time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cur == 0 && b.waiters.Len() == 0 && b.pins == 0 && b.lastUsed.Before(deadline)
+}
+
+// KeyedBulkhead manages a Bulkhead per key, e.g. per dependency or per user,
+// the bulkheads that stay unused for the idle timeout are removed.
+type KeyedBulkhead struct {
+	bulkheads     map[string]*Bulkhead
+	bulkheadsMu   sync.RWMutex
+	size          int64
+	opts          []BulkheadOption
+	idleTimeout   time.Duration
+	cleanupCancel context.CancelFunc
+}
+
+// NewKeyedBulkhead creates a KeyedBulkhead whose bulkheads have a total weight of size,
+// configured with opts. Unused bulkheads are removed after idleTimeout.
+func NewKeyedBulkhead(size int64, idleTimeout time.Duration, opts ...BulkheadOption) *KeyedBulkhead {
+	if size <= 0 {
+		panic("size must be greater than 0")
+	}
+	if idleTimeout <= 0 {
+		panic("idleTimeout must be greater than 0")
+	}
+	kb := &KeyedBulkhead{
+		bulkheads:   make(map[string]*Bulkhead),
+		size:        size,
+		opts:        opts,
+		idleTimeout: idleTimeout,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	kb.cleanupCancel = cancel
+	go kb.cleanupInactiveBulkheads(ctx)
+	return kb
+}
+
+// Get returns the bulkhead of key, creating it if needed. The bulkhead is removed once it
+// stays unused for the idle timeout, a caller keeping it longer should use the methods of
+// the KeyedBulkhead instead, which never act on a removed bulkhead.
+func (kb *KeyedBulkhead) Get(key string) *Bulkhead {
+	b := kb.pin(key)
+	b.unpin()
+	return b
+}
+
+// pin returns the bulkhead of key, creating it if needed, and keeps it from being removed
+// until unpin is called.
+func (kb *KeyedBulkhead) pin(key string) *Bulkhead {
+	// the cleanup holds the write lock, it cannot remove b while it is pinned under the read lock
+	kb.bulkheadsMu.RLock()
+	if b, exists := kb.bulkheads[key]; exists {
+		b.mu.Lock()
+		b.pins++
+		b.mu.Unlock()
+		kb.bulkheadsMu.RUnlock()
+		return b
+	}
+	kb.bulkheadsMu.RUnlock()
+
+	newBulkhead := NewBulkhead(kb.size, kb.opts...)
+
+	kb.bulkheadsMu.Lock()
+	defer kb.bulkheadsMu.Unlock()
+	b, exists := kb.bulkheads[key]
+	if !exists {
+		b = newBulkhead
+		kb.bulkheads[key] = b
+	}
+	b.mu.Lock()
+	b.pins++
+	b.mu.Unlock()
+	return b
+}
+
+func (b *Bulkhead) unpin() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pins--
+	b.lastUsed = time.Now()
+}
+
+func (kb *KeyedBulkhead) Acquire(ctx context.Context, key string, n int64) error {
+	b := kb.pin(key)
+	defer b.unpin()
+	return b.Acquire(ctx, n)
+}
+
+func (kb *KeyedBulkhead) TryAcquire(key string, n int64) bool {
+	b := kb.pin(key)
+	defer b.unpin()
+	return b.TryAcquire(n)
+}
+
+func (kb *KeyedBulkhead) Release(key string, n int64) {
+	b := kb.pin(key)
+	defer b.unpin()
+	b.Release(n)
+}
+
+// Stats returns the stats of every bulkhead by key.
+func (kb *KeyedBulkhead) Stats() map[string]BulkheadStats {
+	kb.bulkheadsMu.RLock()
+	defer kb.bulkheadsMu.RUnlock()
+	stats := make(map[string]BulkheadStats, len(kb.bulkheads))
+	for key, b := range kb.bulkheads {
+		stats[key] = b.Stats()
+	}
+	return stats
+}
+
+func (kb *KeyedBulkhead) cleanupInactiveBulkheads(ctx context.Context) {
+	var cleanupInterval = max(time.Second*5, kb.idleTimeout)
+	var ticker = time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			kb.tryGc()
+		}
+	}
+}
+
+func (kb *KeyedBulkhead) tryGc() {
+	deadline := time.Now().Add(-kb.idleTimeout)
+	kb.bulkheadsMu.Lock()
+	defer kb.bulkheadsMu.Unlock()
+	for key, b := range kb.bulkheads {
+		if b.idle(deadline) {
+			delete(kb.bulkheads, key)
+		}
+	}
+}
+
+func (kb *KeyedBulkhead) CancelCleanup() {
+	kb.cleanupCancel()
+}
@@ -0,0 +1,115 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	b := NewBulkhead(3, BulkheadWithMaxQueue(1), BulkheadWithQueueTimeout(50*time.Millisecond))
+	ctx := context.Background()
+	if err := b.Acquire(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if b.TryAcquire(2) {
+		t.Fatal("TryAcquire exceeded the size")
+	}
+	if !b.TryAcquire(1) {
+		t.Fatal("TryAcquire failed with free weight")
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.Acquire(ctx, 2) }()
+	for b.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Acquire(ctx, 1); !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+	b.Release(2)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Stats(); s.InFlight != 3 || s.Waiting != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	if err := b.Acquire(ctx, 1); !errors.Is(err, ErrBulkheadTimeout) {
+		t.Fatalf("expected ErrBulkheadTimeout, got %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := b.Acquire(canceled, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := b.Acquire(ctx, 4); err == nil {
+		t.Fatal("expected an error for a weight larger than the size")
+	}
+
+	b.Release(3)
+	s := b.Stats()
+	want := BulkheadStats{Size: 3, Acquired: 3, Rejected: 4, TimedOut: 1}
+	if s != want {
+		t.Fatalf("got stats %+v, want %+v", s, want)
+	}
+}
+
+func TestKeyedBulkhead(t *testing.T) {
+	kb := NewKeyedBulkhead(1, time.Millisecond)
+	defer kb.CancelCleanup()
+	if !kb.TryAcquire("a", 1) || kb.TryAcquire("a", 1) {
+		t.Fatal("bulkhead a did not limit")
+	}
+	if !kb.TryAcquire("b", 1) {
+		t.Fatal("bulkhead b shared the weight of a")
+	}
+	kb.Release("b", 1)
+	time.Sleep(5 * time.Millisecond)
+	kb.tryGc()
+	stats := kb.Stats()
+	if _, ok := stats["b"]; ok || stats["a"].InFlight != 1 {
+		t.Fatalf("unexpected stats after gc %+v", stats)
+	}
+}
+
+func TestKeyedBulkhead_PinnedAndWeights(t *testing.T) {
+	kb := NewKeyedBulkhead(2, time.Millisecond)
+	defer kb.CancelCleanup()
+	// a bulkhead being acquired is not removed between its lookup and the acquisition
+	b := kb.pin("a")
+	time.Sleep(5 * time.Millisecond)
+	kb.tryGc()
+	if kb.Get("a") != b {
+		t.Fatal("pinned bulkhead removed")
+	}
+	b.unpin()
+	if err := kb.Acquire(context.Background(), "a", 2); err != nil {
+		t.Fatal(err)
+	}
+	if kb.TryAcquire("a", 1) {
+		t.Fatal("per key limit exceeded")
+	}
+	kb.Release("a", 2)
+
+	for _, n := range []int64{0, -1, 3} {
+		if err := b.Acquire(context.Background(), n); err == nil {
+			t.Fatalf("Acquire(%d) succeeded", n)
+		}
+		if b.TryAcquire(n) {
+			t.Fatalf("TryAcquire(%d) succeeded", n)
+		}
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Release(%d) did not panic", n)
+				}
+			}()
+			b.Release(n)
+		}()
+	}
+	if s := b.Stats(); s.InFlight != 0 {
+		t.Fatalf("invalid weights changed the bulkhead: %+v", s)
+	}
+}
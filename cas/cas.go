@@ -0,0 +1,425 @@
+// Package cas is a content-addressable store: blobs are stored once, under the SHA-256 of
+// their content, and shared by reference counting.
+//
+// A Store is a directory:
+//
+//	objects/ab/cd/abcdef...  the blobs, sharded by the first bytes of their digest
+//	tmp/                     the blobs being ingested
+//	meta.json                the size, reference count and creation time of the blobs, a doraemon.SimpleKV
+//
+// A blob is hashed while it is written to a temporary file, which is then renamed to its
+// digest, so a blob is never visible partially written. Reads verify the digest of the content.
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+var (
+	// ErrNotFound is returned for a digest that is not in the store.
+	ErrNotFound = errors.New("cas: not found")
+	// ErrCorrupted is returned when the content of a blob does not match its digest.
+	ErrCorrupted = errors.New("cas: corrupted blob")
+	// ErrInvalidDigest is returned for a digest that is not a lowercase hex SHA-256.
+	ErrInvalidDigest = errors.New("cas: invalid digest")
+)
+
+// Digest is the lowercase hex SHA-256 of a blob, as returned by doraemon.ComputeSHA256Hex.
+type Digest string
+
+// ParseDigest checks that s is a lowercase hex SHA-256.
+func ParseDigest(s string) (Digest, error) {
+	d := Digest(s)
+	if !d.valid() {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, s)
+	}
+	return d, nil
+}
+
+func (d Digest) valid() bool {
+	if len(d) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(d); i++ {
+		c := d[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Digest) String() string {
+	return string(d)
+}
+
+// Meta is the metadata of a blob.
+type Meta struct {
+	Size    int64     `json:"size"`
+	Refs    int       `json:"refs"`
+	Created time.Time `json:"created"`
+}
+
+// Store is a content-addressable store in a directory, it is safe for concurrent use.
+// A directory must only be used by one Store at a time.
+//
+// The metadata is a SimpleKV, which rewrites and syncs the whole meta.json on each change:
+// Put, Ref and Unref cost O(number of blobs), a GC rewrites it once. A Store suits thousands
+// of blobs, not millions.
+type Store struct {
+	root  string
+	meta  *doraemon.SimpleKV
+	locks doraemon.KeyedMutex[Digest]
+	// gcMu serializes the GCs, a GC holds the locks of several digests
+	gcMu sync.Mutex
+}
+
+// New opens the store in the directory root, creating it if needed.
+func New(root string) (*Store, error) {
+	for _, dir := range []string{root, filepath.Join(root, "objects"), filepath.Join(root, "tmp")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	meta, err := doraemon.NewSimpleKV(filepath.Join(root, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+	return &Store{root: root, meta: meta}, nil
+}
+
+// Path returns the path of the blob d, e.g. objects/ab/cd/abcdef... in the store.
+func (s *Store) Path(d Digest) (string, error) {
+	if !d.valid() {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDigest, d)
+	}
+	return s.path(d), nil
+}
+
+func (s *Store) path(d Digest) string {
+	return filepath.Join(s.root, "objects", string(d[:2]), string(d[2:4]), string(d))
+}
+
+// Put stores the content of r and returns its digest. The reference count of the blob is
+// incremented, so each Put must be balanced by an Unref. A blob already in the store is
+// stored once: it is replaced by the new copy, which repairs a corrupted blob.
+func (s *Store) Put(r io.Reader) (Digest, error) {
+	tmp, err := os.CreateTemp(filepath.Join(s.root, "tmp"), "ingest-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	d := Digest(hex.EncodeToString(h.Sum(nil)))
+
+	s.locks.Lock(d)
+	defer s.locks.Unlock(d)
+	if err := s.commit(tmpName, d); err != nil {
+		return "", err
+	}
+	m, ok, err := s.stat(d)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		m = Meta{Size: size, Created: time.Now()}
+	}
+	m.Refs++
+	return d, s.setMeta(d, m)
+}
+
+// PutFile stores the content of the file name, see Put.
+func (s *Store) PutFile(name string) (Digest, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return s.Put(f)
+}
+
+// commit moves the ingested file tmpName to the blob d. The ingested file was hashed while it
+// was written, it replaces an existing blob, which may be corrupted.
+func (s *Store) commit(tmpName string, d Digest) error {
+	path := s.path(d)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// directories cannot be synced on some systems, e.g. Windows
+	_ = f.Sync()
+	return nil
+}
+
+// Open opens the blob d for reading. The content is verified against the digest as it is read:
+// the Read returning the end of the blob returns ErrCorrupted instead of io.EOF on a mismatch.
+func (s *Store) Open(d Digest) (io.ReadCloser, error) {
+	if !d.valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDigest, d)
+	}
+	f, err := os.Open(s.path(d))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, d)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{f: f, d: d, h: sha256.New()}, nil
+}
+
+type verifyingReader struct {
+	f *os.File
+	d Digest
+	h hash.Hash
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.h.Sum(nil)) != string(r.d) {
+		err = fmt.Errorf("%w: %s", ErrCorrupted, r.d)
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.f.Close()
+}
+
+// Get returns the content of the blob d, verified against its digest.
+func (s *Store) Get(d Digest) ([]byte, error) {
+	rc, err := s.Open(d)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Verify reads the blob d and checks its digest, it returns ErrCorrupted on a mismatch.
+func (s *Store) Verify(d Digest) error {
+	rc, err := s.Open(d)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+// Has reports whether the blob d is in the store.
+func (s *Store) Has(d Digest) bool {
+	_, ok, _ := s.stat(d)
+	return ok
+}
+
+// Stat returns the metadata of the blob d.
+func (s *Store) Stat(d Digest) (Meta, error) {
+	if !d.valid() {
+		return Meta{}, fmt.Errorf("%w: %q", ErrInvalidDigest, d)
+	}
+	m, ok, err := s.stat(d)
+	if err != nil {
+		return Meta{}, err
+	}
+	if !ok {
+		return Meta{}, fmt.Errorf("%w: %s", ErrNotFound, d)
+	}
+	return m, nil
+}
+
+func (s *Store) stat(d Digest) (Meta, bool, error) {
+	v, ok := s.meta.Get(string(d))
+	if !ok {
+		return Meta{}, false, nil
+	}
+	var m Meta
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		return Meta{}, false, fmt.Errorf("cas: metadata of %s: %w", d, err)
+	}
+	return m, true, nil
+}
+
+func (s *Store) setMeta(d Digest, m Meta) error {
+	v, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return s.meta.Set(string(d), string(v))
+}
+
+// Ref adds a reference to the blob d, e.g. for a second owner of an upload.
+func (s *Store) Ref(d Digest) error {
+	_, err := s.addRefs(d, 1)
+	return err
+}
+
+// Unref removes a reference to the blob d and returns the remaining count. A blob without
+// references stays in the store until the next GC.
+func (s *Store) Unref(d Digest) (int, error) {
+	return s.addRefs(d, -1)
+}
+
+func (s *Store) addRefs(d Digest, delta int) (int, error) {
+	if !d.valid() {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDigest, d)
+	}
+	s.locks.Lock(d)
+	defer s.locks.Unlock(d)
+	m, ok, err := s.stat(d)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, d)
+	}
+	m.Refs = max(m.Refs+delta, 0)
+	return m.Refs, s.setMeta(d, m)
+}
+
+// tmpMaxAge is the age after which GC removes an ingested file, it is left by a crashed Put.
+const tmpMaxAge = 24 * time.Hour
+
+// GCStats is the result of a GC.
+type GCStats struct {
+	// Removed is the number of blobs removed, Bytes their total size.
+	Removed int
+	Bytes   int64
+}
+
+// GC removes the blobs without references, and the files left by interrupted writes.
+// It can run concurrently with the other methods.
+func (s *Store) GC() (GCStats, error) {
+	s.gcMu.Lock()
+	defer s.gcMu.Unlock()
+	var stats GCStats
+	var unreferenced []Digest
+	s.meta.Range(func(key, value string) bool {
+		var m Meta
+		if json.Unmarshal([]byte(value), &m) == nil && m.Refs <= 0 {
+			unreferenced = append(unreferenced, Digest(key))
+		}
+		return true
+	})
+	// the digests stay locked until their metadata is deleted, in a single save
+	var deleted []string
+	defer func() {
+		for _, d := range unreferenced {
+			s.locks.Unlock(d)
+		}
+	}()
+	for i, d := range unreferenced {
+		s.locks.Lock(d)
+		removed, err := s.removeUnreferenced(d)
+		if err != nil {
+			unreferenced = unreferenced[:i+1]
+			return stats, err
+		}
+		if removed >= 0 {
+			stats.Removed++
+			stats.Bytes += removed
+			deleted = append(deleted, string(d))
+		}
+	}
+	if err := s.meta.DeleteMany(deleted...); err != nil {
+		return stats, err
+	}
+
+	// blobs without metadata, e.g. when the metadata could not be saved after a write
+	err := filepath.WalkDir(filepath.Join(s.root, "objects"), func(path string, e fs.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		d := Digest(e.Name())
+		if !d.valid() || s.Has(d) {
+			return nil
+		}
+		s.locks.Lock(d)
+		defer s.locks.Unlock(d)
+		removed, err := s.removeUnreferenced(d)
+		if err == nil && removed >= 0 {
+			stats.Removed++
+			stats.Bytes += removed
+		}
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(s.root, "tmp"))
+	if err != nil {
+		return stats, err
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > tmpMaxAge {
+			_ = os.Remove(filepath.Join(s.root, "tmp", e.Name()))
+		}
+	}
+	return stats, nil
+}
+
+// removeUnreferenced removes the file of the blob d, locked by the caller, if it still has no
+// references, and returns its size, or -1 if it was not removed. The metadata is left to the
+// caller.
+func (s *Store) removeUnreferenced(d Digest) (int64, error) {
+	m, ok, err := s.stat(d)
+	if err != nil {
+		return -1, err
+	}
+	if ok && m.Refs > 0 {
+		return -1, nil
+	}
+	path := s.path(d)
+	info, err := os.Stat(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return -1, err
+	}
+	if err == nil {
+		if err := os.Remove(path); err != nil {
+			return -1, err
+		}
+		// the empty shard directories are left, they are reused by later blobs
+	}
+	if info == nil {
+		return 0, nil
+	}
+	return info.Size(), nil
+}
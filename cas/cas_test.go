@@ -0,0 +1,170 @@
+package cas
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+func TestStore_PutGet(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("hello cas")
+	d, err := s.Put(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := doraemon.ComputeSHA256Hex(bytes.NewReader(content)).Value
+	if string(d) != want {
+		t.Fatalf("digest %s, want %s", d, want)
+	}
+	if rel, _ := filepath.Rel(s.root, s.path(d)); rel != filepath.Join("objects", want[:2], want[2:4], want) {
+		t.Fatalf("unexpected path %s", rel)
+	}
+	got, err := s.Get(d)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	// a duplicate is stored once and referenced twice
+	if d2, err := s.Put(bytes.NewReader(content)); err != nil || d2 != d {
+		t.Fatalf("Put = %s, %v", d2, err)
+	}
+	m, err := s.Stat(d)
+	if err != nil || m.Refs != 2 || m.Size != int64(len(content)) {
+		t.Fatalf("Stat = %+v, %v", m, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(s.root, "tmp")); len(entries) != 0 {
+		t.Fatalf("temporary files left: %v", entries)
+	}
+
+	// the metadata is persisted
+	s, err = New(s.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, err := s.Stat(d); err != nil || m.Refs != 2 {
+		t.Fatalf("Stat after reopen = %+v, %v", m, err)
+	}
+
+	missing := Digest(strings.Repeat("0", 64))
+	if _, err := s.Get(missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get("../../etc/passwd"); !errors.Is(err, ErrInvalidDigest) {
+		t.Fatalf("expected ErrInvalidDigest, got %v", err)
+	}
+	for _, invalid := range []Digest{"", "ab", Digest(strings.Repeat("A", 64))} {
+		if _, err := s.Path(invalid); !errors.Is(err, ErrInvalidDigest) {
+			t.Fatalf("Path(%q): expected ErrInvalidDigest, got %v", invalid, err)
+		}
+	}
+	if p, err := s.Path(d); err != nil || p != s.path(d) {
+		t.Fatalf("Path = %q, %v", p, err)
+	}
+}
+
+func TestStore_VerifyOnRead(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.Put(strings.NewReader("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.path(d), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(d); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+	rc, err := s.Open(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(io.Discard, rc); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+
+	// putting the content again repairs the blob, even with the same size
+	if _, err := s.Put(strings.NewReader("original")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(d); err != nil || string(got) != "original" {
+		t.Fatalf("blob not repaired: %q, %v", got, err)
+	}
+}
+
+func TestStore_RefsAndGC(t *testing.T) {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := s.Put(strings.NewReader("kept"))
+	dropped, _ := s.Put(strings.NewReader("dropped"))
+	if err := s.Ref(dropped); err != nil {
+		t.Fatal(err)
+	}
+	for want := 1; want >= 0; want-- {
+		if n, err := s.Unref(dropped); err != nil || n != want {
+			t.Fatalf("Unref = %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, _ := s.Unref(dropped); n != 0 {
+		t.Fatalf("refs below zero: %d", n)
+	}
+	if err := s.Ref(Digest(strings.Repeat("a", 64))); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// a blob without metadata and a stale ingest file
+	orphan := doraemon.ComputeSHA256Hex(strings.NewReader("orphan")).Value
+	orphanPath := s.path(Digest(orphan))
+	if err := os.MkdirAll(filepath.Dir(orphanPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orphanPath, []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(s.root, "tmp", "ingest-stale")
+	if err := os.WriteFile(stale, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * tmpMaxAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := s.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed != 2 || stats.Bytes != int64(len("dropped")+len("orphan")) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if s.Has(dropped) || !s.Has(kept) {
+		t.Fatal("wrong blobs collected")
+	}
+	for _, name := range []string{s.path(dropped), orphanPath, stale} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%s not removed", name)
+		}
+	}
+	if got, err := s.Get(kept); err != nil || string(got) != "kept" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+}
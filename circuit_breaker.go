@@ -0,0 +1,360 @@
+package doraemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int32
+
+const (
+	// CircuitClosed lets all calls through and counts their failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all calls until the open timeout elapses.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe calls through to test the dependency.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrCircuitOpen is returned by a CircuitBreaker that rejects calls.
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// ErrTooManyProbes is returned by a half-open CircuitBreaker whose probe budget is used up.
+	ErrTooManyProbes = errors.New("circuit breaker is half-open: too many probes")
+)
+
+// CircuitCounts are the calls counted in the rolling window of a closed CircuitBreaker.
+type CircuitCounts struct {
+	Requests            int
+	Failures            int
+	ConsecutiveFailures int
+}
+
+type circuitBucket struct {
+	requests int
+	failures int
+}
+
+type circuitTransition struct {
+	from, to CircuitState
+}
+
+// CircuitBreaker stops calling a failing dependency. It is closed at first, and opens when
+// the consecutive failures or the failure ratio in a rolling window reach their threshold.
+// After the open timeout it becomes half-open and lets a budget of probe calls through:
+// a failed probe opens it again, and when all the probes succeed it is closed.
+//
+// It is safe for concurrent use.
+type CircuitBreaker struct {
+	mu         sync.Mutex
+	state      CircuitState
+	generation uint64
+	openedAt   time.Time
+
+	// rolling window, see rotateBuckets
+	windowSize     time.Duration
+	buckets        []circuitBucket
+	currentBucket  int
+	lastUpdateTime time.Time
+
+	consecutiveFailures int
+	probes              int
+	probeSuccesses      int
+
+	maxConsecutiveFailures int
+	failureRatio           float64
+	minRequests            int
+	openTimeout            time.Duration
+	halfOpenProbes         int
+	isFailure              func(error) bool
+	onStateChange          func(from, to CircuitState)
+	clock                  Clock
+}
+
+// CircuitBreakerOption configures a CircuitBreaker.
+type CircuitBreakerOption func(*CircuitBreaker)
+
+// CircuitBreakerWithConsecutiveFailures trips the breaker after n consecutive failures, 0 disables it.
+// The default is 5.
+func CircuitBreakerWithConsecutiveFailures(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.maxConsecutiveFailures = n
+	}
+}
+
+// CircuitBreakerWithFailureRatio trips the breaker when the ratio of failed calls in the rolling
+// window reaches ratio, once the window holds at least minRequests calls. It is disabled by default.
+func CircuitBreakerWithFailureRatio(ratio float64, minRequests int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.failureRatio = ratio
+		cb.minRequests = minRequests
+	}
+}
+
+// CircuitBreakerWithWindow sets the rolling window of the failure ratio, divided into subWindowNum buckets.
+// The default is one minute in 6 buckets.
+func CircuitBreakerWithWindow(windowSize time.Duration, subWindowNum int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		if windowSize > 0 && subWindowNum > 0 {
+			cb.windowSize = windowSize
+			cb.buckets = make([]circuitBucket, subWindowNum)
+		}
+	}
+}
+
+// CircuitBreakerWithOpenTimeout sets how long the breaker stays open before probing, 30 seconds by default.
+func CircuitBreakerWithOpenTimeout(d time.Duration) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		if d > 0 {
+			cb.openTimeout = d
+		}
+	}
+}
+
+// CircuitBreakerWithHalfOpenProbes sets the number of probe calls let through when half-open,
+// they must all succeed to close the breaker. The default is 1.
+func CircuitBreakerWithHalfOpenProbes(n int) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		if n > 0 {
+			cb.halfOpenProbes = n
+		}
+	}
+}
+
+// CircuitBreakerWithIsFailure classifies errors, the errors for which isFailure returns false
+// count as successes, e.g. a "not found" from a healthy dependency. By default every error is a failure.
+func CircuitBreakerWithIsFailure(isFailure func(error) bool) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		if isFailure != nil {
+			cb.isFailure = isFailure
+		}
+	}
+}
+
+// CircuitBreakerWithOnStateChange sets a callback called after each state change.
+// It is called synchronously, without holding the lock of the breaker.
+func CircuitBreakerWithOnStateChange(onStateChange func(from, to CircuitState)) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		cb.onStateChange = onStateChange
+	}
+}
+
+// CircuitBreakerWithClock replaces the SystemClock, for tests.
+func CircuitBreakerWithClock(clock Clock) CircuitBreakerOption {
+	return func(cb *CircuitBreaker) {
+		if clock != nil {
+			cb.clock = clock
+		}
+	}
+}
+
+func NewCircuitBreaker(opts ...CircuitBreakerOption) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		windowSize:             time.Minute,
+		buckets:                make([]circuitBucket, 6),
+		maxConsecutiveFailures: 5,
+		openTimeout:            30 * time.Second,
+		halfOpenProbes:         1,
+		isFailure:              func(err error) bool { return err != nil },
+		clock:                  SystemClock,
+	}
+	for _, opt := range opts {
+		opt(cb)
+	}
+	cb.lastUpdateTime = cb.clock.Now()
+	return cb
+}
+
+// State returns the current state, an open breaker whose timeout elapsed is reported as half-open.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	transitions := cb.refreshLocked(cb.clock.Now())
+	state := cb.state
+	cb.mu.Unlock()
+	cb.notify(transitions)
+	return state
+}
+
+// Counts returns the calls counted in the rolling window, they are reset on each state change.
+func (cb *CircuitBreaker) Counts() CircuitCounts {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	rotateBuckets(cb.buckets, &cb.currentBucket, &cb.lastUpdateTime, cb.windowSize, cb.clock.Now())
+	counts := CircuitCounts{ConsecutiveFailures: cb.consecutiveFailures}
+	for _, b := range cb.buckets {
+		counts.Requests += b.requests
+		counts.Failures += b.failures
+	}
+	return counts
+}
+
+// Allow reports whether a call may proceed. If it may, done must be called with the
+// result of the call; otherwise the error is ErrCircuitOpen or ErrTooManyProbes.
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	record, err := cb.allow()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		record(err != nil && cb.isFailure(err))
+	}, nil
+}
+
+// allow is Allow, the result of the call is recorded once as a failure or a success.
+func (cb *CircuitBreaker) allow() (record func(failed bool), err error) {
+	cb.mu.Lock()
+	transitions := cb.refreshLocked(cb.clock.Now())
+	switch cb.state {
+	case CircuitOpen:
+		err = ErrCircuitOpen
+	case CircuitHalfOpen:
+		if cb.probes >= cb.halfOpenProbes {
+			err = ErrTooManyProbes
+		} else {
+			cb.probes++
+		}
+	}
+	generation := cb.generation
+	cb.mu.Unlock()
+	cb.notify(transitions)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() { cb.record(generation, failed) })
+	}, nil
+}
+
+// recordCall records the result of a call of Do or Execute, a panic is a failure and is propagated.
+func (cb *CircuitBreaker) recordCall(record func(failed bool), err *error) {
+	if r := recover(); r != nil {
+		record(true)
+		panic(r)
+	}
+	record(*err != nil && cb.isFailure(*err))
+}
+
+// Do calls fn if the breaker allows it and records its result. If fn panics, the panic
+// is recorded as a failure and propagated.
+func (cb *CircuitBreaker) Do(fn func() error) (err error) {
+	record, err := cb.allow()
+	if err != nil {
+		return err
+	}
+	defer cb.recordCall(record, &err)
+	return fn()
+}
+
+// Execute calls fn through the circuit breaker cb, see CircuitBreaker.Do.
+func Execute[T any](cb *CircuitBreaker, fn func() (T, error)) Result[T] {
+	record, err := cb.allow()
+	if err != nil {
+		return Err[T](err)
+	}
+	defer cb.recordCall(record, &err)
+	var value T
+	value, err = fn()
+	if err != nil {
+		return Err[T](err)
+	}
+	return Ok(value)
+}
+
+func (cb *CircuitBreaker) record(generation uint64, failed bool) {
+	cb.mu.Lock()
+	now := cb.clock.Now()
+	// the result of a call started in a previous state is ignored
+	if generation != cb.generation {
+		cb.mu.Unlock()
+		return
+	}
+	var transitions []circuitTransition
+	switch cb.state {
+	case CircuitClosed:
+		rotateBuckets(cb.buckets, &cb.currentBucket, &cb.lastUpdateTime, cb.windowSize, now)
+		bucket := &cb.buckets[cb.currentBucket]
+		bucket.requests++
+		if failed {
+			bucket.failures++
+			cb.consecutiveFailures++
+		} else {
+			cb.consecutiveFailures = 0
+		}
+		if failed && cb.shouldTripLocked() {
+			transitions = cb.setStateLocked(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			transitions = cb.setStateLocked(CircuitOpen, now)
+		} else if cb.probeSuccesses++; cb.probeSuccesses >= cb.halfOpenProbes {
+			transitions = cb.setStateLocked(CircuitClosed, now)
+		}
+	}
+	cb.mu.Unlock()
+	cb.notify(transitions)
+}
+
+func (cb *CircuitBreaker) shouldTripLocked() bool {
+	if cb.maxConsecutiveFailures > 0 && cb.consecutiveFailures >= cb.maxConsecutiveFailures {
+		return true
+	}
+	if cb.failureRatio <= 0 {
+		return false
+	}
+	requests, failures := 0, 0
+	for _, b := range cb.buckets {
+		requests += b.requests
+		failures += b.failures
+	}
+	return requests > 0 && requests >= cb.minRequests && float64(failures)/float64(requests) >= cb.failureRatio
+}
+
+// refreshLocked moves an open breaker whose timeout elapsed to half-open.
+func (cb *CircuitBreaker) refreshLocked(now time.Time) []circuitTransition {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.openTimeout {
+		return cb.setStateLocked(CircuitHalfOpen, now)
+	}
+	return nil
+}
+
+func (cb *CircuitBreaker) setStateLocked(state CircuitState, now time.Time) []circuitTransition {
+	from := cb.state
+	cb.state = state
+	cb.generation++
+	cb.consecutiveFailures = 0
+	cb.probes = 0
+	cb.probeSuccesses = 0
+	clear(cb.buckets)
+	cb.currentBucket = 0
+	cb.lastUpdateTime = now
+	if state == CircuitOpen {
+		cb.openedAt = now
+	}
+	return []circuitTransition{{from: from, to: state}}
+}
+
+func (cb *CircuitBreaker) notify(transitions []circuitTransition) {
+	if cb.onStateChange == nil {
+		return
+	}
+	for _, t := range transitions {
+		cb.onStateChange(t.from, t.to)
+	}
+}
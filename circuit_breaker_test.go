@@ -0,0 +1,156 @@
+package doraemon
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker_ConsecutiveFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var changes []string
+	cb := NewCircuitBreaker(
+		CircuitBreakerWithConsecutiveFailures(3),
+		CircuitBreakerWithOpenTimeout(10*time.Second),
+		CircuitBreakerWithHalfOpenProbes(2),
+		CircuitBreakerWithClock(clock),
+		CircuitBreakerWithOnStateChange(func(from, to CircuitState) {
+			changes = append(changes, from.String()+"->"+to.String())
+		}),
+	)
+	errFail := errors.New("fail")
+	fail := func() (int, error) { return 0, errFail }
+	succeed := func() (int, error) { return 1, nil }
+
+	for range 2 {
+		Execute(cb, fail)
+	}
+	Execute(cb, succeed)
+	for range 2 {
+		Execute(cb, fail)
+	}
+	if cb.State() != CircuitClosed {
+		t.Fatal("a success did not reset the consecutive failures")
+	}
+	if r := Execute(cb, fail); r.Err != errFail || cb.State() != CircuitOpen {
+		t.Fatalf("expected the breaker to open, state %v", cb.State())
+	}
+	if r := Execute(cb, succeed); !errors.Is(r.Err, ErrCircuitOpen) {
+		t.Fatalf("open breaker let a call through: %v", r)
+	}
+
+	clock.now = clock.now.Add(10 * time.Second)
+	done1, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done2, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cb.Allow(); !errors.Is(err, ErrTooManyProbes) {
+		t.Fatalf("probe budget exceeded: %v", err)
+	}
+	done1(nil)
+	if cb.State() != CircuitHalfOpen {
+		t.Fatal("closed before all probes succeeded")
+	}
+	done2(nil)
+	if cb.State() != CircuitClosed {
+		t.Fatal("not closed after the probes succeeded")
+	}
+
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected state changes %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("unexpected state changes %v", changes)
+		}
+	}
+}
+
+func TestCircuitBreaker_FailureRatio(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	errFail := errors.New("fail")
+	errNotFound := errors.New("not found")
+	cb := NewCircuitBreaker(
+		CircuitBreakerWithConsecutiveFailures(0),
+		CircuitBreakerWithFailureRatio(0.5, 4),
+		CircuitBreakerWithWindow(10*time.Second, 5),
+		CircuitBreakerWithIsFailure(func(err error) bool { return err != nil && !errors.Is(err, errNotFound) }),
+		CircuitBreakerWithClock(clock),
+	)
+	_ = cb.Do(func() error { return errFail })
+	_ = cb.Do(func() error { return errFail })
+	_ = cb.Do(func() error { return errNotFound })
+	if cb.State() != CircuitClosed {
+		t.Fatal("opened before the minimum number of requests")
+	}
+	if c := cb.Counts(); c.Requests != 3 || c.Failures != 2 {
+		t.Fatalf("unexpected counts %+v", c)
+	}
+
+	// the old failures leave the rolling window
+	clock.now = clock.now.Add(20 * time.Second)
+	_ = cb.Do(func() error { return nil })
+	_ = cb.Do(func() error { return nil })
+	_ = cb.Do(func() error { return errFail })
+	_ = cb.Do(func() error { return nil })
+	if cb.State() != CircuitClosed {
+		t.Fatalf("opened with a ratio below the threshold, counts %+v", cb.Counts())
+	}
+	_ = cb.Do(func() error { return errFail })
+	_ = cb.Do(func() error { return errFail })
+	if cb.State() != CircuitOpen {
+		t.Fatalf("expected open, counts %+v", cb.Counts())
+	}
+
+	clock.now = clock.now.Add(time.Minute)
+	if err := cb.Do(func() error { return errFail }); err != errFail || cb.State() != CircuitOpen {
+		t.Fatal("a failed probe did not reopen the breaker")
+	}
+}
+
+func TestCircuitBreaker_IsFailureAndPanic(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	errNotFound := errors.New("not found")
+	cb := NewCircuitBreaker(
+		CircuitBreakerWithConsecutiveFailures(1),
+		CircuitBreakerWithOpenTimeout(time.Second),
+		CircuitBreakerWithHalfOpenProbes(1),
+		CircuitBreakerWithClock(clock),
+		CircuitBreakerWithIsFailure(func(err error) bool { return !errors.Is(err, errNotFound) }),
+	)
+	// the classifier only sees errors, a success is never a failure
+	for range 3 {
+		if err := cb.Do(func() error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		_ = cb.Do(func() error { return errNotFound })
+	}
+	if cb.State() != CircuitClosed {
+		t.Fatalf("successes counted as failures, state %v", cb.State())
+	}
+
+	panicking := func() (err error) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic not propagated")
+			}
+		}()
+		return cb.Do(func() error { panic("boom") })
+	}
+	panicking()
+	if cb.State() != CircuitOpen {
+		t.Fatal("a panic was not recorded as a failure")
+	}
+	// the panic of the probe releases its slot
+	clock.now = clock.now.Add(time.Second)
+	panicking()
+	clock.now = clock.now.Add(time.Second)
+	if r := Execute(cb, func() (int, error) { return 1, nil }); r.IsErr() || cb.State() != CircuitClosed {
+		t.Fatalf("probe slot not released: %v, state %v", r.Err, cb.State())
+	}
+}
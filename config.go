@@ -1,9 +1,13 @@
 package doraemon
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
 	"sync"
+	"time"
 )
 
 // var Config = NewConfigWrapper[string]("")
@@ -13,25 +17,53 @@ type ConfigWrapper[T comparable] struct {
 	Config     T
 	filePath   string
 	jsonIndent string
+	// unmarshal and marshal are used instead of JSON if set
+	unmarshal func(data []byte, v any) error
+	marshal   func(v any) ([]byte, error)
+	// afterLoad and beforeSave transform the configuration after decoding and before encoding
+	afterLoad  func(T) (T, error)
+	beforeSave func(T) (any, error)
+
+	validate      func(T) error
+	publisher     *Publisher[ConfigChange[T]]
+	watchDebounce time.Duration
+	onWatchError  func(error)
+}
+
+// ConfigChange is published to the subscribers of a ConfigWrapper
+// after a reload that changed the configuration.
+type ConfigChange[T any] struct {
+	Old T
+	New T
 }
 
+const defaultConfigWatchDebounce = 200 * time.Millisecond
+
 func NewConfigWrapper2[T comparable](filePath string) (*ConfigWrapper[T], error) {
-	var v T
-	f, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+	return NewConfigWrapperWithCodec[T](filePath, nil, nil)
+}
 
-	err = json.NewDecoder(f).Decode(&v)
+// NewConfigWrapperWithCodec creates a ConfigWrapper for a configuration file that is not JSON.
+// The file is decoded with unmarshal, and Save writes it back with marshal.
+// If either function is nil, JSON is used for it.
+func NewConfigWrapperWithCodec[T comparable](
+	filePath string,
+	unmarshal func(data []byte, v any) error,
+	marshal func(v any) ([]byte, error),
+) (*ConfigWrapper[T], error) {
+	c := &ConfigWrapper[T]{
+		filePath:      filePath,
+		unmarshal:     unmarshal,
+		marshal:       marshal,
+		publisher:     NewPublisher[ConfigChange[T]](),
+		watchDebounce: defaultConfigWatchDebounce,
+	}
+	v, err := c.load()
 	if err != nil {
 		return nil, err
 	}
-
-	return &ConfigWrapper[T]{
-		filePath: filePath,
-		Config:   v,
-	}, nil
+	c.Config = v
+	return c, nil
 }
 
 func NewConfigWrapper[T comparable](filePath string) *ConfigWrapper[T] {
@@ -46,10 +78,51 @@ func (c *ConfigWrapper[T]) Path() string {
 	return c.filePath
 }
 
+// SetJsonIndent sets the indent of the saved JSON file, it has no effect if a marshal function is set.
 func (c *ConfigWrapper[T]) SetJsonIndent(jsonIndent string) {
 	c.jsonIndent = jsonIndent
 }
 
+// Get returns the current configuration, it is safe to call concurrently with Reload.
+func (c *ConfigWrapper[T]) Get() T {
+	c.ConfigMu.RLock()
+	defer c.ConfigMu.RUnlock()
+	return c.Config
+}
+
+// SetValidator sets a function that checks a newly loaded configuration before
+// Reload swaps it in. If it returns an error, the current configuration is kept.
+func (c *ConfigWrapper[T]) SetValidator(validate func(T) error) {
+	c.validate = validate
+}
+
+// SetWatchDebounce sets how long Watch waits after the last file event before reloading.
+// The default is 200ms.
+func (c *ConfigWrapper[T]) SetWatchDebounce(d time.Duration) {
+	if d > 0 {
+		c.watchDebounce = d
+	}
+}
+
+// SetWatchErrorHandler sets the callback that receives the errors of reloads triggered by Watch.
+func (c *ConfigWrapper[T]) SetWatchErrorHandler(onError func(error)) {
+	c.onWatchError = onError
+}
+
+// SetCodecHooks sets functions that transform the configuration after it is read
+// by Reload and before it is written by SaveTo, e.g. to resolve secret references
+// and write the references back instead of the secrets. beforeSave must not modify
+// the configuration it receives. Nil functions are ignored.
+func (c *ConfigWrapper[T]) SetCodecHooks(afterLoad func(T) (T, error), beforeSave func(T) (any, error)) {
+	c.afterLoad = afterLoad
+	c.beforeSave = beforeSave
+}
+
+// Publisher returns the publisher that notifies subscribers of configuration changes.
+func (c *ConfigWrapper[T]) Publisher() *Publisher[ConfigChange[T]] {
+	return c.publisher
+}
+
 func (c *ConfigWrapper[T]) Save() error {
 	return c.SaveTo(c.filePath)
 }
@@ -62,17 +135,105 @@ func (c *ConfigWrapper[T]) SaveTo(filePath string) error {
 	c.ConfigMu.RLock()
 	defer c.ConfigMu.RUnlock()
 
-	jsonData, err := json.MarshalIndent(c.Config, "", c.jsonIndent)
+	var config any = c.Config
+	if c.beforeSave != nil {
+		var err error
+		if config, err = c.beforeSave(c.Config); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	var err error
+	if c.marshal != nil {
+		data, err = c.marshal(config)
+	} else {
+		data, err = json.MarshalIndent(config, "", c.jsonIndent)
+	}
 	if err != nil {
 		return err
 	}
 
-	return WriteFilePreservePerms(filePath, jsonData)
+	return WriteFilePreservePerms(filePath, data)
+}
+
+func (c *ConfigWrapper[T]) load() (T, error) {
+	var v T
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		return v, err
+	}
+	if c.unmarshal != nil {
+		err = c.unmarshal(data, &v)
+	} else {
+		err = json.Unmarshal(data, &v)
+	}
+	if err != nil {
+		return v, err
+	}
+	if c.afterLoad != nil {
+		return c.afterLoad(v)
+	}
+	return v, nil
 }
 
-// Reload will cause panic, Do not use this function.
+// Reload reads the configuration file again. The new configuration is validated
+// (see SetValidator) and then swapped in under ConfigMu. If it differs from the
+// old one, compared with reflect.DeepEqual so that a pointer or a struct holding
+// slices or maps is compared by content, a ConfigChange is published to the subscribers.
 //
-// If you need to reload the configuration, please create a new ConfigWrapper.
+// On error the current configuration is kept.
 func (c *ConfigWrapper[T]) Reload() error {
-	panic("don't use this function")
+	newConfig, err := c.load()
+	if err != nil {
+		return err
+	}
+	if c.validate != nil {
+		if err := c.validate(newConfig); err != nil {
+			return fmt.Errorf("invalid config %s: %w", c.filePath, err)
+		}
+	}
+
+	c.ConfigMu.Lock()
+	oldConfig := c.Config
+	c.Config = newConfig
+	c.ConfigMu.Unlock()
+
+	if !reflect.DeepEqual(oldConfig, newConfig) {
+		c.publisher.Publish(ConfigChange[T]{Old: oldConfig, New: newConfig})
+	}
+	return nil
+}
+
+// Watch starts watching the configuration file and reloads it when it changes.
+// Bursts of writes are debounced (see SetWatchDebounce), reload errors are passed
+// to the handler set by SetWatchErrorHandler.
+//
+// Watch returns immediately, watching stops when ctx is done.
+func (c *ConfigWrapper[T]) Watch(ctx context.Context) error {
+	events, err := WatchFile(ctx, c.filePath, 0)
+	if err != nil {
+		return err
+	}
+	go c.watchLoop(events)
+	return nil
+}
+
+func (c *ConfigWrapper[T]) watchLoop(events <-chan struct{}) {
+	timer := time.NewTimer(c.watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+			timer.Reset(c.watchDebounce)
+		case <-timer.C:
+			if err := c.Reload(); err != nil && c.onWatchError != nil {
+				c.onWatchError(err)
+			}
+		}
+	}
 }
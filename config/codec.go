@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Codec describes a configuration file format.
+type Codec struct {
+	// Name of the format, e.g. "json".
+	Name string
+	// TagName is the struct tag that holds the key names of the format.
+	TagName   string
+	Marshal   func(v any) ([]byte, error)
+	Unmarshal func(data []byte, v any) error
+}
+
+var JsonCodec = Codec{
+	Name:    "json",
+	TagName: "json",
+	Marshal: func(v any) ([]byte, error) {
+		return json.MarshalIndent(v, "", "    ")
+	},
+	Unmarshal: json.Unmarshal,
+}
+
+var TomlCodec = Codec{
+	Name:      "toml",
+	TagName:   "toml",
+	Marshal:   toml.Marshal,
+	Unmarshal: toml.Unmarshal,
+}
+
+var YamlCodec = Codec{
+	Name:      "yaml",
+	TagName:   "yaml",
+	Marshal:   yaml.Marshal,
+	Unmarshal: yaml.Unmarshal,
+}
+
+// CodecForFile returns the codec of a configuration file based on its extension.
+func CodecForFile(path string) (Codec, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JsonCodec, nil
+	case ".toml":
+		return TomlCodec, nil
+	case ".yaml", ".yml":
+		return YamlCodec, nil
+	case ".ini":
+		return IniCodec, nil
+	default:
+		return Codec{}, fmt.Errorf("unsupported config file format: %q", path)
+	}
+}
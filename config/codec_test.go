@@ -0,0 +1,136 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type formatDatabase struct {
+	Host    string        `json:"host" toml:"host" yaml:"host" ini:"host"`
+	Port    int           `json:"port" toml:"port" yaml:"port" ini:"port"`
+	Timeout time.Duration `json:"timeout" toml:"timeout" yaml:"timeout" ini:"timeout"`
+}
+
+type formatConfig struct {
+	Name     string         `json:"name" toml:"name" yaml:"name" ini:"name"`
+	Debug    bool           `json:"debug" toml:"debug" yaml:"debug" ini:"debug"`
+	Tags     []string       `json:"tags" toml:"tags" yaml:"tags" ini:"tags"`
+	Database formatDatabase `json:"database" toml:"database" yaml:"database" ini:"database"`
+}
+
+func TestIniCodec(t *testing.T) {
+	data := []byte(`
+; comment
+name = "my app"
+debug = true
+tags = a, b
+
+[database]
+host = localhost
+port = 5432
+timeout = 3s
+`)
+	var cfg formatConfig
+	if err := IniCodec.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := formatConfig{
+		Name:     "my app",
+		Debug:    true,
+		Tags:     []string{"a", "b"},
+		Database: formatDatabase{Host: "localhost", Port: 5432, Timeout: 3 * time.Second},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+
+	out, err := IniCodec.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "[database]\nhost = localhost\n") {
+		t.Fatalf("unexpected ini output:\n%s", out)
+	}
+	var back formatConfig
+	if err := IniCodec.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, want) {
+		t.Fatalf("round trip: got %+v, want %+v", back, want)
+	}
+
+	if err := IniCodec.Unmarshal([]byte("[broken"), &cfg); err == nil {
+		t.Fatal("expected an error for an invalid section header")
+	}
+}
+
+func TestInitConfigAuto(t *testing.T) {
+	for _, ext := range []string{".json", ".toml", ".yaml", ".ini"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config"+ext)
+			// the default file is created on first load
+			cfg, err := InitConfigAuto[formatConfig](path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Name != "" || cfg.Database.Port != 0 {
+				t.Fatalf("expected default instance, got %+v", cfg)
+			}
+
+			c, err := NewConfigWrapper[*formatConfig](path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Config.Name = "saved"
+			c.Config.Database.Port = 8080
+			if err := c.Save(); err != nil {
+				t.Fatal(err)
+			}
+			codec, _ := CodecForFile(path)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved formatConfig
+			if err := codec.Unmarshal(data, &saved); err != nil {
+				t.Fatalf("saved file is not %s: %v\n%s", codec.Name, err, data)
+			}
+			if saved.Name != "saved" || saved.Database.Port != 8080 {
+				t.Fatalf("unexpected saved config %+v", saved)
+			}
+		})
+	}
+
+	if _, err := InitConfigAuto[formatConfig]("config.xml", nil); err == nil {
+		t.Fatal("expected an error for an unsupported format")
+	}
+}
+
+func TestLoadLayered_Yaml(t *testing.T) {
+	type cfg struct {
+		Name string `yaml:"name" default:"x"`
+		Port int    `yaml:"port" default:"80"`
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.yaml")
+	if err := os.WriteFile(path, []byte("name: base\nport: 81\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.local.dev.yaml"), []byte("port: 82\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, sources, err := LoadLayered[cfg](LayeredOptions{FilePath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "base" || c.Port != 82 {
+		t.Fatalf("unexpected config %+v", c)
+	}
+	if sources.Of("Port") != LayerDevFile || sources.Of("Name") != LayerFile {
+		t.Fatalf("unexpected sources %v", sources)
+	}
+}
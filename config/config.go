@@ -1,31 +1,88 @@
 package config
 
 import (
-	"os"
-	"reflect"
-
 	"github.com/doraemonkeys/doraemon"
 	"github.com/joho/godotenv"
-	toml "github.com/pelletier/go-toml/v2"
 )
 
+// InitJsonConfig loads a JSON configuration like doraemon.InitJsonConfig
+// and validates it, see Validate. The default file is written by WriteDefaultConfig.
 func InitJsonConfig[T any](configFile string, createDefault func(path string) error) (*T, error) {
-	return doraemon.InitJsonConfig[T](configFile, createDefault)
+	return initConfigWithCodec[T](configFile, createDefault, JsonCodec)
 }
 
+// InitTomlConfig initializes a TOML configuration object of type T from a file,
+// creating a default file (see WriteDefaultConfig) if it doesn't exist, and validates it, see Validate.
 func InitTomlConfig[T any](configFile string, createDefault func(path string) error) (*T, error) {
-	var config T
+	return initConfigWithCodec[T](configFile, createDefault, TomlCodec)
+}
+
+// InitYamlConfig initializes a YAML configuration object of type T from a file,
+// creating a default file (see WriteDefaultConfig) if it doesn't exist, and validates it, see Validate.
+func InitYamlConfig[T any](configFile string, createDefault func(path string) error) (*T, error) {
+	return initConfigWithCodec[T](configFile, createDefault, YamlCodec)
+}
+
+// InitIniConfig initializes an INI configuration object of type T from a file,
+// creating a default file (see WriteDefaultConfig) if it doesn't exist, and validates it, see Validate and IniCodec.
+func InitIniConfig[T any](configFile string, createDefault func(path string) error) (*T, error) {
+	return initConfigWithCodec[T](configFile, createDefault, IniCodec)
+}
 
+// InitConfigAuto initializes a configuration object of type T from a file whose format
+// is chosen by the extension: .json, .toml, .yaml/.yml or .ini.
+func InitConfigAuto[T any](configFile string, createDefault func(path string) error) (*T, error) {
+	codec, err := CodecForFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return initConfigWithCodec[T](configFile, createDefault, codec)
+}
+
+func initConfigWithCodec[T any](configFile string, createDefault func(path string) error, codec Codec) (*T, error) {
 	if createDefault == nil {
 		createDefault = func(path string) error {
-			c, err := toml.Marshal(doraemon.DeepCreateEmptyInstance(reflect.TypeOf(config)))
-			if err != nil {
-				return err
-			}
-			return os.WriteFile(path, c, 0666)
+			return writeDefaultConfig[T](path, codec)
 		}
 	}
-	return doraemon.InitConfig[T](configFile, createDefault, toml.Unmarshal)
+	return validated(resolveSecrets(doraemon.InitConfig[T](configFile, createDefault, codec.Unmarshal)))
+}
+
+// NewConfigWrapper creates a doraemon.ConfigWrapper that loads and saves the configuration
+// file in the format chosen by its extension, see CodecForFile. If DefaultSecretResolver is
+// set, secret references are resolved by it and written back instead of the secrets on save.
+func NewConfigWrapper[T comparable](configFile string) (*doraemon.ConfigWrapper[T], error) {
+	return NewConfigWrapperWithSecrets[T](configFile, DefaultSecretResolver)
+}
+
+// NewConfigWrapperWithSecrets is like NewConfigWrapper with the secret references resolved by
+// resolver, they are not resolved if it is nil.
+func NewConfigWrapperWithSecrets[T comparable](configFile string, resolver *SecretResolver) (*doraemon.ConfigWrapper[T], error) {
+	codec, err := CodecForFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	c, err := doraemon.NewConfigWrapperWithCodec[T](configFile, codec.Unmarshal, codec.Marshal)
+	if err != nil {
+		return nil, err
+	}
+	if resolver != nil {
+		c.SetCodecHooks(secretHooks[T](resolver))
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func validated[T any](config *T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := Validate(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // LoadEnv loads environment variables from the given files, if they exist.
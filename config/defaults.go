@@ -0,0 +1,332 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/doraemonkeys/doraemon"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// DefaultInstance creates an instance of T like doraemon.DeepCreateEmptyInstance,
+// with the `default:"..."` struct tags applied.
+func DefaultInstance[T any]() (*T, error) {
+	var config T
+	v, err := defaultValue(reflect.TypeOf(config))
+	if err != nil {
+		return nil, err
+	}
+	config = v.Interface().(T)
+	return &config, nil
+}
+
+func defaultValue(t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	v.Set(reflect.ValueOf(doraemon.DeepCreateEmptyInstance(t)))
+	return v, fillDefaults(v, "")
+}
+
+// fillDefaults applies the default tags to v, including the structs in slices and maps.
+func fillDefaults(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			return fillDefaults(v.Elem(), path)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fieldPath := joinPath(path, sf.Name)
+			if def, ok := sf.Tag.Lookup("default"); ok {
+				if err := setFromString(v.Field(i), def); err != nil {
+					return fmt.Errorf("invalid default value of %s: %w", fieldPath, err)
+				}
+				continue
+			}
+			if err := fillDefaults(v.Field(i), fieldPath); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if err := fillDefaults(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := fillDefaults(elem, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+	return nil
+}
+
+// WriteDefaultConfig writes a default configuration file of type T, the format is chosen
+// by the extension of path. The values of `default:"..."` tags are filled in, and the
+// `comment:"..."` tags are written above each key in TOML, YAML and INI files.
+//
+// JSON has no comments, so if T has comment tags a companion JSONC file with the same
+// content and the comments is written next to it ("config.json" -> "config.jsonc").
+func WriteDefaultConfig[T any](path string) error {
+	codec, err := CodecForFile(path)
+	if err != nil {
+		return err
+	}
+	return writeDefaultConfig[T](path, codec)
+}
+
+func writeDefaultConfig[T any](path string, codec Codec) error {
+	var zero T
+	v, err := defaultValue(reflect.TypeOf(zero))
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	switch codec.Name {
+	case YamlCodec.Name:
+		data, err = marshalYamlWithComments(v)
+	default:
+		// go-toml and the INI codec write the comment tags themselves
+		data, err = codec.Marshal(v.Interface())
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		return err
+	}
+
+	if codec.Name == JsonCodec.Name && hasCommentTag(v.Type(), make(map[reflect.Type]bool)) {
+		jsonc := strings.TrimSuffix(path, filepath.Ext(path)) + ".jsonc"
+		return os.WriteFile(jsonc, marshalJsonc(v), 0666)
+	}
+	return nil
+}
+
+func hasCommentTag(t reflect.Type, seen map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if sf.Tag.Get("comment") != "" || hasCommentTag(sf.Type, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentLines splits a comment tag into lines, "\n" may be written literally in the tag.
+func commentLines(comment string) []string {
+	if comment == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(comment, `\n`, "\n"), "\n")
+}
+
+// taggedField is an exported struct field with its key name in a format,
+// fields of embedded structs are inlined.
+type taggedField struct {
+	key   string
+	index []int
+	sf    reflect.StructField
+}
+
+func taggedFields(t reflect.Type, tagName string) []taggedField {
+	var fields []taggedField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key, ok := fieldKey(sf, tagName)
+		if !ok {
+			continue
+		}
+		tag := sf.Tag.Get(tagName)
+		inline := strings.Contains(tag, ",inline") || (sf.Anonymous && tag == "")
+		if inline && sf.Type.Kind() == reflect.Struct {
+			for _, f := range taggedFields(sf.Type, tagName) {
+				f.index = append([]int{i}, f.index...)
+				fields = append(fields, f)
+			}
+			continue
+		}
+		fields = append(fields, taggedField{key: key, index: []int{i}, sf: sf})
+	}
+	return fields
+}
+
+func marshalYamlWithComments(v reflect.Value) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(v.Interface()); err != nil {
+		return nil, err
+	}
+	addYamlComments(&node, v.Type())
+	return yaml.Marshal(&node)
+}
+
+func addYamlComments(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			addYamlComments(n, t)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, n := range node.Content {
+				addYamlComments(n, t.Elem())
+			}
+		}
+	case yaml.MappingNode:
+		if t.Kind() == reflect.Map {
+			for i := 1; i < len(node.Content); i += 2 {
+				addYamlComments(node.Content[i], t.Elem())
+			}
+			return
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := taggedFields(t, YamlCodec.TagName)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			for _, f := range fields {
+				if !strings.EqualFold(f.key, key) {
+					continue
+				}
+				if lines := commentLines(f.sf.Tag.Get("comment")); lines != nil {
+					node.Content[i].HeadComment = strings.Join(lines, "\n")
+				}
+				addYamlComments(node.Content[i+1], f.sf.Type)
+				break
+			}
+		}
+	}
+}
+
+// marshalJsonc encodes v as indented JSON with the comment tags written as "//" comments.
+func marshalJsonc(v reflect.Value) []byte {
+	var buf bytes.Buffer
+	writeJsonc(&buf, v, 0)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func writeJsonc(buf *bytes.Buffer, v reflect.Value, depth int) {
+	const indent = "    "
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Type().Implements(jsonMarshalerType) || v.Type().Implements(textMarshalerType) ||
+		reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) {
+		writeJsonLeaf(buf, v)
+		return
+	}
+
+	pad := strings.Repeat(indent, depth+1)
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := taggedFields(v.Type(), JsonCodec.TagName)
+		if len(fields) == 0 {
+			buf.WriteString("{}")
+			return
+		}
+		buf.WriteString("{\n")
+		for i, f := range fields {
+			for _, line := range commentLines(f.sf.Tag.Get("comment")) {
+				buf.WriteString(pad + "// " + line + "\n")
+			}
+			key, _ := json.Marshal(f.key)
+			buf.WriteString(pad)
+			buf.Write(key)
+			buf.WriteString(": ")
+			writeJsonc(buf, v.FieldByIndex(f.index), depth+1)
+			if i < len(fields)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Repeat(indent, depth) + "}")
+	case reflect.Map:
+		if v.Len() == 0 {
+			writeJsonLeaf(buf, v)
+			return
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		buf.WriteString("{\n")
+		for i, k := range keys {
+			key, _ := json.Marshal(fmt.Sprint(k.Interface()))
+			buf.WriteString(pad)
+			buf.Write(key)
+			buf.WriteString(": ")
+			writeJsonc(buf, v.MapIndex(k), depth+1)
+			if i < len(keys)-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Repeat(indent, depth) + "}")
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 || v.Type().Elem().Kind() == reflect.Uint8 {
+			writeJsonLeaf(buf, v)
+			return
+		}
+		buf.WriteString("[\n")
+		for i := range v.Len() {
+			buf.WriteString(pad)
+			writeJsonc(buf, v.Index(i), depth+1)
+			if i < v.Len()-1 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Repeat(indent, depth) + "]")
+	default:
+		writeJsonLeaf(buf, v)
+	}
+}
+
+func writeJsonLeaf(buf *bytes.Buffer, v reflect.Value) {
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		buf.WriteString("null")
+		return
+	}
+	buf.Write(data)
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type defaultsServer struct {
+	Host string `json:"host" toml:"host" yaml:"host" ini:"host" default:"localhost" comment:"server host"`
+	Port int    `json:"port" toml:"port" yaml:"port" ini:"port" default:"8080" comment:"listen port\nmust be > 0"`
+}
+
+type defaultsConfig struct {
+	Name    string           `json:"name" toml:"name" yaml:"name" ini:"name" default:"app" comment:"application name"`
+	Timeout time.Duration    `json:"timeout" toml:"timeout" yaml:"timeout" ini:"timeout" default:"3s"`
+	Server  defaultsServer   `json:"server" toml:"server" yaml:"server" ini:"server" comment:"http server"`
+	Backups []defaultsServer `json:"backups" toml:"backups" yaml:"backups" ini:"-"`
+}
+
+func TestDefaultInstance(t *testing.T) {
+	cfg, err := DefaultInstance[defaultsConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "app" || cfg.Timeout != 3*time.Second || cfg.Server.Port != 8080 {
+		t.Fatalf("defaults not applied: %+v", cfg)
+	}
+	if len(cfg.Backups) != 1 || cfg.Backups[0].Host != "localhost" {
+		t.Fatalf("defaults not applied to slice elements: %+v", cfg.Backups)
+	}
+}
+
+func TestWriteDefaultConfig(t *testing.T) {
+	dir := t.TempDir()
+	wantComments := map[string][]string{
+		".toml": {"# application name\nname = 'app'", "# listen port\n# must be > 0\nport = 8080"},
+		".yaml": {"# application name\nname: app", "# listen port\n    # must be > 0\n    port: 8080"},
+		".ini":  {"; application name\nname = app", "[server]\n; server host\nhost = localhost"},
+	}
+	for ext, wants := range wantComments {
+		path := filepath.Join(dir, "config"+ext)
+		if err := WriteDefaultConfig[defaultsConfig](path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: missing %q in\n%s", ext, want, data)
+			}
+		}
+		cfg, err := InitConfigAuto[defaultsConfig](path, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", ext, err)
+		}
+		if cfg.Name != "app" || cfg.Server.Port != 8080 || cfg.Timeout != 3*time.Second {
+			t.Errorf("%s: unexpected config %+v", ext, cfg)
+		}
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if _, err := InitJsonConfig[defaultsConfig](path, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg defaultsConfig
+	if err := json.Unmarshal(data, &cfg); err != nil || cfg.Server.Host != "localhost" {
+		t.Fatalf("unexpected json default file: %v\n%s", err, data)
+	}
+	jsonc, err := os.ReadFile(filepath.Join(dir, "config.jsonc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`// application name`, `"name": "app"`, "        // listen port\n        // must be > 0\n        \"port\": 8080"} {
+		if !strings.Contains(string(jsonc), want) {
+			t.Errorf("jsonc: missing %q in\n%s", want, jsonc)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// field is a leaf field of a configuration struct.
+type field struct {
+	// Path is the Go field path, e.g. "Database.Host".
+	Path string
+	// Keys is the key path in the configuration file, e.g. ["database", "host"].
+	Keys   []string
+	Value  reflect.Value
+	Struct reflect.StructField
+}
+
+// isLeafType reports whether values of type t are set as a whole instead of field by field.
+func isLeafType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+	return reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// fieldKey returns the key name of f in a file format using tagName,
+// and false if the field is ignored by the format.
+func fieldKey(f reflect.StructField, tagName string) (string, bool) {
+	tag := f.Tag.Get(tagName)
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// walkFields calls fn for each exported leaf field of the struct v, descending into
+// nested structs. Nil struct pointers are allocated for the walk and only kept if fn
+// reports that it changed one of their fields.
+func walkFields(v reflect.Value, tagName string, fn func(f field) (changed bool, err error)) error {
+	_, err := walkStruct(v, tagName, "", nil, fn)
+	return err
+}
+
+func walkStruct(v reflect.Value, tagName, pathPrefix string, keyPrefix []string,
+	fn func(f field) (bool, error)) (bool, error) {
+	t := v.Type()
+	changed := false
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key, ok := fieldKey(sf, tagName)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+
+		path := joinPath(pathPrefix, sf.Name)
+		keys := append(keyPrefix[:len(keyPrefix):len(keyPrefix)], key)
+		// embedded structs without an explicit key are inlined, like encoding/json does
+		if sf.Anonymous && sf.Tag.Get(tagName) == "" && sf.Type.Kind() == reflect.Struct {
+			path = pathPrefix
+			keys = keyPrefix
+		}
+
+		if isLeafType(sf.Type) {
+			c, err := fn(field{Path: path, Keys: keys, Value: fv, Struct: sf})
+			if err != nil {
+				return changed, err
+			}
+			changed = changed || c
+			continue
+		}
+
+		if fv.Kind() == reflect.Pointer {
+			target := fv
+			if fv.IsNil() {
+				target = reflect.New(sf.Type.Elem())
+			}
+			c, err := walkStruct(target.Elem(), tagName, path, keys, fn)
+			if err != nil {
+				return changed, err
+			}
+			if c && fv.IsNil() {
+				fv.Set(target)
+			}
+			changed = changed || c
+			continue
+		}
+
+		c, err := walkStruct(fv, tagName, path, keys, fn)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// lookupKeys looks up a key path in a decoded configuration tree.
+// Keys are matched exactly first, then case-insensitively.
+func lookupKeys(tree map[string]any, keys []string) (any, bool) {
+	var cur any = tree
+	for _, key := range keys {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok := m[key]
+		if !ok {
+			for k, vv := range m {
+				if strings.EqualFold(k, key) {
+					v, ok = vv, true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+		cur = v
+	}
+	return cur, true
+}
+
+// mergeTree deep merges src into dst. Nested tables are merged key by key,
+// other values in src replace the ones in dst.
+func mergeTree(dst, src map[string]any) {
+	for k, sv := range src {
+		if sm, ok := sv.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				mergeTree(dm, sm)
+				continue
+			}
+		}
+		dst[k] = sv
+	}
+}
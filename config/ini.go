@@ -0,0 +1,286 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IniCodec reads and writes INI files.
+//
+// Top-level fields are written before the first section, nested structs become
+// sections ("[database]"), deeper nesting uses dotted section names ("[database.pool]").
+// Slices are written as comma separated values and maps as "k1=v1,k2=v2".
+// Lines starting with ';' or '#' are comments, the `comment:"..."` struct tags are
+// written as comments above the keys.
+var IniCodec = Codec{
+	Name:      "ini",
+	TagName:   iniTagName,
+	Marshal:   marshalIni,
+	Unmarshal: unmarshalIni,
+}
+
+const iniTagName = "ini"
+
+type iniEntry struct {
+	key     string
+	value   string
+	comment []string
+}
+
+type iniSection struct {
+	name    string
+	entries []iniEntry
+}
+
+func parseIni(data []byte) (map[string]any, error) {
+	tree := make(map[string]any)
+	current := tree
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if lineNum == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("ini: line %d: invalid section header %q", lineNum, line)
+			}
+			current = tree
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name = strings.TrimSpace(name)
+				next, ok := current[name].(map[string]any)
+				if !ok {
+					next = make(map[string]any)
+					current[name] = next
+				}
+				current = next
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			key, value, ok = strings.Cut(line, ":")
+		}
+		if !ok {
+			return nil, fmt.Errorf("ini: line %d: expected key = value, got %q", lineNum, line)
+		}
+		current[strings.TrimSpace(key)] = unquoteIniValue(strings.TrimSpace(value))
+	}
+	return tree, scanner.Err()
+}
+
+func unquoteIniValue(v string) string {
+	if len(v) >= 2 && (v[0] == '"' && v[len(v)-1] == '"') {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+	}
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func quoteIniValue(v string) string {
+	if v != strings.TrimSpace(v) || strings.ContainsAny(v, "\"\n\r;#") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func unmarshalIni(data []byte, v any) error {
+	tree, err := parseIni(data)
+	if err != nil {
+		return err
+	}
+	if m, ok := v.(*map[string]any); ok {
+		*m = tree
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("ini: unmarshal target must be a non-nil pointer, got %T", v)
+	}
+	rv = rv.Elem()
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("ini: cannot unmarshal into %T", v)
+	}
+	return walkFields(rv, iniTagName, func(f field) (bool, error) {
+		raw, ok := lookupKeys(tree, f.Keys)
+		if !ok {
+			return false, nil
+		}
+		s, ok := raw.(string)
+		if !ok {
+			return false, fmt.Errorf("ini: %s is a section, not a value", strings.Join(f.Keys, "."))
+		}
+		if err := setFromString(f.Value, s); err != nil {
+			return false, fmt.Errorf("ini: invalid value of %s: %w", strings.Join(f.Keys, "."), err)
+		}
+		return true, nil
+	})
+}
+
+func marshalIni(v any) ([]byte, error) {
+	var sections []*iniSection
+	root := &iniSection{}
+	sections = append(sections, root)
+
+	if m, ok := v.(map[string]any); ok {
+		collectIniTree(m, "", root, &sections)
+	} else {
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("ini: cannot marshal %T", v)
+		}
+		// walkFields needs an addressable value
+		tmp := reflect.New(rv.Type()).Elem()
+		tmp.Set(rv)
+		byName := map[string]*iniSection{"": root}
+		err := walkFields(tmp, iniTagName, func(f field) (bool, error) {
+			if f.Value.Kind() == reflect.Pointer && f.Value.IsNil() {
+				return false, nil
+			}
+			if !iniRepresentable(f.Value.Type()) {
+				// lists and maps of structs have no INI representation
+				return false, nil
+			}
+			name := strings.Join(f.Keys[:len(f.Keys)-1], ".")
+			sec, ok := byName[name]
+			if !ok {
+				sec = &iniSection{name: name}
+				byName[name] = sec
+				sections = append(sections, sec)
+			}
+			sec.entries = append(sec.entries, iniEntry{
+				key:     f.Keys[len(f.Keys)-1],
+				value:   formatValue(f.Value),
+				comment: commentLines(f.Struct.Tag.Get("comment")),
+			})
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, sec := range sections {
+		if sec.name == "" && len(sec.entries) == 0 {
+			continue
+		}
+		if sec.name != "" {
+			if buf.Len() > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "[%s]\n", sec.name)
+		}
+		for _, e := range sec.entries {
+			for _, line := range e.comment {
+				fmt.Fprintf(&buf, "; %s\n", line)
+			}
+			fmt.Fprintf(&buf, "%s = %s\n", e.key, quoteIniValue(e.value))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func collectIniTree(m map[string]any, name string, sec *iniSection, sections *[]*iniSection) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var children []string
+	for _, k := range keys {
+		if _, ok := m[k].(map[string]any); ok {
+			children = append(children, k)
+			continue
+		}
+		sec.entries = append(sec.entries, iniEntry{key: k, value: formatValue(reflect.ValueOf(m[k]))})
+	}
+	for _, k := range children {
+		childName := k
+		if name != "" {
+			childName = name + "." + k
+		}
+		child := &iniSection{name: childName}
+		*sections = append(*sections, child)
+		collectIniTree(m[k].(map[string]any), childName, child, sections)
+	}
+}
+
+func iniRepresentable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		return isLeafType(t.Elem())
+	}
+	return true
+}
+
+// formatValue formats v so that setFromString can parse it back.
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			if err == nil {
+				return string(b)
+			}
+		}
+		return formatValue(v.Elem())
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if b, err := m.MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	if v.Type() == durationType {
+		return fmt.Sprint(v.Interface())
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(parts, ",")
+	case reflect.Map:
+		parts := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			parts = append(parts, formatValue(iter.Key())+"="+formatValue(iter.Value()))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is the subset of JSON Schema (draft 2020-12) generated by GenerateJSONSchema.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	// Default is the JSON encoding of the default value, so that false, 0 and "" are kept.
+	Default       json.RawMessage        `json:"default,omitempty"`
+	Enum          []any                  `json:"enum,omitempty"`
+	Minimum       *float64               `json:"minimum,omitempty"`
+	Maximum       *float64               `json:"maximum,omitempty"`
+	MinLength     *int                   `json:"minLength,omitempty"`
+	MaxLength     *int                   `json:"maxLength,omitempty"`
+	MinItems      *int                   `json:"minItems,omitempty"`
+	MaxItems      *int                   `json:"maxItems,omitempty"`
+	MinProperties *int                   `json:"minProperties,omitempty"`
+	MaxProperties *int                   `json:"maxProperties,omitempty"`
+	Properties    map[string]*JSONSchema `json:"properties,omitempty"`
+	Required      []string               `json:"required,omitempty"`
+	// AdditionalProperties is false for structs and the value schema for maps.
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Defs                 map[string]*JSONSchema `json:"$defs,omitempty"`
+}
+
+// durationPattern matches the strings accepted by the duration validate rule.
+const durationPattern = `^[-+]?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// GenerateJSONSchema generates a JSON Schema of the JSON encoding of T, following the json
+// struct tags. Nested structs, maps, slices and pointers are described inline, recursive
+// types are referenced through "$defs".
+//
+// The `comment:"..."` tags become descriptions, the `default:"..."` tags defaults (see
+// DefaultInstance), and the `validate:"..."` rules are translated where JSON Schema has
+// an equivalent: required, min, max, len, oneof, url and duration. Unknown keys are
+// rejected with "additionalProperties": false so that typos are reported.
+func GenerateJSONSchema[T any]() (*JSONSchema, error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil {
+		return nil, fmt.Errorf("cannot generate a schema for a nil interface type")
+	}
+	defaults, err := defaultValue(t)
+	if err != nil {
+		return nil, err
+	}
+	g := &schemaGenerator{inProgress: make(map[reflect.Type]bool), defs: make(map[string]*JSONSchema)}
+	s := g.generate(t, defaults)
+	s.Schema = jsonSchemaDraft
+	if name := t.Name(); name != "" {
+		s.Title = name
+	}
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s, nil
+}
+
+// WriteJSONSchema writes the JSON Schema of T to path, see GenerateJSONSchema.
+func WriteJSONSchema[T any](path string) error {
+	s, err := GenerateJSONSchema[T]()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0666)
+}
+
+type schemaGenerator struct {
+	inProgress map[reflect.Type]bool
+	// referenced are the struct types that are used recursively
+	referenced map[reflect.Type]bool
+	defs       map[string]*JSONSchema
+}
+
+func defName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		name = "anonymous"
+	}
+	return strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+}
+
+// generate returns the schema of t, defaults is a value of type t (or invalid) with the default tags applied.
+func (g *schemaGenerator) generate(t reflect.Type, defaults reflect.Value) *JSONSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		if defaults.IsValid() && !defaults.IsNil() {
+			defaults = defaults.Elem()
+		} else {
+			defaults = reflect.Value{}
+		}
+	}
+
+	switch {
+	case t == durationType:
+		return &JSONSchema{Type: "integer", Description: "nanoseconds"}
+	case t == reflect.TypeOf(time.Time{}):
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case reflect.PointerTo(t).Implements(jsonMarshalerType) || t.Implements(jsonMarshalerType):
+		return &JSONSchema{}
+	case reflect.PointerTo(t).Implements(textMarshalerType) || t.Implements(textMarshalerType):
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &JSONSchema{Type: "string", Description: "base64"}
+		}
+		var elemDefaults reflect.Value
+		if defaults.IsValid() && defaults.Len() > 0 {
+			elemDefaults = defaults.Index(0)
+		}
+		return &JSONSchema{Type: "array", Items: g.generate(t.Elem(), elemDefaults)}
+	case reflect.Map:
+		var elemDefaults reflect.Value
+		if defaults.IsValid() && defaults.Len() > 0 {
+			iter := defaults.MapRange()
+			if iter.Next() {
+				elemDefaults = iter.Value()
+			}
+		}
+		return &JSONSchema{Type: "object", AdditionalProperties: g.generate(t.Elem(), elemDefaults)}
+	case reflect.Struct:
+		return g.generateStruct(t, defaults)
+	default:
+		// interfaces accept any value
+		return &JSONSchema{}
+	}
+}
+
+func (g *schemaGenerator) generateStruct(t reflect.Type, defaults reflect.Value) *JSONSchema {
+	if g.inProgress[t] {
+		if g.referenced == nil {
+			g.referenced = make(map[reflect.Type]bool)
+		}
+		g.referenced[t] = true
+		return &JSONSchema{Ref: "#/$defs/" + defName(t)}
+	}
+	g.inProgress[t] = true
+	defer delete(g.inProgress, t)
+
+	s := &JSONSchema{
+		Type:                 "object",
+		Properties:           make(map[string]*JSONSchema),
+		AdditionalProperties: false,
+	}
+	for _, f := range taggedFields(t, JsonCodec.TagName) {
+		var fieldDefaults reflect.Value
+		if defaults.IsValid() {
+			fieldDefaults = defaults.FieldByIndex(f.index)
+		}
+		prop := g.generate(f.sf.Type, fieldDefaults)
+		if prop.Ref == "" {
+			if comment := f.sf.Tag.Get("comment"); comment != "" {
+				prop.Description = strings.Join(commentLines(comment), "\n")
+			}
+			if _, ok := f.sf.Tag.Lookup("default"); ok && fieldDefaults.IsValid() {
+				if data, err := json.Marshal(fieldDefaults.Interface()); err == nil {
+					prop.Default = data
+				}
+			}
+		}
+		if applySchemaRules(prop, f.sf.Type, parseRules(f.sf.Tag.Get("validate"))) {
+			s.Required = append(s.Required, f.key)
+		}
+		s.Properties[f.key] = prop
+	}
+
+	if g.referenced[t] {
+		copied := *s
+		g.defs[defName(t)] = &copied
+	}
+	return s
+}
+
+// applySchemaRules translates validate rules into schema keywords and reports whether the field is required.
+func applySchemaRules(s *JSONSchema, t reflect.Type, rules []string) (required bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "dive":
+			elem := s.Items
+			if m, ok := s.AdditionalProperties.(*JSONSchema); ok {
+				elem = m
+			}
+			if elem != nil {
+				applySchemaRules(elem, t.Elem(), rules[i+1:])
+			}
+			return required
+		case "oneof":
+			for _, option := range strings.Fields(param) {
+				s.Enum = append(s.Enum, enumValue(t, option))
+			}
+		case "url":
+			s.Format = "uri"
+		case "duration":
+			s.Pattern = durationPattern
+		case "min", "max", "len":
+			applySchemaBound(s, t, name, param)
+		}
+	}
+	return required
+}
+
+func applySchemaBound(s *JSONSchema, t reflect.Type, name, param string) {
+	if isLenKind(t.Kind()) {
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			return
+		}
+		minP, maxP := &s.MinItems, &s.MaxItems
+		switch t.Kind() {
+		case reflect.String:
+			minP, maxP = &s.MinLength, &s.MaxLength
+		case reflect.Map:
+			minP, maxP = &s.MinProperties, &s.MaxProperties
+		}
+		switch name {
+		case "min":
+			*minP = &n
+		case "max":
+			*maxP = &n
+		case "len":
+			*minP, *maxP = &n, &n
+		}
+		return
+	}
+	p := reflect.New(t).Elem()
+	if setFromString(p, param) != nil {
+		return
+	}
+	f, ok := numberOf(p)
+	if !ok {
+		return
+	}
+	switch name {
+	case "min":
+		s.Minimum = &f
+	case "max":
+		s.Maximum = &f
+	case "len":
+		s.Minimum, s.Maximum = &f, &f
+	}
+}
+
+func enumValue(t reflect.Type, option string) any {
+	p := reflect.New(t).Elem()
+	if t.Kind() != reflect.String && setFromString(p, option) == nil {
+		return p.Interface()
+	}
+	return option
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaNode struct {
+	Name     string        `json:"name" validate:"required"`
+	Children []*schemaNode `json:"children"`
+}
+
+type schemaDatabase struct {
+	Host    string        `json:"host" default:"localhost" comment:"database host"`
+	Port    int           `json:"port" default:"5432" validate:"min=1,max=65535"`
+	Timeout time.Duration `json:"timeout"`
+	TLS     bool          `json:"tls" default:"false"`
+}
+
+type schemaConfig struct {
+	Mode     string                    `json:"mode" validate:"required,oneof=dev prod"`
+	Database schemaDatabase            `json:"database"`
+	Replicas *schemaDatabase           `json:"replicas,omitempty"`
+	Peers    []string                  `json:"peers" validate:"max=2,dive,url"`
+	Limits   map[string]int            `json:"limits" validate:"max=3,dive,min=0"`
+	Backends map[string]schemaDatabase `json:"backends"`
+	Tree     schemaNode                `json:"tree"`
+	Ignored  string                    `json:"-"`
+	Extra    any                       `json:"extra"`
+}
+
+func TestGenerateJSONSchema(t *testing.T) {
+	s, err := GenerateJSONSchema[schemaConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != "object" || s.AdditionalProperties != false || s.Title != "schemaConfig" {
+		t.Fatalf("unexpected root schema %+v", s)
+	}
+	if len(s.Required) != 1 || s.Required[0] != "mode" {
+		t.Fatalf("unexpected required %v", s.Required)
+	}
+	if _, ok := s.Properties["Ignored"]; ok {
+		t.Fatal(`fields tagged json:"-" should be skipped`)
+	}
+	db := s.Properties["database"]
+	if db.Properties["host"].Description != "database host" || string(db.Properties["host"].Default) != `"localhost"` {
+		t.Fatalf("unexpected host schema %+v", db.Properties["host"])
+	}
+	if string(db.Properties["tls"].Default) != "false" {
+		t.Fatalf("a false default should be kept, got %+v", db.Properties["tls"])
+	}
+	if string(db.Properties["port"].Default) != "5432" || *db.Properties["port"].Maximum != 65535 {
+		t.Fatalf("unexpected port schema %+v", db.Properties["port"])
+	}
+	if s.Properties["replicas"].Type != "object" {
+		t.Fatal("pointers should be described by their element")
+	}
+	if s.Properties["peers"].Items.Format != "uri" || *s.Properties["peers"].MaxItems != 2 {
+		t.Fatalf("unexpected peers schema %+v", s.Properties["peers"])
+	}
+	if s.Properties["limits"].AdditionalProperties.(*JSONSchema).Minimum == nil {
+		t.Fatal("dive rules should apply to map values")
+	}
+	if limits := s.Properties["limits"]; limits.MaxProperties == nil || *limits.MaxProperties != 3 || limits.MaxItems != nil {
+		t.Fatalf("map bounds should be maxProperties, got %+v", limits)
+	}
+	children := s.Properties["tree"].Properties["children"].Items
+	if children.Ref == "" || s.Defs[strings.TrimPrefix(children.Ref, "#/$defs/")] == nil {
+		t.Fatalf("recursive types should be referenced through $defs, got %+v", children)
+	}
+
+	// the schema is valid JSON
+	if _, err := json.Marshal(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	s, err := GenerateJSONSchema[schemaConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := `{
+	"mode": "prod",
+	"database": {"host": "db", "port": 5432, "timeout": 1000},
+	"peers": ["http://a"],
+	"limits": {"a": 1},
+	"tree": {"name": "root", "children": [{"name": "leaf", "children": null}]},
+	"extra": [1, "x"]
+}`
+	if err := ValidateJSONSchema([]byte(valid), s); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := `{
+	"mode": "test",
+	"database": {
+		"host": 1,
+		"port": 70000,
+		"prot": 1
+	},
+	"peers": ["http://a", "nope", "http://c"],
+	"limits": {"a": -1},
+	"tree": {"children": [{"name": "leaf"}]}
+}`
+	err = ValidateJSONSchema([]byte(invalid), s)
+	var errs SchemaErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected SchemaErrors, got %v", err)
+	}
+	want := map[string][2]int{
+		"/mode":          {2, 10},
+		"/database/host": {4, 11},
+		"/database/port": {5, 11},
+		"/database/prot": {6, 11},
+		"/peers":         {8, 11},
+		"/peers/1":       {8, 24},
+		"/limits/a":      {9, 18},
+		"/tree":          {10, 10},
+	}
+	got := make(map[string][2]int)
+	for _, e := range errs {
+		got[e.Path] = [2]int{e.Line, e.Column}
+	}
+	for path, pos := range want {
+		if got[path] != pos {
+			t.Errorf("%s: got position %v, want %v (errors: %v)", path, got[path], pos, errs)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("got %d errors, want %d: %v", len(errs), len(want), errs)
+	}
+
+	err = ValidateJSONSchema([]byte(`{"mode": "dev", "limits": {"a": 1, "b": 2, "c": 3, "d": 4}}`), s)
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "/limits" {
+		t.Fatalf("expected a maxProperties error for /limits, got %v", err)
+	}
+
+	err = ValidateJSONSchema([]byte("{\n\"mode\": }"), s)
+	if !errors.As(err, &errs) || errs[0].Line != 2 {
+		t.Fatalf("expected a syntax error on line 2, got %v", err)
+	}
+}
+
+func TestValidateJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"mode": "dev", "unknown": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateJSONFile[schemaConfig](path); err == nil || !strings.Contains(err.Error(), `unknown property "unknown"`) {
+		t.Fatalf("expected an unknown property error, got %v", err)
+	}
+}
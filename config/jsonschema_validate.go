@@ -0,0 +1,383 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// SchemaError is a violation of a JSON Schema found in a JSON document.
+type SchemaError struct {
+	// Path is the JSON pointer of the invalid value, e.g. "/database/port".
+	Path string
+	// Line and Column (1-based, in bytes) locate the invalid value in the document.
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", e.Line, e.Column, path, e.Message)
+}
+
+// SchemaErrors lists every violation found by ValidateJSONSchema.
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	var sb strings.Builder
+	sb.WriteString("config does not match schema:")
+	for _, se := range e {
+		sb.WriteString("\n  - ")
+		sb.WriteString(se.Error())
+	}
+	return sb.String()
+}
+
+// jsonNode is a decoded JSON value with its position in the document.
+type jsonNode struct {
+	offset int64
+	// value is nil, bool, json.Number, string, []*jsonNode or *jsonObject
+	value any
+}
+
+type jsonObject struct {
+	keys   []string
+	values map[string]*jsonNode
+}
+
+// ValidateJSONSchema checks the JSON document data against schema and returns
+// SchemaErrors with the line and column of every invalid value, or nil.
+// A syntax error in data is returned as a single SchemaError.
+func ValidateJSONSchema(data []byte, schema *JSONSchema) error {
+	root, err := parseJSONNodes(data)
+	if err != nil {
+		var syntaxErr *json.SyntaxError
+		offset := int64(len(data))
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		}
+		line, col := lineColumn(data, offset)
+		return SchemaErrors{{Line: line, Column: col, Message: err.Error()}}
+	}
+	v := &schemaValidator{data: data, root: schema}
+	v.validate(root, schema, "")
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// ValidateJSONFile checks a JSON configuration file against the schema of T
+// (see GenerateJSONSchema) before it is unmarshalled.
+func ValidateJSONFile[T any](path string) error {
+	schema, err := GenerateJSONSchema[T]()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := ValidateJSONSchema(data, schema); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func parseJSONNodes(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := parseJSONNode(dec, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &json.SyntaxError{Offset: dec.InputOffset()}
+	}
+	return node, nil
+}
+
+// tokenStart returns the offset of the token that follows offset.
+func tokenStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+func parseJSONNode(dec *json.Decoder, data []byte) (*jsonNode, error) {
+	offset := tokenStart(data, dec.InputOffset())
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	node := &jsonNode{offset: offset}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			obj := &jsonObject{values: make(map[string]*jsonNode)}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key, ok := keyTok.(string)
+				if !ok {
+					return nil, &json.SyntaxError{Offset: dec.InputOffset()}
+				}
+				value, err := parseJSONNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+				if _, dup := obj.values[key]; !dup {
+					obj.keys = append(obj.keys, key)
+				}
+				obj.values[key] = value
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			node.value = obj
+		case '[':
+			var items []*jsonNode
+			for dec.More() {
+				item, err := parseJSONNode(dec, data)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			if items == nil {
+				items = []*jsonNode{}
+			}
+			node.value = items
+		default:
+			return nil, &json.SyntaxError{Offset: offset}
+		}
+	default:
+		node.value = tok
+	}
+	return node, nil
+}
+
+func lineColumn(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - (bytes.LastIndexByte(before, '\n') + 1) + 1
+	return line, col
+}
+
+type schemaValidator struct {
+	data []byte
+	root *JSONSchema
+	errs SchemaErrors
+}
+
+func (v *schemaValidator) fail(node *jsonNode, path string, format string, args ...any) {
+	line, col := lineColumn(v.data, node.offset)
+	v.errs = append(v.errs, SchemaError{Path: path, Line: line, Column: col, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *schemaValidator) resolve(s *JSONSchema) *JSONSchema {
+	for i := 0; s != nil && s.Ref != "" && i < 32; i++ {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		if !ok || v.root.Defs[name] == nil {
+			return nil
+		}
+		s = v.root.Defs[name]
+	}
+	return s
+}
+
+func jsonTypeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := value.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []*jsonNode:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func (v *schemaValidator) validate(node *jsonNode, s *JSONSchema, path string) {
+	s = v.resolve(s)
+	if s == nil {
+		return
+	}
+	actual := jsonTypeOf(node.value)
+	if s.Type != "" && s.Type != actual && !(s.Type == "number" && actual == "integer") {
+		// null is accepted for every type, it leaves the Go value untouched
+		if actual != "null" {
+			v.fail(node, path, "expected %s, got %s", s.Type, actual)
+		}
+		return
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if fmt.Sprint(option) == fmt.Sprint(node.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(node, path, "must be one of %v, got %v", s.Enum, node.value)
+		}
+	}
+
+	switch value := node.value.(type) {
+	case json.Number:
+		f, _ := value.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			v.fail(node, path, "must be at least %v, got %v", *s.Minimum, value)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.fail(node, path, "must be at most %v, got %v", *s.Maximum, value)
+		}
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.MinLength != nil && n < *s.MinLength {
+			v.fail(node, path, "length must be at least %d", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			v.fail(node, path, "length must be at most %d", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(value) {
+				v.fail(node, path, "must match pattern %s, got %q", s.Pattern, value)
+			}
+		}
+		if s.Format == "uri" {
+			if u, err := url.Parse(value); err != nil || u.Scheme == "" {
+				v.fail(node, path, "must be an absolute URI, got %q", value)
+			}
+		}
+	case []*jsonNode:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			v.fail(node, path, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			v.fail(node, path, "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(item, s.Items, fmt.Sprintf("%s/%d", path, i))
+			}
+		}
+	case *jsonObject:
+		v.validateObject(node, value, s, path)
+	}
+}
+
+func (v *schemaValidator) validateObject(node *jsonNode, obj *jsonObject, s *JSONSchema, path string) {
+	if s.MinProperties != nil && len(obj.keys) < *s.MinProperties {
+		v.fail(node, path, "must have at least %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(obj.keys) > *s.MaxProperties {
+		v.fail(node, path, "must have at most %d properties", *s.MaxProperties)
+	}
+	for _, name := range s.Required {
+		if _, ok := lookupProperty(obj, name); !ok {
+			v.fail(node, path, "missing required property %q", name)
+		}
+	}
+	for _, key := range obj.keys {
+		child := obj.values[key]
+		childPath := path + "/" + escapeJSONPointer(key)
+		if prop, ok := lookupSchemaProperty(s.Properties, key); ok {
+			v.validate(child, prop, childPath)
+			continue
+		}
+		switch additional := s.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				v.fail(child, childPath, "unknown property %q%s", key, suggestProperty(s.Properties, key))
+			}
+		case *JSONSchema:
+			v.validate(child, additional, childPath)
+		}
+	}
+}
+
+// lookupSchemaProperty finds the schema of a key, case-insensitively like encoding/json.
+func lookupSchemaProperty(props map[string]*JSONSchema, key string) (*JSONSchema, bool) {
+	if p, ok := props[key]; ok {
+		return p, true
+	}
+	for name, p := range props {
+		if strings.EqualFold(name, key) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func lookupProperty(obj *jsonObject, name string) (*jsonNode, bool) {
+	if n, ok := obj.values[name]; ok {
+		return n, true
+	}
+	for _, key := range obj.keys {
+		if strings.EqualFold(key, name) {
+			return obj.values[key], true
+		}
+	}
+	return nil, false
+}
+
+func suggestProperty(props map[string]*JSONSchema, key string) string {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return ""
+	}
+	return ", expected one of [" + strings.Join(names, " ") + "]"
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// Layer is a configuration source of LoadLayered.
+type Layer int
+
+const (
+	// LayerNone means that no layer supplied the field, it keeps its zero value.
+	LayerNone Layer = iota
+	// LayerDefault is the `default:"..."` struct tag.
+	LayerDefault
+	// LayerFile is the base configuration file.
+	LayerFile
+	// LayerDevFile is the ".local.dev" override of the base configuration file.
+	LayerDevFile
+	// LayerEnv is an environment variable named by the `env:"..."` struct tag.
+	LayerEnv
+	// LayerFlag is a command-line flag named by the `flag:"..."` struct tag.
+	LayerFlag
+)
+
+func (l Layer) String() string {
+	switch l {
+	case LayerDefault:
+		return "default"
+	case LayerFile:
+		return "file"
+	case LayerDevFile:
+		return "dev file"
+	case LayerEnv:
+		return "env"
+	case LayerFlag:
+		return "flag"
+	default:
+		return "none"
+	}
+}
+
+// Sources maps the Go path of each field (e.g. "Database.Host") to the layer that supplied it.
+// Fields that no layer supplied are absent.
+type Sources map[string]Layer
+
+// Of returns the layer that supplied the field at path.
+func (s Sources) Of(path string) Layer {
+	return s[path]
+}
+
+type LayeredOptions struct {
+	// FilePath is the base configuration file, it is skipped if it does not exist.
+	// The dev override file is derived from it, see doraemon.DevConfigPath.
+	FilePath string
+	// Codec decodes the configuration files, by default it is chosen by the extension of FilePath.
+	Codec *Codec
+	// EnvPrefix is prepended to the names in `env:"..."` tags, e.g. "APP_".
+	EnvPrefix string
+	// FlagSet receives a flag for each field with a `flag:"..."` tag, the usage is
+	// taken from the `usage:"..."` tag. If nil, the flag layer is skipped.
+	FlagSet *flag.FlagSet
+	// Args are the command-line arguments parsed by FlagSet, os.Args[1:] if nil.
+	Args []string
+	// Secrets resolves the secret references in the merged configuration,
+	// DefaultSecretResolver if nil. They are not resolved if both are nil.
+	Secrets *SecretResolver
+}
+
+// LoadLayered loads a configuration of type T by merging, from lowest to highest priority:
+//
+//  1. struct tag defaults, `default:"..."`
+//  2. the base configuration file
+//  3. the ".local.dev" override file, deep merged into the base file
+//  4. environment variables, `env:"..."` with LayeredOptions.EnvPrefix
+//  5. command-line flags, `flag:"..."`
+//
+// Slices are given as comma separated values in tags, environment variables and flags,
+// maps as "k1=v1,k2=v2". The returned Sources reports which layer supplied each field.
+// Secret references are resolved in the merged configuration, see SecretResolver,
+// and then it is checked with Validate.
+func LoadLayered[T any](opts LayeredOptions) (*T, Sources, error) {
+	var config T
+	v := reflect.ValueOf(&config).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("config type must be a struct, got %s", v.Type())
+	}
+	sources := make(Sources)
+
+	codec := JsonCodec
+	if opts.Codec != nil {
+		codec = *opts.Codec
+	} else if opts.FilePath != "" {
+		c, err := CodecForFile(opts.FilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		codec = c
+	}
+
+	if err := applyDefaults(v, sources); err != nil {
+		return nil, nil, err
+	}
+	if opts.FilePath != "" {
+		if err := applyFiles(v, opts.FilePath, codec, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := applyEnv(v, opts.EnvPrefix, sources); err != nil {
+		return nil, nil, err
+	}
+	if opts.FlagSet != nil {
+		args := opts.Args
+		if args == nil {
+			args = os.Args[1:]
+		}
+		if err := applyFlags(v, opts.FlagSet, args, sources); err != nil {
+			return nil, nil, err
+		}
+	}
+	resolver := opts.Secrets
+	if resolver == nil {
+		resolver = DefaultSecretResolver
+	}
+	if resolver != nil {
+		if _, err := resolver.Resolve(&config); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := Validate(&config); err != nil {
+		return nil, nil, err
+	}
+	return &config, sources, nil
+}
+
+func applyDefaults(v reflect.Value, sources Sources) error {
+	return walkFields(v, "", func(f field) (bool, error) {
+		def, ok := f.Struct.Tag.Lookup("default")
+		if !ok {
+			return false, nil
+		}
+		if err := setFromString(f.Value, def); err != nil {
+			return false, fmt.Errorf("invalid default value of %s: %w", f.Path, err)
+		}
+		sources[f.Path] = LayerDefault
+		return true, nil
+	})
+}
+
+func readTree(path string, codec Codec) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tree := make(map[string]any)
+	unmarshal := codec.Unmarshal
+	if codec.Name == JsonCodec.Name {
+		// the tree is marshalled again, a float64 would round the integers above 2^53
+		unmarshal = unmarshalJSONNumbers
+	}
+	if err := unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return tree, nil
+}
+
+// unmarshalJSONNumbers is json.Unmarshal with the numbers decoded as json.Number.
+func unmarshalJSONNumbers(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value at offset %d", dec.InputOffset())
+	}
+	return nil
+}
+
+func applyFiles(v reflect.Value, filePath string, codec Codec, sources Sources) error {
+	base, err := readTree(filePath, codec)
+	if err != nil {
+		return err
+	}
+	dev, err := readTree(doraemon.DevConfigPath(filePath), codec)
+	if err != nil {
+		return err
+	}
+	if base == nil && dev == nil {
+		return nil
+	}
+
+	merged := make(map[string]any)
+	mergeTree(merged, base)
+	mergeTree(merged, dev)
+	data, err := codec.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	// Fields that are absent from the files keep their defaults.
+	if err := codec.Unmarshal(data, v.Addr().Interface()); err != nil {
+		return err
+	}
+
+	return walkFields(v, codec.TagName, func(f field) (bool, error) {
+		if _, ok := lookupKeys(dev, f.Keys); ok {
+			sources[f.Path] = LayerDevFile
+		} else if _, ok := lookupKeys(base, f.Keys); ok {
+			sources[f.Path] = LayerFile
+		}
+		return false, nil
+	})
+}
+
+func applyEnv(v reflect.Value, prefix string, sources Sources) error {
+	return walkFields(v, "", func(f field) (bool, error) {
+		name, ok := f.Struct.Tag.Lookup("env")
+		if !ok || name == "" || name == "-" {
+			return false, nil
+		}
+		value, ok := os.LookupEnv(prefix + name)
+		if !ok {
+			return false, nil
+		}
+		if err := setFromString(f.Value, value); err != nil {
+			return false, fmt.Errorf("invalid value of environment variable %s for %s: %w", prefix+name, f.Path, err)
+		}
+		sources[f.Path] = LayerEnv
+		return true, nil
+	})
+}
+
+func applyFlags(v reflect.Value, fs *flag.FlagSet, args []string, sources Sources) error {
+	err := walkFields(v, "", func(f field) (bool, error) {
+		name, ok := f.Struct.Tag.Lookup("flag")
+		if !ok || name == "" || name == "-" {
+			return false, nil
+		}
+		usage := f.Struct.Tag.Get("usage")
+		if usage == "" {
+			usage = f.Path
+		}
+		target, path := f.Value, f.Path
+		set := func(s string) error {
+			if err := setFromString(target, s); err != nil {
+				return err
+			}
+			sources[path] = LayerFlag
+			return nil
+		}
+		if f.Value.Kind() == reflect.Bool {
+			fs.BoolFunc(name, usage, set)
+		} else {
+			fs.Func(name, usage, set)
+		}
+		// Values set by flags on nil struct pointers are lost, allocate them eagerly.
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return fs.Parse(args)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type layeredDatabase struct {
+	Host     string        `json:"host" default:"localhost" env:"DB_HOST"`
+	Port     int           `json:"port" default:"5432" flag:"db-port"`
+	Timeout  time.Duration `json:"timeout" default:"5s"`
+	Replicas []string      `json:"replicas" env:"DB_REPLICAS"`
+}
+
+type layeredConfig struct {
+	Name     string            `json:"name" default:"app"`
+	Debug    bool              `json:"debug" flag:"debug"`
+	Database layeredDatabase   `json:"database"`
+	Labels   map[string]string `json:"labels"`
+	Cache    *struct {
+		Size int `json:"size" default:"128"`
+	} `json:"cache"`
+}
+
+func TestLoadLayered(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	err := os.WriteFile(path, []byte(`{
+		"name": "base",
+		"database": {"host": "db.internal", "port": 3306},
+		"labels": {"team": "a", "env": "prod"}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "config.local.dev.json"), []byte(`{
+		"database": {"port": 3307},
+		"labels": {"env": "dev"}
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_HOST", "env-host")
+	t.Setenv("TEST_DB_REPLICAS", "r1, r2")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, sources, err := LoadLayered[layeredConfig](LayeredOptions{
+		FilePath:  path,
+		EnvPrefix: "TEST_",
+		FlagSet:   fs,
+		Args:      []string{"-debug", "-db-port", "9999"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "base" {
+		t.Errorf("Name = %q, want base", cfg.Name)
+	}
+	if cfg.Database.Host != "env-host" {
+		t.Errorf("Database.Host = %q, want env-host", cfg.Database.Host)
+	}
+	if cfg.Database.Port != 9999 {
+		t.Errorf("Database.Port = %d, want 9999", cfg.Database.Port)
+	}
+	if cfg.Database.Timeout != 5*time.Second {
+		t.Errorf("Database.Timeout = %v, want 5s", cfg.Database.Timeout)
+	}
+	if !reflect.DeepEqual(cfg.Database.Replicas, []string{"r1", "r2"}) {
+		t.Errorf("Database.Replicas = %v", cfg.Database.Replicas)
+	}
+	if !cfg.Debug {
+		t.Error("Debug should be set by flag")
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"team": "a", "env": "dev"}) {
+		t.Errorf("Labels should be deep merged, got %v", cfg.Labels)
+	}
+	if cfg.Cache == nil || cfg.Cache.Size != 128 {
+		t.Errorf("Cache should be allocated with defaults, got %+v", cfg.Cache)
+	}
+
+	want := map[string]Layer{
+		"Name":              LayerFile,
+		"Debug":             LayerFlag,
+		"Database.Host":     LayerEnv,
+		"Database.Port":     LayerFlag,
+		"Database.Timeout":  LayerDefault,
+		"Database.Replicas": LayerEnv,
+		"Labels":            LayerDevFile,
+		"Cache.Size":        LayerDefault,
+	}
+	for path, layer := range want {
+		if got := sources.Of(path); got != layer {
+			t.Errorf("source of %s = %v, want %v", path, got, layer)
+		}
+	}
+}
+
+func TestLoadLayered_LargeIntegers(t *testing.T) {
+	type ids struct {
+		Signed   int64  `json:"signed" yaml:"signed"`
+		Unsigned uint64 `json:"unsigned" yaml:"unsigned"`
+	}
+	files := map[string]string{
+		"config.json": `{"signed": 9007199254740993, "unsigned": 18446744073709551615}`,
+		"config.yaml": "signed: 9007199254740993\nunsigned: 18446744073709551615\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, err := LoadLayered[ids](LayeredOptions{FilePath: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Signed != 9007199254740993 || cfg.Unsigned != 18446744073709551615 {
+			t.Errorf("%s: integers lost precision: %+v", name, cfg)
+		}
+	}
+}
+
+func TestLoadLayered_NoFile(t *testing.T) {
+	cfg, sources, err := LoadLayered[layeredConfig](LayeredOptions{
+		FilePath: filepath.Join(t.TempDir(), "missing.toml"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "app" || cfg.Database.Port != 5432 {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if sources.Of("Debug") != LayerNone {
+		t.Errorf("Debug should not be supplied by any layer")
+	}
+}
+
+func TestLoadLayered_InvalidEnv(t *testing.T) {
+	type cfg struct {
+		Port int `env:"PORT"`
+	}
+	t.Setenv("BAD_PORT", "not-a-number")
+	_, _, err := LoadLayered[cfg](LayeredOptions{EnvPrefix: "BAD_"})
+	if err == nil {
+		t.Fatal("expected an error for invalid env value")
+	}
+}
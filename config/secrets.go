@@ -0,0 +1,437 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/doraemonkeys/doraemon"
+	"github.com/doraemonkeys/doraemon/crypto"
+)
+
+// Redacted replaces resolved secrets when a configuration is printed.
+const Redacted = "******"
+
+// Secret is a string that is redacted when formatted with the fmt package.
+// Use it for fields holding secrets so that they are not leaked by logging the configuration.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// Value returns the secret in clear text.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// secretRefPattern matches ${env:NAME}, ${file:/path} and ${vault:key}.
+var secretRefPattern = regexp.MustCompile(`\$\{(env|file|vault):([^}]+)\}`)
+
+// Vault is a local key-value file of secrets encrypted with crypto.AESGCM.
+// It is safe for concurrent use.
+type Vault struct {
+	mu      sync.RWMutex
+	path    string
+	cipher  crypto.AESGCM
+	secrets map[string]string
+}
+
+// OpenVault opens the vault file at path, decrypting it with key (16, 24 or 32 bytes).
+// If the file does not exist, an empty vault is returned, it is created by Save.
+func OpenVault(path string, key []byte) (*Vault, error) {
+	c, err := crypto.NewAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vault{path: path, cipher: c, secrets: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := c.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault %s: %w", path, err)
+	}
+	if err := json.Unmarshal(plaintext, &v.secrets); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %w", path, err)
+	}
+	return v, nil
+}
+
+func (v *Vault) Get(key string) (string, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	s, ok := v.secrets[key]
+	return s, ok
+}
+
+// Set stores a secret in memory, call Save to write the vault file.
+func (v *Vault) Set(key, value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secrets[key] = value
+}
+
+func (v *Vault) Delete(key string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.secrets, key)
+}
+
+// Save encrypts the vault and writes it to its file with mode 0600.
+func (v *Vault) Save() error {
+	v.mu.RLock()
+	plaintext, err := json.Marshal(v.secrets)
+	v.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	ciphertext, err := v.cipher.Encrypt(plaintext)
+	if err != nil {
+		return err
+	}
+	return doraemon.WriteFile(v.path, 0600, ciphertext)
+}
+
+// SecretResolver resolves secret references in the string fields of a configuration:
+//
+//	${env:DB_PASS}          the environment variable DB_PASS
+//	${file:/run/secrets/db} the content of the file, without the trailing newline
+//	${vault:db}             the key "db" of Vault
+//
+// A reference may be the whole value or a part of it, e.g. "postgres://app:${env:DB_PASS}@db/app".
+//
+// The resolver remembers the secrets it resolved, see RedactResolved. It is safe for concurrent use.
+type SecretResolver struct {
+	// Vault resolves ${vault:...} references, they are an error if it is nil.
+	Vault *Vault
+	// LookupEnv resolves ${env:...} references, os.LookupEnv if nil.
+	LookupEnv func(key string) (string, bool)
+
+	mu      sync.Mutex
+	secrets map[string]struct{}
+}
+
+// ResolvedSecrets records the fields whose references were resolved, so that
+// the secrets can be redacted or replaced by their references again.
+type ResolvedSecrets struct {
+	// field path -> resolved field
+	fields map[string]resolvedField
+}
+
+type resolvedField struct {
+	ref   string
+	value string
+}
+
+// Paths returns the paths of the fields that hold resolved secrets, e.g. "Database.Password".
+func (r *ResolvedSecrets) Paths() []string {
+	paths := make([]string, 0, len(r.fields))
+	for p := range r.fields {
+		paths = append(paths, p)
+	}
+	return paths
+}
+
+// Resolve replaces the secret references in the string fields of cfg, which must be a
+// pointer. Nested structs, pointers, slices, arrays and maps are resolved too.
+func (r *SecretResolver) Resolve(cfg any) (*ResolvedSecrets, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, fmt.Errorf("resolve secrets: expected a non-nil pointer, got %T", cfg)
+	}
+	resolved := &ResolvedSecrets{fields: make(map[string]resolvedField)}
+	var errs []error
+	walkStrings(rv.Elem(), "", func(path, s string) (string, bool) {
+		if !strings.Contains(s, "${") {
+			return s, false
+		}
+		var refErr error
+		value := secretRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+			m := secretRefPattern.FindStringSubmatch(ref)
+			secret, err := r.lookup(m[1], m[2])
+			if err != nil {
+				refErr = errors.Join(refErr, fmt.Errorf("%s: %w", path, err))
+				return ref
+			}
+			r.remember(secret)
+			return secret
+		})
+		if refErr != nil {
+			errs = append(errs, refErr)
+			return s, false
+		}
+		if value == s {
+			return s, false
+		}
+		resolved.fields[path] = resolvedField{ref: s, value: value}
+		return value, true
+	})
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return resolved, nil
+}
+
+func (r *SecretResolver) remember(secret string) {
+	if secret == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.secrets == nil {
+		r.secrets = make(map[string]struct{})
+	}
+	r.secrets[secret] = struct{}{}
+}
+
+func (r *SecretResolver) lookup(kind, name string) (string, error) {
+	switch kind {
+	case "env":
+		lookupEnv := r.LookupEnv
+		if lookupEnv == nil {
+			lookupEnv = os.LookupEnv
+		}
+		if v, ok := lookupEnv(name); ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "vault":
+		if r.Vault == nil {
+			return "", fmt.Errorf("no vault to resolve ${vault:%s}", name)
+		}
+		if v, ok := r.Vault.Get(name); ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("secret %q not found in vault", name)
+	default:
+		return "", fmt.Errorf("unknown secret reference kind %q", kind)
+	}
+}
+
+// Redact returns a deep copy of cfg in which the resolved secrets are replaced by Redacted,
+// for printing or logging. cfg is not modified.
+func Redact[T any](cfg T, secrets *ResolvedSecrets) T {
+	return replaceSecrets(cfg, secrets, func(resolvedField) string { return Redacted })
+}
+
+// RedactResolved returns a deep copy of cfg in which every secret resolved by r so far is
+// replaced by Redacted wherever it appears in a string, e.g. in the plain string fields of a
+// configuration loaded by InitJsonConfig, whose ResolvedSecrets are not returned. Unlike
+// Redact, a secret copied into another field is redacted too. cfg is not modified.
+func RedactResolved[T any](cfg T, r *SecretResolver) T {
+	if r == nil {
+		return cfg
+	}
+	r.mu.Lock()
+	secrets := make([]string, 0, len(r.secrets))
+	for secret := range r.secrets {
+		secrets = append(secrets, secret)
+	}
+	r.mu.Unlock()
+	if len(secrets) == 0 {
+		return cfg
+	}
+	// the longest first, a secret may contain another one
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, Redacted)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	v := deepCopy(reflect.ValueOf(&cfg).Elem())
+	walkStrings(v, "", func(_, s string) (string, bool) {
+		redacted := replacer.Replace(s)
+		return redacted, redacted != s
+	})
+	return v.Interface().(T)
+}
+
+// Unresolve returns a deep copy of cfg in which the resolved secrets are replaced by
+// their original references, so that the configuration can be saved without the secrets.
+// Fields that were changed after resolving keep their new value. cfg is not modified.
+func Unresolve[T any](cfg T, secrets *ResolvedSecrets) T {
+	return replaceSecrets(cfg, secrets, func(f resolvedField) string { return f.ref })
+}
+
+func replaceSecrets[T any](cfg T, secrets *ResolvedSecrets, with func(resolvedField) string) T {
+	if secrets == nil || len(secrets.fields) == 0 {
+		return cfg
+	}
+	v := deepCopy(reflect.ValueOf(&cfg).Elem())
+	walkStrings(v, "", func(path, s string) (string, bool) {
+		f, ok := secrets.fields[path]
+		if !ok || f.value != s {
+			return s, false
+		}
+		return with(f), true
+	})
+	return v.Interface().(T)
+}
+
+// walkStrings calls fn for each string in v, which must be addressable, and sets
+// the strings for which fn reports a change. Unexported fields are skipped.
+func walkStrings(v reflect.Value, path string, fn func(path, s string) (string, bool)) {
+	switch v.Kind() {
+	case reflect.String:
+		if s, changed := fn(path, v.String()); changed {
+			v.SetString(s)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		elem := v.Elem()
+		if v.Kind() == reflect.Interface {
+			// values in interfaces are not addressable
+			copied := reflect.New(elem.Type()).Elem()
+			copied.Set(elem)
+			walkStrings(copied, path, fn)
+			v.Set(copied)
+			return
+		}
+		walkStrings(elem, path, fn)
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fieldPath := joinPath(path, sf.Name)
+			if sf.Anonymous {
+				fieldPath = path
+			}
+			walkStrings(v.Field(i), fieldPath, fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			walkStrings(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			walkStrings(elem, fmt.Sprintf("%s[%v]", path, iter.Key()), fn)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
+
+// deepCopy returns an addressable copy of v that shares no pointers, slices or maps with it.
+// Unexported fields are copied shallowly.
+func deepCopy(v reflect.Value) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			p := reflect.New(v.Type().Elem())
+			p.Elem().Set(deepCopy(v.Elem()))
+			c.Set(p)
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			c.Set(deepCopy(v.Elem()))
+		}
+	case reflect.Struct:
+		c.Set(v)
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				c.Field(i).Set(deepCopy(v.Field(i)))
+			}
+		}
+	case reflect.Slice:
+		if !v.IsNil() {
+			c.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+			for i := range v.Len() {
+				c.Index(i).Set(deepCopy(v.Index(i)))
+			}
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+	case reflect.Map:
+		if !v.IsNil() {
+			c.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				c.SetMapIndex(iter.Key(), deepCopy(iter.Value()))
+			}
+		}
+	default:
+		c.Set(v)
+	}
+	return c
+}
+
+// DefaultSecretResolver resolves the secret references of the configurations loaded by
+// the Init*Config functions, LoadLayered and NewConfigWrapper. It is nil by default: the
+// references are resolved on every load once it is set, e.g.
+//
+//	config.DefaultSecretResolver = &config.SecretResolver{Vault: vault}
+//
+// Set it before loading any configuration, it is not synchronized.
+var DefaultSecretResolver *SecretResolver
+
+// resolveSecrets resolves the references in config with the DefaultSecretResolver, if any.
+func resolveSecrets[T any](config *T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	if DefaultSecretResolver == nil {
+		return config, nil
+	}
+	if _, err := DefaultSecretResolver.Resolve(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// secretHooks returns the doraemon.ConfigWrapper codec hooks that resolve the secret
+// references on load and write the references back on save.
+func secretHooks[T comparable](resolver *SecretResolver) (func(T) (T, error), func(T) (any, error)) {
+	var mu sync.Mutex
+	var resolved *ResolvedSecrets
+	afterLoad := func(config T) (T, error) {
+		secrets, err := resolver.Resolve(&config)
+		if err != nil {
+			return config, err
+		}
+		mu.Lock()
+		resolved = secrets
+		mu.Unlock()
+		return config, nil
+	}
+	beforeSave := func(config T) (any, error) {
+		mu.Lock()
+		secrets := resolved
+		mu.Unlock()
+		return Unresolve(config, secrets), nil
+	}
+	return afterLoad, beforeSave
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type secretsDatabase struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	DSN      string `json:"dsn"`
+}
+
+type secretsConfig struct {
+	Name     string            `json:"name"`
+	APIKey   Secret            `json:"api_key"`
+	Database *secretsDatabase  `json:"database"`
+	Tokens   []string          `json:"tokens"`
+	Extra    map[string]string `json:"extra"`
+}
+
+func newTestVault(t *testing.T) *Vault {
+	t.Helper()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	v, err := OpenVault(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("api", "vault-api-key")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "vault-api-key") {
+		t.Fatal("vault file is not encrypted")
+	}
+	v, err = OpenVault(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenVault(path, []byte("fedcba9876543210fedcba9876543210")); err == nil {
+		t.Fatal("expected an error for a wrong key")
+	}
+	return v
+}
+
+func TestSecretResolver(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(secretFile, []byte("file-pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"DB_USER": "app", "TOKEN": "tok"}
+	r := &SecretResolver{
+		Vault:     newTestVault(t),
+		LookupEnv: func(key string) (string, bool) { v, ok := env[key]; return v, ok },
+	}
+	cfg := &secretsConfig{
+		Name:   "plain ${not a ref}",
+		APIKey: "${vault:api}",
+		Database: &secretsDatabase{
+			User:     "${env:DB_USER}",
+			Password: "${file:" + secretFile + "}",
+			DSN:      "postgres://${env:DB_USER}:${file:" + secretFile + "}@db/app",
+		},
+		Tokens: []string{"${env:TOKEN}", "literal"},
+		Extra:  map[string]string{"k": "${env:TOKEN}"},
+	}
+	original := *cfg.Database
+	secrets, err := r.Resolve(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey.Value() != "vault-api-key" || cfg.Database.User != "app" || cfg.Database.Password != "file-pass" ||
+		cfg.Database.DSN != "postgres://app:file-pass@db/app" || cfg.Tokens[0] != "tok" || cfg.Extra["k"] != "tok" {
+		t.Fatalf("unexpected resolved config %+v %+v", cfg, cfg.Database)
+	}
+	if cfg.Name != "plain ${not a ref}" {
+		t.Fatalf("non reference changed: %q", cfg.Name)
+	}
+	if len(secrets.Paths()) != 6 {
+		t.Fatalf("unexpected resolved paths %v", secrets.Paths())
+	}
+
+	redacted := Redact(cfg, secrets)
+	if redacted.Database.Password != Redacted || redacted.Tokens[0] != Redacted || redacted.Extra["k"] != Redacted {
+		t.Fatalf("not redacted: %+v %+v", redacted, redacted.Database)
+	}
+	if cfg.Database.Password != "file-pass" || cfg.Extra["k"] != "tok" {
+		t.Fatal("Redact modified the original config")
+	}
+	if s := fmt.Sprintf("%v %+v", cfg.APIKey, *cfg); strings.Contains(s, "vault-api-key") {
+		t.Fatalf("Secret printed in clear text: %s", s)
+	}
+	// without the ResolvedSecrets, and for secrets copied into other fields
+	cfg.Name = "copied file-pass"
+	redacted = RedactResolved(cfg, r)
+	if s := fmt.Sprintf("%+v %+v", *redacted, *redacted.Database); strings.Contains(s, "file-pass") ||
+		strings.Contains(s, "tok") || !strings.HasPrefix(redacted.Database.DSN, "postgres://"+Redacted+":"+Redacted+"@db/") {
+		t.Fatalf("not redacted: %s", s)
+	}
+	if cfg.Name != "copied file-pass" || cfg.Database.Password != "file-pass" {
+		t.Fatal("RedactResolved modified the original config")
+	}
+
+	cfg.Database.User = "changed"
+	unresolved := Unresolve(cfg, secrets)
+	if *unresolved.Database != (secretsDatabase{User: "changed", Password: original.Password, DSN: original.DSN}) {
+		t.Fatalf("unexpected unresolved config %+v", unresolved.Database)
+	}
+
+	if _, err := r.Resolve(&secretsConfig{Name: "${env:MISSING}"}); err == nil || !strings.Contains(err.Error(), "Name") {
+		t.Fatalf("expected an error naming the field, got %v", err)
+	}
+	if _, err := (&SecretResolver{}).Resolve(&secretsConfig{Name: "${vault:api}"}); err == nil {
+		t.Fatal("expected an error without a vault")
+	}
+}
+
+func TestNewConfigWrapper_Secrets(t *testing.T) {
+	t.Setenv("DORAEMON_TEST_DB_PASS", "s3cret")
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"name": "app", "database": {"user": "u", "password": "${env:DORAEMON_TEST_DB_PASS}"}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := InitJsonConfig[secretsConfig](path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Database.Password != "${env:DORAEMON_TEST_DB_PASS}" {
+		t.Fatalf("secret resolved without a DefaultSecretResolver: %+v", loaded.Database)
+	}
+
+	DefaultSecretResolver = &SecretResolver{}
+	defer func() { DefaultSecretResolver = nil }()
+	loaded, err = InitJsonConfig[secretsConfig](path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Database.Password != "s3cret" {
+		t.Fatalf("InitJsonConfig did not resolve the secret: %+v", loaded.Database)
+	}
+
+	c, err := NewConfigWrapper[*secretsConfig](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Get().Database.Password != "s3cret" {
+		t.Fatalf("secret not resolved: %+v", c.Get().Database)
+	}
+	c.Config.Name = "renamed"
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "s3cret") || !strings.Contains(string(data), "${env:DORAEMON_TEST_DB_PASS}") ||
+		!strings.Contains(string(data), "renamed") {
+		t.Fatalf("unexpected saved config:\n%s", data)
+	}
+	if c.Get().Database.Password != "s3cret" {
+		t.Fatal("Save modified the config in memory")
+	}
+}
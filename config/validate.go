@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FieldError describes a field that failed a validation rule.
+type FieldError struct {
+	// Path of the field, e.g. "Database.Hosts[0]" or "Labels[env]".
+	Path string
+	// Rule is the failed rule, e.g. "min".
+	Rule    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every invalid field of a configuration.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid config:")
+	for _, fe := range e {
+		sb.WriteString("\n  - ")
+		sb.WriteString(fe.Error())
+	}
+	return sb.String()
+}
+
+// Validate checks the fields of the struct (or pointer to struct) v against their
+// `validate:"..."` tags, descending into nested structs, pointers, slices, arrays and maps.
+// It returns a ValidationError listing every invalid field, or nil.
+//
+// Rules are separated by commas:
+//
+//	required     the value must not be the zero value (empty string, nil, empty slice or map)
+//	omitempty    skip the remaining rules if the value is the zero value
+//	min=N, max=N numbers (and time.Duration, e.g. "min=1s") are compared by value,
+//	             strings by rune count, slices and maps by length
+//	len=N        exact length of a string, slice or map
+//	oneof=a b c  the value, formatted with fmt, must be one of the space separated options
+//	url          a string that is an absolute URL with a host
+//	duration     a string accepted by time.ParseDuration
+//	dive         the rules after dive are applied to each element of a slice, array or map
+//
+// Example:
+//
+//	type Config struct {
+//		Addr    string   `validate:"required,url"`
+//		Workers int      `validate:"min=1,max=64"`
+//		Mode    string   `validate:"oneof=dev prod"`
+//		Peers   []string `validate:"min=1,dive,url"`
+//	}
+func Validate(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	var errs ValidationError
+	validateValue(rv, "", nil, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func validateValue(v reflect.Value, path string, rules []string, errs *ValidationError) {
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if v.IsZero() {
+				return
+			}
+			continue
+		case "dive":
+			validateChildren(indirect(v), path, rules[i+1:], errs)
+			return
+		}
+		if msg := checkRule(v, name, param); msg != "" {
+			*errs = append(*errs, FieldError{Path: path, Rule: name, Message: msg})
+		}
+	}
+	validateChildren(indirect(v), path, nil, errs)
+}
+
+// validateChildren validates the fields of a struct, or the elements of a slice,
+// array or map with elemRules.
+func validateChildren(v reflect.Value, path string, elemRules []string, errs *ValidationError) {
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if elemRules != nil {
+			return
+		}
+		t := v.Type()
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fieldPath := joinPath(path, sf.Name)
+			if sf.Anonymous {
+				fieldPath = path
+			}
+			validateValue(v.Field(i), fieldPath, parseRules(sf.Tag.Get("validate")), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), elemRules, errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), elemRules, errs)
+		}
+	}
+}
+
+func parseRules(tag string) []string {
+	if tag == "" || tag == "-" {
+		return nil
+	}
+	rules := strings.Split(tag, ",")
+	for i := range rules {
+		rules[i] = strings.TrimSpace(rules[i])
+	}
+	return rules
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// checkRule returns a message describing why v breaks the rule, or "" if it does not.
+func checkRule(v reflect.Value, name, param string) string {
+	if name == "required" {
+		if !v.IsValid() || v.IsZero() || (isLenKind(v.Kind()) && v.Len() == 0) {
+			return "is required"
+		}
+		return ""
+	}
+
+	v = indirect(v)
+	if !v.IsValid() {
+		// other rules do not apply to nil values, use required to forbid them
+		return ""
+	}
+	switch name {
+	case "min", "max", "len":
+		return checkBound(v, name, param)
+	case "oneof":
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s], got %q", param, s)
+	case "url":
+		if v.Kind() != reflect.String {
+			return "url rule requires a string"
+		}
+		u, err := url.Parse(v.String())
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Sprintf("must be an absolute URL, got %q", v.String())
+		}
+		return ""
+	case "duration":
+		if v.Kind() != reflect.String {
+			return "duration rule requires a string"
+		}
+		if _, err := time.ParseDuration(v.String()); err != nil {
+			return fmt.Sprintf("must be a duration, got %q", v.String())
+		}
+		return ""
+	default:
+		return fmt.Sprintf("unknown validation rule %q", name)
+	}
+}
+
+func isLenKind(k reflect.Kind) bool {
+	return k == reflect.String || k == reflect.Slice || k == reflect.Map || k == reflect.Array
+}
+
+func checkBound(v reflect.Value, name, param string) string {
+	var actual, limit float64
+	var what string
+	if isLenKind(v.Kind()) {
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			return fmt.Sprintf("invalid %s parameter %q", name, param)
+		}
+		limit = float64(n)
+		if v.Kind() == reflect.String {
+			actual = float64(utf8.RuneCountInString(v.String()))
+		} else {
+			actual = float64(v.Len())
+		}
+		what = "length"
+	} else {
+		p := reflect.New(v.Type()).Elem()
+		if err := setFromString(p, param); err != nil {
+			return fmt.Sprintf("invalid %s parameter %q: %v", name, param, err)
+		}
+		var ok bool
+		if actual, ok = numberOf(v); !ok {
+			return fmt.Sprintf("%s rule does not apply to %s", name, v.Type())
+		}
+		limit, _ = numberOf(p)
+		what = "value"
+	}
+
+	switch {
+	case name == "min" && actual < limit:
+		return fmt.Sprintf("%s must be at least %s", what, param)
+	case name == "max" && actual > limit:
+		return fmt.Sprintf("%s must be at most %s", what, param)
+	case name == "len" && actual != limit:
+		return fmt.Sprintf("%s must be %s", what, param)
+	}
+	return ""
+}
+
+func numberOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+type validateServer struct {
+	Addr    string        `validate:"required,url"`
+	Timeout time.Duration `validate:"min=1s,max=1m"`
+}
+
+type validateConfig struct {
+	Name     string           `validate:"required,min=2,max=8"`
+	Mode     string           `validate:"oneof=dev prod"`
+	Workers  int              `validate:"min=1"`
+	Ratio    *float64         `validate:"omitempty,max=1"`
+	Interval string           `validate:"omitempty,duration"`
+	Servers  []validateServer `validate:"required"`
+	Peers    []string         `validate:"dive,url"`
+	Limits   map[string]int   `validate:"dive,min=0"`
+	Backends map[string]*validateServer
+	Token    *string  `validate:"required"`
+	Tags     []string `validate:"len=2"`
+}
+
+func TestValidate(t *testing.T) {
+	ratio := 1.5
+	cfg := validateConfig{
+		Name:     "x",
+		Mode:     "test",
+		Workers:  0,
+		Ratio:    &ratio,
+		Interval: "soon",
+		Servers:  []validateServer{{Addr: "http://a", Timeout: time.Second}, {Addr: "nope", Timeout: time.Hour}},
+		Peers:    []string{"http://ok", "bad"},
+		Limits:   map[string]int{"a": -1},
+		Backends: map[string]*validateServer{"main": {Addr: "", Timeout: time.Second}},
+		Tags:     []string{"a"},
+	}
+	err := Validate(&cfg)
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+
+	var paths []string
+	for _, fe := range verr {
+		paths = append(paths, fe.Path+":"+fe.Rule)
+	}
+	sort.Strings(paths)
+	want := []string{
+		"Backends[main].Addr:required",
+		"Backends[main].Addr:url",
+		"Interval:duration",
+		"Limits[a]:min",
+		"Mode:oneof",
+		"Name:min",
+		"Peers[1]:url",
+		"Ratio:max",
+		"Servers[1].Addr:url",
+		"Servers[1].Timeout:max",
+		"Tags:len",
+		"Token:required",
+		"Workers:min",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("got errors %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("got errors %v, want %v", paths, want)
+		}
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	token := "t"
+	cfg := validateConfig{
+		Name:    "app",
+		Mode:    "prod",
+		Workers: 4,
+		Servers: []validateServer{{Addr: "https://example.com", Timeout: 10 * time.Second}},
+		Token:   &token,
+		Tags:    []string{"a", "b"},
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitJsonConfig_Validate(t *testing.T) {
+	type cfg struct {
+		Addr string `json:"addr" validate:"required"`
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"addr": ""}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitJsonConfig[cfg](path, nil); err == nil {
+		t.Fatal("expected a validation error")
+	}
+}
@@ -0,0 +1,155 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testAppConfig struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+type configChangeCollector[T comparable] struct {
+	events chan ConfigChange[T]
+}
+
+func (c *configChangeCollector[T]) OnEvent(event ConfigChange[T]) {
+	c.events <- event
+}
+
+func (c *configChangeCollector[T]) GetID() string {
+	return "collector"
+}
+
+func writeTestConfig(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigWrapper_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"name":"a","port":1}`)
+
+	c, err := NewConfigWrapper2[testAppConfig](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &configChangeCollector[testAppConfig]{events: make(chan ConfigChange[testAppConfig], 10)}
+	c.Publisher().Subscribe(collector)
+	c.SetValidator(func(cfg testAppConfig) error {
+		if cfg.Port <= 0 {
+			return errors.New("port must be positive")
+		}
+		return nil
+	})
+
+	writeTestConfig(t, path, `{"name":"b","port":2}`)
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Get(); got.Name != "b" || got.Port != 2 {
+		t.Fatalf("unexpected config after reload: %+v", got)
+	}
+	select {
+	case e := <-collector.events:
+		if e.Old.Name != "a" || e.New.Name != "b" {
+			t.Fatalf("unexpected change event: %+v", e)
+		}
+	default:
+		t.Fatal("expected a change event")
+	}
+
+	// unchanged content does not publish
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(collector.events) != 0 {
+		t.Fatal("unexpected change event for unchanged config")
+	}
+
+	// invalid config is rejected and the old one is kept
+	writeTestConfig(t, path, `{"name":"c","port":0}`)
+	if err := c.Reload(); err == nil {
+		t.Fatal("expected validation error")
+	}
+	if got := c.Get(); got.Name != "b" {
+		t.Fatalf("config should not change on validation error: %+v", got)
+	}
+
+	// malformed file is rejected
+	writeTestConfig(t, path, `{"name":`)
+	if err := c.Reload(); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestConfigWrapper_ReloadPointer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"name":"a","port":1}`)
+	c, err := NewConfigWrapper2[*testAppConfig](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &configChangeCollector[*testAppConfig]{events: make(chan ConfigChange[*testAppConfig], 10)}
+	c.Publisher().Subscribe(collector)
+
+	// each load allocates a new pointer, the configs are compared by value
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(collector.events) != 0 {
+		t.Fatal("unexpected change event for unchanged config")
+	}
+	writeTestConfig(t, path, `{"name":"b","port":1}`)
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(collector.events) != 1 {
+		t.Fatalf("expected a change event, got %d", len(collector.events))
+	}
+}
+
+func TestConfigWrapper_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeTestConfig(t, path, `{"name":"a","port":1}`)
+
+	c, err := NewConfigWrapper2[testAppConfig](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetWatchDebounce(50 * time.Millisecond)
+	collector := &configChangeCollector[testAppConfig]{events: make(chan ConfigChange[testAppConfig], 10)}
+	c.Publisher().Subscribe(collector)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := c.Watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a burst of writes results in a single reload
+	for i := range 5 {
+		writeTestConfig(t, path, `{"name":"b","port":`+string(rune('1'+i))+`}`)
+	}
+
+	select {
+	case e := <-collector.events:
+		if e.New.Name != "b" || e.New.Port != 5 {
+			t.Fatalf("unexpected change event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for reload")
+	}
+	select {
+	case e := <-collector.events:
+		t.Fatalf("expected writes to be debounced, got extra event %+v", e)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,404 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SymlinkPolicy tells CopyTree what to do with symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinkCopy recreates the link, with the same target, in the destination.
+	SymlinkCopy SymlinkPolicy = iota
+	// SymlinkFollow copies the file or directory the link points to. A link to a parent
+	// directory (a loop) is not followed, see CopyProgress.SkippedLinks.
+	SymlinkFollow
+	// SymlinkSkip ignores symbolic links.
+	SymlinkSkip
+)
+
+// CopyCompare tells CopyTree how to detect a destination file that is already up to date.
+type CopyCompare int
+
+const (
+	// CompareSizeModTime skips a file whose destination has the same size and modification time.
+	CompareSizeModTime CopyCompare = iota
+	// CompareHash skips a file whose destination has the same size and SHA-256.
+	CompareHash
+	// CompareNone copies every file.
+	CompareNone
+)
+
+// CopyProgress is reported by CopyTree while it copies.
+type CopyProgress struct {
+	FilesTotal   int
+	FilesDone    int
+	FilesSkipped int
+	BytesTotal   int64
+	// BytesDone counts the bytes of the copied and of the skipped files.
+	BytesDone int64
+	Elapsed   time.Duration
+	// ETA is the estimated remaining time, 0 until it can be estimated.
+	ETA time.Duration
+	// SkippedLinks are the slash separated relative paths of the links to a parent directory
+	// (loops), which are not followed with SymlinkFollow.
+	SkippedLinks []string
+}
+
+// CopyTreeOptions configures CopyTree.
+type CopyTreeOptions struct {
+	// Include restricts the copied files to those matching one of the globs, see MatchGlob.
+	// All files are copied if it is empty. Directories are always traversed.
+	Include []string
+	// Exclude skips the files and directories matching one of the globs.
+	Exclude  []string
+	Symlinks SymlinkPolicy
+	// Workers is the number of files copied in parallel, runtime.NumCPU() if 0.
+	Workers int
+	Compare CopyCompare
+	// Progress is called at most every ProgressInterval and once at the end, never concurrently.
+	Progress         func(CopyProgress)
+	ProgressInterval time.Duration
+}
+
+// copyTreePartSuffix marks the partial files of CopyTree.
+const copyTreePartSuffix = ".copytree-part"
+
+// copyChunkSize is the amount copied between two checks of the context.
+const copyChunkSize = 8 << 20
+
+type copyJob struct {
+	src, dst string
+	info     fs.FileInfo
+}
+
+// CopyTree copies the content of the directory src into the directory dst, which is created if needed.
+// File modes and modification times are preserved. Files are first written to a partial file next to
+// their destination and renamed when complete.
+//
+// CopyTree is resumable: after an interruption, calling it again skips the files already copied
+// (see CopyCompare) and continues the partial files where they stopped, as long as their source is
+// unchanged. On Linux the files are cloned (reflink) when the file system supports it, and copied
+// with copy_file_range otherwise.
+//
+// It stops at the first error, or when ctx is done.
+func CopyTree(ctx context.Context, src, dst string, opts CopyTreeOptions) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.IsDir() {
+		return fmt.Errorf("%s is not a folder", src)
+	}
+	if IsSubPath(src, dst) {
+		return fmt.Errorf("\"%s\" is a child folder of \"%s\"", dst, src)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = 200 * time.Millisecond
+	}
+
+	t := &treeCopier{opts: opts, start: time.Now()}
+	if err := t.scan(src, dst, "", srcInfo, nil); err != nil {
+		return err
+	}
+	t.progress.FilesTotal = len(t.jobs)
+	for _, j := range t.jobs {
+		t.progress.BytesTotal += j.info.Size()
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	jobs := make(chan copyJob)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := t.copyFile(ctx, j); err != nil {
+					cancel(fmt.Errorf("copy %s: %w", j.src, err))
+				}
+			}
+		}()
+	}
+send:
+	for _, j := range t.jobs {
+		select {
+		case jobs <- j:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+
+	// the directories get their modes once their content is written, children first
+	for i := len(t.dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(t.dirs[i].dst, t.dirs[i].info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	t.report(true)
+	return nil
+}
+
+type treeCopier struct {
+	opts CopyTreeOptions
+	jobs []copyJob
+	dirs []copyJob
+
+	mu         sync.Mutex
+	start      time.Time
+	lastReport time.Time
+	progress   CopyProgress
+}
+
+// scan creates the directories of the destination, copies the symbolic links and lists the files to copy.
+// ancestors are the directories above src, a followed link to one of them is a loop.
+func (t *treeCopier) scan(src, dst, rel string, info fs.FileInfo, ancestors []fs.FileInfo) error {
+	ancestors = append(slices.Clip(ancestors), info)
+	// the directory stays writable until its content is copied
+	if err := os.MkdirAll(dst, info.Mode().Perm()|0700); err != nil {
+		return err
+	}
+	t.dirs = append(t.dirs, copyJob{src: src, dst: dst, info: info})
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, copyTreePartSuffix) {
+			continue
+		}
+		childRel := filepath.ToSlash(filepath.Join(rel, name))
+		if MatchAnyGlob(t.opts.Exclude, childRel) {
+			continue
+		}
+		childSrc, childDst := filepath.Join(src, name), filepath.Join(dst, name)
+		childInfo, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if childInfo.Mode()&fs.ModeSymlink != 0 {
+			switch t.opts.Symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkCopy:
+				if len(t.opts.Include) > 0 && !MatchAnyGlob(t.opts.Include, childRel) {
+					continue
+				}
+				if err := copySymlink(childSrc, childDst); err != nil {
+					return err
+				}
+				continue
+			case SymlinkFollow:
+				if childInfo, err = os.Stat(childSrc); err != nil {
+					return err
+				}
+			}
+		}
+		switch {
+		case childInfo.IsDir():
+			if slices.ContainsFunc(ancestors, func(a fs.FileInfo) bool { return os.SameFile(a, childInfo) }) {
+				t.progress.SkippedLinks = append(t.progress.SkippedLinks, childRel)
+				continue
+			}
+			if err := t.scan(childSrc, childDst, childRel, childInfo, ancestors); err != nil {
+				return err
+			}
+		case childInfo.Mode().IsRegular():
+			if len(t.opts.Include) == 0 || MatchAnyGlob(t.opts.Include, childRel) {
+				t.jobs = append(t.jobs, copyJob{src: childSrc, dst: childDst, info: childInfo})
+			}
+		}
+	}
+	return nil
+}
+
+func copySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if current, err := os.Readlink(dst); err == nil && current == target {
+		return nil
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+func (t *treeCopier) copyFile(ctx context.Context, j copyJob) error {
+	if t.upToDate(j) {
+		t.add(j.info.Size())
+		t.fileDone(true)
+		return nil
+	}
+
+	// the name of the partial file identifies the version of the source it was copied from
+	part := filepath.Join(filepath.Dir(j.dst), "."+filepath.Base(j.dst)+"."+
+		strconv.FormatInt(j.info.Size(), 10)+"-"+strconv.FormatInt(j.info.ModTime().UnixNano(), 10)+copyTreePartSuffix)
+	removeStaleParts(j.dst, part)
+
+	in, err := os.Open(j.src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > j.info.Size() {
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		offset, _ = out.Seek(0, io.SeekStart)
+	}
+	t.add(offset)
+
+	if offset == 0 && j.info.Size() > 0 && cloneFile(out, in) {
+		t.add(j.info.Size())
+	} else {
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		for offset < j.info.Size() {
+			if err := context.Cause(ctx); err != nil {
+				return err
+			}
+			// io.CopyN between files uses copy_file_range on Linux
+			n, err := io.CopyN(out, in, min(copyChunkSize, j.info.Size()-offset))
+			offset += n
+			t.add(n)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := out.Chmod(j.info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(part, time.Now(), j.info.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(part, j.dst); err != nil {
+		return err
+	}
+	t.fileDone(false)
+	return nil
+}
+
+// removeStaleParts removes the partial files of dst copied from other versions of the source than keep.
+func removeStaleParts(dst, keep string) {
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(dst), "."+escapeGlob(filepath.Base(dst))+".*"+copyTreePartSuffix))
+	for _, m := range matches {
+		if m != keep {
+			_ = os.Remove(m)
+		}
+	}
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (t *treeCopier) upToDate(j copyJob) bool {
+	if t.opts.Compare == CompareNone {
+		return false
+	}
+	info, err := os.Stat(j.dst)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != j.info.Size() {
+		return false
+	}
+	if t.opts.Compare == CompareSizeModTime {
+		return info.ModTime().Equal(j.info.ModTime())
+	}
+	srcHash, dstHash := computeFileSHA256(j.src), computeFileSHA256(j.dst)
+	return srcHash.IsOk() && dstHash.IsOk() && string(srcHash.Value) == string(dstHash.Value)
+}
+
+func computeFileSHA256(name string) Result[[]byte] {
+	f, err := os.Open(name)
+	if err != nil {
+		return Err[[]byte](err)
+	}
+	defer f.Close()
+	return ComputeSHA256(f)
+}
+
+// add counts n copied bytes.
+func (t *treeCopier) add(n int64) {
+	t.mu.Lock()
+	t.progress.BytesDone += n
+	t.mu.Unlock()
+	t.report(false)
+}
+
+func (t *treeCopier) fileDone(skipped bool) {
+	t.mu.Lock()
+	t.progress.FilesDone++
+	if skipped {
+		t.progress.FilesSkipped++
+	}
+	t.mu.Unlock()
+	t.report(false)
+}
+
+// report calls the Progress callback if the interval has elapsed, or if final.
+func (t *treeCopier) report(final bool) {
+	if t.opts.Progress == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if !final && now.Sub(t.lastReport) < t.opts.ProgressInterval {
+		return
+	}
+	t.lastReport = now
+	p := t.progress
+	p.Elapsed = now.Sub(t.start)
+	if p.BytesDone > 0 && p.BytesDone < p.BytesTotal {
+		rate := float64(p.BytesDone) / float64(p.Elapsed)
+		p.ETA = time.Duration(float64(p.BytesTotal-p.BytesDone) / rate)
+	}
+	t.opts.Progress(p)
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package doraemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, it makes dst share the extents of src on file systems
+// supporting reflinks (btrfs, xfs, ...).
+const ficlone = 0x40049409
+
+// cloneFile clones the content of src into the empty file dst and reports whether it succeeded.
+func cloneFile(dst, src *os.File) bool {
+	dstConn, err := dst.SyscallConn()
+	if err != nil {
+		return false
+	}
+	srcConn, err := src.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var errno syscall.Errno
+	err = dstConn.Control(func(dstFd uintptr) {
+		_ = srcConn.Control(func(srcFd uintptr) {
+			_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, dstFd, ficlone, srcFd)
+		})
+	})
+	return err == nil && errno == 0
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package doraemon
+
+import "os"
+
+// cloneFile reports false, reflinks are only used on Linux.
+func cloneFile(dst, src *os.File) bool {
+	return false
+}
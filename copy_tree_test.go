@@ -0,0 +1,186 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.tmp", "a/b/c.tmp", true},
+		{"*.tmp", "a/b/c.txt", false},
+		{"a/*.txt", "a/c.txt", true},
+		{"a/*.txt", "a/b/c.txt", false},
+		{"a/**/*.txt", "a/c.txt", true},
+		{"a/**/*.txt", "a/b/d/c.txt", true},
+		{"**/node_modules", "x/y/node_modules", true},
+		{"/build/**", "build/out/app", true},
+		{"[", "[", false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeTestTree(t, src, map[string]string{
+		"a.txt":          "a",
+		"sub/b.txt":      "bb",
+		"sub/c.log":      "ccc",
+		"skip/d.txt":     "dddd",
+		"sub/deep/e.txt": strings.Repeat("e", 1000),
+	})
+	if err := os.Chmod(filepath.Join(src, "a.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	symlinks := os.Symlink("sub/b.txt", filepath.Join(src, "link")) == nil
+
+	var last CopyProgress
+	opts := CopyTreeOptions{
+		Include:  []string{"*.txt", "link"},
+		Exclude:  []string{"skip"},
+		Workers:  2,
+		Progress: func(p CopyProgress) { last = p },
+	}
+	if err := CopyTree(context.Background(), src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if last.FilesTotal != 3 || last.FilesDone != 3 || last.BytesDone != 1003 || last.BytesTotal != 1003 {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+	for _, name := range []string{"sub/c.log", "skip"} {
+		if FileOrDirIsExist(filepath.Join(dst, name)) {
+			t.Fatalf("%s should not be copied", name)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "sub/deep/e.txt")); len(data) != 1000 {
+		t.Fatalf("unexpected content of length %d", len(data))
+	}
+	srcInfo, _ := os.Stat(filepath.Join(src, "a.txt"))
+	dstInfo, _ := os.Stat(filepath.Join(dst, "a.txt"))
+	if dstInfo.Mode().Perm() != 0600 || !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+		t.Fatalf("mode %v and mtime %v not preserved", dstInfo.Mode(), dstInfo.ModTime())
+	}
+	if symlinks {
+		if target, err := os.Readlink(filepath.Join(dst, "link")); err != nil || target != "sub/b.txt" {
+			t.Fatalf("link not copied: %q %v", target, err)
+		}
+	}
+
+	// a second run skips the unchanged files
+	if err := os.WriteFile(filepath.Join(src, "sub/b.txt"), []byte("BB"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	_ = os.Chtimes(filepath.Join(src, "sub/b.txt"), future, future)
+	if err := CopyTree(context.Background(), src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	if last.FilesSkipped != 2 {
+		t.Fatalf("expected 2 skipped files, got %+v", last)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "sub/b.txt")); string(data) != "BB" {
+		t.Fatalf("changed file not copied: %q", data)
+	}
+}
+
+func TestCopyTree_FollowSymlinks(t *testing.T) {
+	src, dst := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeTestTree(t, src, map[string]string{"a/f.txt": "f"})
+	if err := os.Symlink("a", filepath.Join(src, "link")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	if err := os.Symlink("..", filepath.Join(src, "a", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	var last CopyProgress
+	opts := CopyTreeOptions{Symlinks: SymlinkFollow, Progress: func(p CopyProgress) { last = p }}
+	if err := CopyTree(context.Background(), src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	// both links to a are copied, the loops are skipped
+	for _, name := range []string{"a/f.txt", "link/f.txt"} {
+		if data, err := os.ReadFile(filepath.Join(dst, name)); err != nil || string(data) != "f" {
+			t.Fatalf("%s not copied: %q %v", name, data, err)
+		}
+	}
+	if FileOrDirIsExist(filepath.Join(dst, "a/loop")) || FileOrDirIsExist(filepath.Join(dst, "link/loop")) {
+		t.Fatal("loop followed")
+	}
+	slices.Sort(last.SkippedLinks)
+	if !slices.Equal(last.SkippedLinks, []string{"a/loop", "link/loop"}) {
+		t.Fatalf("unexpected skipped links %v", last.SkippedLinks)
+	}
+}
+
+func TestCopyTree_ResumesPartialFile(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	content := strings.Repeat("0123456789", 100)
+	writeTestTree(t, src, map[string]string{"big.bin": content})
+	info, _ := os.Stat(filepath.Join(src, "big.bin"))
+
+	// an interrupted copy left the first half, and a stale part of an older version
+	part := filepath.Join(dst, ".big.bin."+
+		strconv.FormatInt(info.Size(), 10)+"-"+strconv.FormatInt(info.ModTime().UnixNano(), 10)+copyTreePartSuffix)
+	if err := os.WriteFile(part, []byte(content[:500]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(dst, ".big.bin.1-1"+copyTreePartSuffix)
+	if err := os.WriteFile(stale, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var last CopyProgress
+	err := CopyTree(context.Background(), src, dst, CopyTreeOptions{Progress: func(p CopyProgress) { last = p }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "big.bin")); string(data) != content {
+		t.Fatal("unexpected content after resume")
+	}
+	if FileOrDirIsExist(part) || FileOrDirIsExist(stale) {
+		t.Fatal("partial files left")
+	}
+	if last.BytesDone != info.Size() {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+}
+
+func TestCopyTree_Canceled(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestTree(t, src, map[string]string{"a": "a", "b": "b"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := CopyTree(ctx, src, dst, CopyTreeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := CopyTree(context.Background(), src, filepath.Join(src, "sub"), CopyTreeOptions{}); err == nil {
+		t.Fatal("expected an error for a destination inside the source")
+	}
+}
@@ -370,7 +370,7 @@ func CopyDir(src, dst string, overwrite bool) error {
 		return os.CopyFS(dst, os.DirFS(src))
 	}
 	if !FileOrDirIsExist(dst) {
-		err := os.MkdirAll(dst, 0666)
+		err := os.MkdirAll(dst, 0755)
 		if err != nil {
 			return err
 		}
@@ -428,6 +428,21 @@ func IsChildDir2(parent, child string) bool {
 	return strings.HasPrefix(child, parent)
 }
 
+// IsSubPath reports whether child is parent or inside it. Unlike IsChildDir, the paths are
+// compared by their components: "/a/bc" is not inside "/a/b".
+func IsSubPath(parent, child string) bool {
+	parentAbs, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	childAbs, err := filepath.Abs(child)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(parentAbs, childAbs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // 获取当前程序的执行路径(包含可执行文件名称)
 // C:\Users\*\AppData\Local\Temp\*\exe\main.exe 或 .\main.exe
 // (读取命令参数的方式)
@@ -471,107 +486,32 @@ func ExecutionFilePath() (string, error) {
 // 最后一行为空也算读取了一行,会返回此行为空串,若全是空格也会原样返回。
 // 返回的每一行都不包含换行符号。
 func ReverseRead(name string, lineNum uint) ([]string, error) {
-	//打开文件
-	file, err := os.Open(name)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	//获取文件大小
-	fs, err := file.Stat()
-	if err != nil {
-		return nil, err
-	}
-	fileSize := fs.Size()
-
-	var offset int64 = -1   //偏移量，初始化为-1，若为0则会读到EOF
-	char := make([]byte, 1) //用于读取单个字节
-	lineStr := ""           //存放一行的数据
-	buff := make([]string, 0, 100)
-	for (-offset) <= fileSize {
-		//通过Seek函数从末尾移动游标然后每次读取一个字节，offset为偏移量
-		file.Seek(offset, io.SeekEnd)
-		_, err := file.Read(char)
+	buff := make([]string, 0, min(lineNum, 100))
+	for line, err := range ReverseFileLines(name) {
 		if err != nil {
 			return buff, err
 		}
-		if char[0] == '\n' {
-			//防止偏移量-2后越界
-			if fileSize-(-offset) >= 1 {
-				//判断文件类型为unix(LF)还是windows(CRLF)
-				file.Seek(-2, io.SeekCurrent) //io.SeekCurrent表示游标放置于当前位置，逆向偏移2个字节
-				//读完一个字节后游标会自动正向偏移一个字节
-				file.Read(char)
-				if char[0] == '\r' {
-					offset-- //windows跳过'\r'
-				}
-			}
-			lineNum-- //到此读取完一行
-			buff = append(buff, lineStr)
-			lineStr = ""
-			if lineNum == 0 {
-				return buff, nil
-			}
-		} else {
-			lineStr = string(char) + lineStr
+		buff = append(buff, line)
+		if uint(len(buff)) == lineNum {
+			break
 		}
-		offset--
 	}
-	buff = append(buff, lineStr)
 	return buff, nil
 }
 
 // 读取倒数第n行(n从1开始),
 // 若n大于文件行数则返回错误io.EOF。
 func ReadStartWithLastLine(filename string, n int) (string, error) {
-	//打开文件
-	file, err := os.Open(filename)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-	//获取文件大小
-	fs, err := file.Stat()
-	if err != nil {
-		return "", err
-	}
-	fileSize := fs.Size()
-
-	var offset int64 = -1   //偏移量，初始化为-1，若为0则会读到EOF
-	char := make([]byte, 1) //用于读取单个字节
-	lineStr := ""           //存放一行的数据
-	lineCount := 0          //行数
-	for (-offset) <= fileSize {
-		//通过Seek函数从末尾移动游标然后每次读取一个字节，offset为偏移量
-		file.Seek(offset, io.SeekEnd)
-		_, err := file.Read(char)
+	lineCount := 0
+	for line, err := range ReverseFileLines(filename) {
 		if err != nil {
 			return "", err
 		}
-		if char[0] == '\n' {
-			lineCount++
-			if lineCount == n {
-				return lineStr, nil
-			}
-			//判断文件类型为unix(LF)还是windows(CRLF)
-			file.Seek(-2, io.SeekCurrent) //io.SeekCurrent表示游标放置于当前位置，逆向偏移2个字节
-			//读完一个字节后游标会自动正向偏移一个字节
-			file.Read(char)
-			if char[0] == '\r' {
-				offset-- //windows跳过'\r'
-			}
-			offset--
-			continue
-		}
-		if lineCount == n-1 {
-			lineStr = string(char) + lineStr
+		if lineCount++; lineCount == n {
+			return line, nil
 		}
-		offset--
 	}
 	//到此文件已经从尾部读到头部
-	if lineCount == n-1 {
-		return lineStr, nil
-	}
 	return "", io.EOF
 }
 
@@ -594,7 +534,8 @@ func CreateShortcut(filename, dir string) error {
 	return os.Symlink(absPath, shortcut)
 }
 
-// Compress compresses the file to the zip file.
+// Compress compresses the files and folders to the zip file, a folder with its content.
+// The entries are named relative to the parent folder of each path, with their modes and times.
 func Compress(file []string, zipFile string) error {
 	//创建一个新的zip文件
 	fw, err := os.Create(zipFile)
@@ -604,35 +545,72 @@ func Compress(file []string, zipFile string) error {
 	defer fw.Close()
 	//创建一个新的zip writer
 	zw := zip.NewWriter(fw)
-	defer zw.Close()
-	//遍历所有文件
+	//遍历所有文件，文件夹连同其内容一起压缩，条目名为相对于其父文件夹的路径
 	for _, f := range file {
-		//打开文件
-		fr, err := os.Open(f)
+		parent := filepath.Dir(f)
+		err = filepath.WalkDir(f, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return addZipEntry(zw, parent, path, d)
+		})
 		if err != nil {
+			zw.Close()
 			return err
 		}
-		defer fr.Close()
-		//创建一个zip文件信息头
-		fw, err := zw.Create(f)
-		if err != nil {
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return fw.Close()
+}
 
-			return err
-		}
-		//将文件写入zip文件
-		_, err = io.Copy(fw, fr)
-		if err != nil {
-			return err
-		}
+// addZipEntry adds the file or directory path to zw, named relative to parent.
+func addZipEntry(zw *zip.Writer, parent, path string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
 	}
-	return nil
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+	rel, err := filepath.Rel(parent, path)
+	if err != nil {
+		return err
+	}
+	//创建一个zip文件信息头，保留权限和修改时间
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		header.Name += "/"
+		_, err = zw.CreateHeader(header)
+		return err
+	}
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	fr, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+	_, err = io.Copy(w, fr)
+	return err
 }
 
 // 解压
+//
+// UnCompress extracts zipFile into dest. Entries that would be written outside dest
+// (zip-slip) are rejected. The archive subpackage supports more formats and size limits.
 func UnCompress(zipFile, dest string) error {
 	//若目标文件夹不存在，则创建
-	if _, err := os.Stat(dest); os.IsNotExist(err) {
-		os.MkdirAll(dest, os.ModePerm)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
 	}
 	//打开zip文件
 	fr, err := zip.OpenReader(zipFile)
@@ -642,27 +620,49 @@ func UnCompress(zipFile, dest string) error {
 	defer fr.Close()
 	//遍历所有文件
 	for _, f := range fr.File {
-		//打开文件
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
-		//创建文件
-		fw, err := os.Create(dest + "/" + f.Name)
-		if err != nil {
-			return err
-		}
-		defer fw.Close()
-		//将文件写入磁盘
-		_, err = io.Copy(fw, rc)
-		if err != nil {
+		if err := extractZipEntry(f, dest); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func extractZipEntry(f *zip.File, dest string) error {
+	name := filepath.FromSlash(f.Name)
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("unsafe path in zip: %s", f.Name)
+	}
+	target := filepath.Join(dest, name)
+	if f.FileInfo().IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	perm := f.Mode().Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	fw, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	//将文件写入磁盘
+	if _, err = io.Copy(fw, rc); err != nil {
+		fw.Close()
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Now(), f.Modified)
+}
+
 // InitJsonConfig initializes a JSON configuration object of type T from a file.
 // If the file doesn't exist, it creates a default file using the createDefault function (or a default create function if not provided).
 // It uses JSON unmarshalling to parse the file content into the config object.
@@ -693,7 +693,7 @@ func InitConfig[T any](
 	createDefault func(path string) error,
 	unmarshal func(data []byte, v any) error,
 ) (*T, error) {
-	devConfigFilePath := generateDevConfigPath(configFilePath)
+	devConfigFilePath := DevConfigPath(configFilePath)
 	if FileIsExist(devConfigFilePath).IsTrue() {
 		return loadConfigFromFile[T](devConfigFilePath, unmarshal)
 	}
@@ -706,7 +706,9 @@ func InitConfig[T any](
 	return loadConfigFromFile[T](configFilePath, unmarshal)
 }
 
-func generateDevConfigPath(configFile string) string {
+// DevConfigPath returns the path of the development-specific configuration file of configFile,
+// e.g. "conf/config.json" -> "conf/config.local.dev.json".
+func DevConfigPath(configFile string) string {
 	var baseDir = filepath.Dir(configFile)
 	var fileName = filepath.Base(configFile)
 	var ext = filepath.Ext(fileName)
@@ -823,41 +825,40 @@ func GenerateUniqueFilepath(filePath string) string {
 	}
 }
 
+// WriteFile writes datas to filePath atomically, see AtomicWriter. A new file is created
+// with perm minus the umask, like os.WriteFile; an existing file keeps its mode and owner,
+// and is not replaced if it is not writable.
 func WriteFile(filePath string, perm fs.FileMode, datas ...[]byte) error {
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	w, err := NewAtomicWriter(filePath, AtomicWriteOptions{Perm: perm})
 	if err != nil {
 		return err
 	}
 	for _, data := range datas {
-		_, err = f.Write(data)
-		if err != nil {
+		if _, err = w.Write(data); err != nil {
+			_ = w.Abort()
 			return err
 		}
 	}
-	return f.Close()
+	return w.Close()
 }
 
+// WriteFileFromReader writes the content of data to filePath atomically, see WriteFile.
 func WriteFileFromReader(filePath string, perm fs.FileMode, data io.Reader) error {
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	w, err := NewAtomicWriter(filePath, AtomicWriteOptions{Perm: perm})
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(f, data)
-	if err != nil {
+	if _, err = w.ReadFrom(data); err != nil {
+		_ = w.Abort()
 		return err
 	}
-	return f.Close()
+	return w.Close()
 }
 
-// WriteFilePreservePerms writes data to a file named name, preserving existing permissions if the file exists.
-// If the file does not exist, it is created with permissions 0644 (rw-r--r--).
+// WriteFilePreservePerms writes data to a file named name atomically, preserving existing permissions if the file exists.
+// If the file does not exist, it is created with permissions 0644 (rw-r--r--) minus the umask.
 func WriteFilePreservePerms(name string, data []byte) error {
-	perm := fs.FileMode(0644)
-	f, err := os.Stat(name)
-	if err == nil {
-		perm = f.Mode()
-	}
-	return os.WriteFile(name, data, perm)
+	return WriteFileAtomic(name, data, AtomicWriteOptions{Perm: 0644})
 }
 
 func AppendFile(filePath string, data ...[]byte) error {
@@ -1,6 +1,7 @@
 package doraemon
 
 import (
+	"archive/zip"
 	"os"
 	"path/filepath"
 	"sync"
@@ -210,3 +211,39 @@ func TestListFilesRecursively(t *testing.T) {
 	}
 	t.Logf("Files: %v", files)
 }
+
+func TestCompressUnCompress(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src, map[string]string{"dir/sub/a.txt": "a", "b.txt": "b"})
+	if err := os.Chmod(filepath.Join(src, "b.txt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	zipFile := filepath.Join(t.TempDir(), "out.zip")
+	err := Compress([]string{filepath.Join(src, "dir"), filepath.Join(src, "b.txt")}, zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := UnCompress(zipFile, dest); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "dir", "sub", "a.txt")); string(data) != "a" {
+		t.Fatalf("unexpected content %q", data)
+	}
+	if info, _ := os.Stat(filepath.Join(dest, "b.txt")); info.Mode().Perm() != 0600 {
+		t.Fatalf("mode not preserved: %v", info.Mode())
+	}
+
+	evil := filepath.Join(t.TempDir(), "evil.zip")
+	f, _ := os.Create(evil)
+	zw := zip.NewWriter(f)
+	_, _ = zw.Create("../escaped")
+	_ = zw.Close()
+	_ = f.Close()
+	if err := UnCompress(evil, filepath.Join(dest, "x")); err == nil {
+		t.Fatal("expected an error for an unsafe path")
+	}
+	if FileOrDirIsExist(filepath.Join(dest, "escaped")) {
+		t.Fatal("file written outside the destination")
+	}
+}
@@ -0,0 +1,356 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultFilePollInterval = time.Second
+
+// WatchFile reports changes (write, create, remove, rename over) of a single file.
+// A value is sent on the returned channel when the file changes. At most one notification
+// is kept pending, a burst of writes may produce several notifications, callers should
+// debounce if needed.
+//
+// On Linux inotify is used to watch the parent directory of the file, so editors that
+// save by renaming a temporary file are also detected. On other platforms, or if inotify
+// is not available, the file is polled every pollInterval (default 1s).
+//
+// The channel is closed when ctx is done.
+func WatchFile(ctx context.Context, path string, pollInterval time.Duration) (<-chan struct{}, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultFilePollInterval
+	}
+	ch, err := watchFileNative(ctx, path)
+	if err == nil {
+		return ch, nil
+	}
+	return pollFile(ctx, path, pollInterval)
+}
+
+type fileState struct {
+	exist   bool
+	size    int64
+	modTime int64
+	mode    os.FileMode
+}
+
+func statFileState(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exist: true, size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+}
+
+func pollFile(ctx context.Context, path string, interval time.Duration) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	last := statFileState(path)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur := statFileState(path)
+			if cur == last {
+				continue
+			}
+			last = cur
+			select {
+			case ch <- struct{}{}:
+			default:
+				// a notification is already pending
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// EventOp is the kind of change of an Event, a set of bits.
+type EventOp uint32
+
+const (
+	// EventCreate is a file created, or moved into the tree.
+	EventCreate EventOp = 1 << iota
+	EventWrite
+	EventRemove
+	// EventRename is a file moved away, the new name is reported as EventCreate if it is in the tree.
+	EventRename
+	EventChmod
+	// EventOverflow reports that events were lost, e.g. the inotify queue overflowed.
+	// Its Path is the root, the whole tree should be rescanned.
+	EventOverflow
+)
+
+func (op EventOp) String() string {
+	var names []string
+	for _, n := range []struct {
+		op   EventOp
+		name string
+	}{{EventCreate, "CREATE"}, {EventWrite, "WRITE"}, {EventRemove, "REMOVE"}, {EventRename, "RENAME"},
+		{EventChmod, "CHMOD"}, {EventOverflow, "OVERFLOW"}} {
+		if op&n.op != 0 {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "NONE"
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a change of a file or directory reported by Watch.
+type Event struct {
+	// Path is the root joined with the path of the file in the tree.
+	Path string
+	// Op are the changes of the file during the debounce delay.
+	Op    EventOp
+	IsDir bool
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s", e.Op, e.Path)
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Include lists globs of the paths reported, all if empty, see MatchGlob.
+	// The directories are watched even if they do not match.
+	Include []string
+	// Ignore lists patterns of the paths neither watched nor reported, with the semantics of
+	// the lines of a .gitignore, e.g. "node_modules/", "*.log", "!keep.log", "/build".
+	Ignore []string
+	// Debounce is the delay without change after which the events are sent, 100ms if 0.
+	// The changes of a path during the delay are coalesced in one event.
+	Debounce time.Duration
+	// PollInterval is the period of the polling fallback, 1s if 0.
+	PollInterval time.Duration
+	// ForcePolling polls even if native watching is available, e.g. for network filesystems.
+	ForcePolling bool
+}
+
+const defaultWatchDebounce = 100 * time.Millisecond
+
+// Watch reports the changes of the files and directories under root, recursively. The
+// changes are debounced: the events of a burst are sent once no change happened for
+// opts.Debounce, one event per path, in the order the paths first changed.
+//
+// On Linux inotify watches each directory, and the new directories are watched as they are
+// created; their content is reported as created. On other platforms, or if inotify is not
+// available, the tree is polled every opts.PollInterval. When a new directory cannot be watched,
+// e.g. the watch limit is reached, an EventOverflow is sent for root and the tree is polled.
+//
+// When root itself is removed or moved, an EventRemove or EventRename is sent for it and the
+// channel is closed. Otherwise the channel is closed when ctx is done.
+func Watch(ctx context.Context, root string, opts WatchOptions) (<-chan Event, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", root)
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultWatchDebounce
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultFilePollInterval
+	}
+	filter := &watchFilter{root: root, include: opts.Include, ignore: newGitIgnore(opts.Ignore)}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var raw <-chan Event
+	if !opts.ForcePolling {
+		raw, err = watchTreeNative(ctx, filter, opts.PollInterval)
+	}
+	if opts.ForcePolling || err != nil {
+		raw = pollTree(ctx, filter, opts.PollInterval)
+	}
+	return debounceEvents(ctx, cancel, raw, opts.Debounce), nil
+}
+
+// watchFilter selects the paths watched and reported by Watch.
+type watchFilter struct {
+	root    string
+	include []string
+	ignore  *gitIgnore
+}
+
+// watched reports whether the slash separated relative path rel is not ignored.
+func (f *watchFilter) watched(rel string, isDir bool) bool {
+	return rel == "." || !f.ignore.ignored(rel, isDir)
+}
+
+// reported reports whether the changes of rel are sent.
+func (f *watchFilter) reported(rel string, isDir bool) bool {
+	return f.watched(rel, isDir) && (len(f.include) == 0 || MatchAnyGlob(f.include, rel))
+}
+
+func (f *watchFilter) event(rel string, op EventOp, isDir bool) Event {
+	return Event{Path: filepath.Join(f.root, filepath.FromSlash(rel)), Op: op, IsDir: isDir}
+}
+
+// walk calls fn for the paths under the directory rel that are not ignored, rel excluded.
+func (f *watchFilter) walk(rel string, fn func(rel string, d fs.DirEntry)) {
+	dir := filepath.Join(f.root, filepath.FromSlash(rel))
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			// a directory removed during the walk is reported by its own event
+			return nil
+		}
+		childRel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return nil
+		}
+		childRel = filepath.ToSlash(childRel)
+		if !f.watched(childRel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fn(childRel, d)
+		return nil
+	})
+}
+
+// pollTree compares snapshots of the tree every interval. The channel is closed after the
+// removal of the root is sent.
+func pollTree(ctx context.Context, f *watchFilter, interval time.Duration) <-chan Event {
+	ch := make(chan Event)
+	snapshot := func() map[string]fileState {
+		states := make(map[string]fileState)
+		f.walk(".", func(rel string, d fs.DirEntry) {
+			if info, err := d.Info(); err == nil {
+				states[rel] = fileState{exist: true, size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+			}
+		})
+		return states
+	}
+	last := snapshot()
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if _, err := os.Stat(f.root); errors.Is(err, fs.ErrNotExist) {
+				select {
+				case ch <- Event{Path: f.root, Op: EventRemove, IsDir: true}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			cur := snapshot()
+			var events []Event
+			for rel, state := range cur {
+				old, ok := last[rel]
+				isDir := state.mode.IsDir()
+				switch {
+				case !ok:
+					events = append(events, f.event(rel, EventCreate, isDir))
+				case old.mode != state.mode && old.mode.Type() == state.mode.Type():
+					events = append(events, f.event(rel, EventChmod, isDir))
+				case old.mode.Type() != state.mode.Type():
+					events = append(events, f.event(rel, EventRemove|EventCreate, isDir))
+				case !isDir && (old.size != state.size || old.modTime != state.modTime):
+					events = append(events, f.event(rel, EventWrite, isDir))
+				}
+			}
+			for rel, state := range last {
+				if _, ok := cur[rel]; !ok {
+					events = append(events, f.event(rel, EventRemove, state.mode.IsDir()))
+				}
+			}
+			last = cur
+			// the parents first, like the order of the native events
+			slices.SortFunc(events, func(a, b Event) int { return strings.Compare(a.Path, b.Path) })
+			for _, e := range events {
+				rel, _ := filepath.Rel(f.root, e.Path)
+				if !f.reported(filepath.ToSlash(rel), e.IsDir) {
+					continue
+				}
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// debounceEvents coalesces the events of raw by path, and sends them once no event was
+// received for delay, or at most every 10 delays during a continuous stream of events.
+// When raw is closed, the pending events are sent and cancel is called. The returned channel
+// is closed when ctx is done or raw is closed.
+func debounceEvents(ctx context.Context, cancel context.CancelFunc, raw <-chan Event, delay time.Duration) <-chan Event {
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		defer cancel()
+		var pending []Event
+		index := make(map[string]int)
+		var first time.Time
+		timer := time.NewTimer(delay)
+		timer.Stop()
+		flush := func() bool {
+			for _, e := range pending {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			pending = pending[:0]
+			clear(index)
+			return true
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e, ok := <-raw:
+				if !ok {
+					flush()
+					return
+				}
+				if len(pending) == 0 {
+					first = time.Now()
+				}
+				if i, ok := index[e.Path]; ok {
+					pending[i].Op |= e.Op
+					pending[i].IsDir = e.IsDir
+				} else {
+					index[e.Path] = len(pending)
+					pending = append(pending, e)
+				}
+				if time.Since(first) < 10*delay {
+					timer.Reset(delay)
+				}
+			case <-timer.C:
+				if !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
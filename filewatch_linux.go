@@ -0,0 +1,311 @@
+//go:build linux
+
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const fileWatchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM
+
+// watchFileNative watches the parent directory of path with inotify and filters
+// the events by file name.
+func watchFileNative(ctx context.Context, path string) (<-chan struct{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := filepath.Split(absPath)
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err = syscall.InotifyAddWatch(fd, dir, fileWatchMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// A non-blocking fd is registered with the runtime poller,
+	// so closing the file unblocks the pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+	go func() {
+		defer close(ch)
+		var buf [4096]byte
+		for {
+			n, err := f.Read(buf[:])
+			if err != nil {
+				return
+			}
+			matched := false
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				if inotifyEventName(nameBytes) == name {
+					matched = true
+				}
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+			}
+			if !matched {
+				continue
+			}
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// inotifyEventName trims the NUL padding of the name in an inotify event.
+func inotifyEventName(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+const treeWatchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// inotifyTree watches each directory of a tree with inotify. It is only used by the goroutine
+// reading the events.
+type inotifyTree struct {
+	fd int
+	// conn is set once the fd is owned by an os.File, the watches are changed through it
+	// so that the fd is not used after the file is closed
+	conn   syscall.RawConn
+	filter *watchFilter
+	dirs   map[int32]string // watch descriptor to slash separated relative path
+	wds    map[string]int32
+	events []Event
+	// rootGone is set when the root is removed or moved, the watch ends
+	rootGone bool
+	// err is the first error of a new directory watch, e.g. the watch limit is reached
+	err error
+}
+
+// watchTreeNative watches the tree of filter.root with inotify, see Watch. When a new directory
+// cannot be watched, e.g. the watch limit is reached, an EventOverflow is sent and the tree is
+// polled every pollInterval instead.
+func watchTreeNative(ctx context.Context, filter *watchFilter, pollInterval time.Duration) (<-chan Event, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	t := &inotifyTree{fd: fd, filter: filter, dirs: make(map[int32]string), wds: make(map[string]int32)}
+	if err := t.addTree(".", false); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "inotify")
+	if t.conn, err = f.SyscallConn(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	watchCtx, stop := context.WithCancel(ctx)
+	go func() {
+		<-watchCtx.Done()
+		f.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer stop()
+		send := func(e Event) bool {
+			select {
+			case ch <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				t.handle(event.Wd, event.Mask, inotifyEventName(nameBytes))
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+			}
+			for _, e := range t.events {
+				if !send(e) {
+					return
+				}
+			}
+			t.events = t.events[:0]
+			if t.rootGone {
+				return
+			}
+			if t.err != nil {
+				// some directories are not watched, their changes would be missed
+				stop()
+				if !send(Event{Path: filter.root, Op: EventOverflow, IsDir: true}) {
+					return
+				}
+				for e := range pollTree(ctx, filter, pollInterval) {
+					if !send(e) {
+						return
+					}
+				}
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// addTree watches the directory rel and its subdirectories. With report, their content is
+// reported as created, it may have been created before the watches.
+func (t *inotifyTree) addTree(rel string, report bool) error {
+	if err := t.addWatch(rel); err != nil {
+		return err
+	}
+	var walkErr error
+	t.filter.walk(rel, func(childRel string, d fs.DirEntry) {
+		if d.IsDir() {
+			if err := t.addWatch(childRel); err != nil && walkErr == nil {
+				walkErr = err
+			}
+		}
+		if report {
+			t.report(childRel, EventCreate, d.IsDir())
+		}
+	})
+	return walkErr
+}
+
+// control calls fn with the inotify fd, it fails once the fd is closed.
+func (t *inotifyTree) control(fn func(fd int)) error {
+	if t.conn == nil {
+		fn(t.fd)
+		return nil
+	}
+	return t.conn.Control(func(fd uintptr) { fn(int(fd)) })
+}
+
+func (t *inotifyTree) addWatch(rel string) error {
+	var wd int
+	var err error
+	if cerr := t.control(func(fd int) {
+		wd, err = syscall.InotifyAddWatch(fd, filepath.Join(t.filter.root, filepath.FromSlash(rel)), treeWatchMask)
+	}); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+			// removed since it was listed
+			return nil
+		}
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	// a directory moved within the tree keeps its watch descriptor
+	if old, ok := t.dirs[int32(wd)]; ok {
+		delete(t.wds, old)
+	}
+	t.dirs[int32(wd)] = rel
+	t.wds[rel] = int32(wd)
+	return nil
+}
+
+// removeTree forgets the watches of the directory rel and its subdirectories, e.g. moved out of the tree.
+func (t *inotifyTree) removeTree(rel string) {
+	for dir, wd := range t.wds {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			_ = t.control(func(fd int) { _, _ = syscall.InotifyRmWatch(fd, uint32(wd)) })
+			delete(t.wds, dir)
+			delete(t.dirs, wd)
+		}
+	}
+}
+
+func (t *inotifyTree) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		t.events = append(t.events, Event{Path: t.filter.root, Op: EventOverflow, IsDir: true})
+		return
+	}
+	dir, ok := t.dirs[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// the directory was removed, its parent reports it
+		delete(t.dirs, wd)
+		if t.wds[dir] == wd {
+			delete(t.wds, dir)
+		}
+		return
+	}
+	if name == "" {
+		// an event of the directory itself, reported by its parent, except for the root
+		if dir == "." && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+			op := EventRemove
+			if mask&syscall.IN_MOVE_SELF != 0 {
+				op = EventRename
+			}
+			t.events = append(t.events, Event{Path: t.filter.root, Op: op, IsDir: true})
+			t.rootGone = true
+		}
+		return
+	}
+	rel := path.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if !t.filter.watched(rel, isDir) {
+		return
+	}
+	var op EventOp
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		op = EventCreate
+	case mask&syscall.IN_MOVED_FROM != 0:
+		op = EventRename
+		if isDir {
+			t.removeTree(rel)
+		}
+	case mask&syscall.IN_DELETE != 0:
+		op = EventRemove
+	case mask&(syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE) != 0:
+		op = EventWrite
+	case mask&syscall.IN_ATTRIB != 0:
+		op = EventChmod
+	default:
+		return
+	}
+	t.report(rel, op, isDir)
+	if op == EventCreate && isDir {
+		// the new directory may already have content
+		if err := t.addTree(rel, true); err != nil && t.err == nil {
+			t.err = err
+		}
+	}
+}
+
+func (t *inotifyTree) report(rel string, op EventOp, isDir bool) {
+	if t.filter.reported(rel, isDir) {
+		t.events = append(t.events, t.filter.event(rel, op, isDir))
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+func watchFileNative(ctx context.Context, path string) (<-chan struct{}, error) {
+	return nil, errors.New("native file watching is not supported on this platform")
+}
+
+func watchTreeNative(ctx context.Context, filter *watchFilter, pollInterval time.Duration) (<-chan Event, error) {
+	return nil, errors.New("native file watching is not supported on this platform")
+}
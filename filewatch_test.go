@@ -0,0 +1,201 @@
+package doraemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// collectEvents returns the ops of the events by relative path, until no event is received for quiet.
+func collectEvents(t *testing.T, root string, ch <-chan Event, quiet time.Duration) map[string]EventOp {
+	t.Helper()
+	events := make(map[string]EventOp)
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return events
+			}
+			rel, err := filepath.Rel(root, e.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events[filepath.ToSlash(rel)] |= e.Op
+		case <-time.After(quiet):
+			return events
+		}
+	}
+}
+
+func testWatch(t *testing.T, opts WatchOptions, quiet time.Duration) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{"old.txt": "old", "build/out.o": "o"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts.Ignore = []string{"*.log", "build/", "!keep.log"}
+	opts.Debounce = 50 * time.Millisecond
+	ch, err := Watch(ctx, root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestTree(t, root, map[string]string{
+		"a.txt":           "a",
+		"sub/x/y.txt":     "y",
+		"debug.log":       "ignored",
+		"keep.log":        "kept",
+		"build/new.o":     "ignored",
+		"sub/x/trace.log": "ignored",
+	})
+	if err := os.Remove(filepath.Join(root, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	events := collectEvents(t, root, ch, quiet)
+	for path, op := range map[string]EventOp{"a.txt": EventCreate, "sub": EventCreate, "sub/x": EventCreate,
+		"sub/x/y.txt": EventCreate, "keep.log": EventCreate, "old.txt": EventRemove} {
+		if events[path]&op == 0 {
+			t.Errorf("%s: got %s, want %s", path, events[path], op)
+		}
+	}
+	for _, path := range []string{"debug.log", "build/new.o", "sub/x/trace.log"} {
+		if _, ok := events[path]; ok {
+			t.Errorf("ignored %s reported", path)
+		}
+	}
+
+	// the new directories are watched
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(root, "sub/x/y.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events = collectEvents(t, root, ch, quiet)
+	if events["sub/x/y.txt"]&EventWrite == 0 {
+		t.Fatalf("write in a new directory not reported: %v", events)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatch(t *testing.T) {
+	testWatch(t, WatchOptions{}, 300*time.Millisecond)
+}
+
+func TestWatch_Polling(t *testing.T) {
+	testWatch(t, WatchOptions{ForcePolling: true, PollInterval: 20 * time.Millisecond}, 300*time.Millisecond)
+}
+
+func TestWatch_RootRemoved(t *testing.T) {
+	for _, opts := range []WatchOptions{{}, {ForcePolling: true, PollInterval: 20 * time.Millisecond}} {
+		root := filepath.Join(t.TempDir(), "root")
+		writeTestTree(t, root, map[string]string{"a.txt": "a"})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		opts.Debounce = 20 * time.Millisecond
+		ch, err := Watch(ctx, root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.RemoveAll(root); err != nil {
+			t.Fatal(err)
+		}
+		var rootOp EventOp
+		timeout := time.After(2 * time.Second)
+	loop:
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					break loop
+				}
+				if e.Path == root {
+					rootOp |= e.Op
+				}
+			case <-timeout:
+				t.Fatalf("polling %v: channel not closed after the root was removed", opts.ForcePolling)
+			}
+		}
+		if rootOp&EventRemove == 0 {
+			t.Fatalf("polling %v: root removal not reported, got %s", opts.ForcePolling, rootOp)
+		}
+	}
+}
+
+func TestWatch_IncludeAndDebounce(t *testing.T) {
+	root := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := Watch(ctx, root, WatchOptions{Include: []string{"*.go"}, Debounce: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(root, "main.go")
+	for i := 0; i < 5; i++ {
+		if err := AppendFile(name, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestTree(t, root, map[string]string{"README.md": "r"})
+	var got []Event
+	timeout := time.After(time.Second)
+	for len(got) == 0 {
+		select {
+		case e := <-ch:
+			got = append(got, e)
+		case <-timeout:
+			t.Fatal("no event")
+		}
+	}
+	// the burst is a single event
+	select {
+	case e := <-ch:
+		got = append(got, e)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if len(got) != 1 || got[0].Path != name || got[0].Op != EventCreate|EventWrite {
+		t.Fatalf("unexpected events %v", got)
+	}
+
+	if _, err := Watch(ctx, name, WatchOptions{}); err == nil {
+		t.Fatal("expected an error for a file root")
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+	g := newGitIgnore([]string{
+		"# comment",
+		"*.log",
+		"!important.log",
+		"node_modules/",
+		"/dist",
+		"docs/**/*.tmp",
+		"\\#literal",
+	})
+	for _, c := range []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.log", false, true},
+		{"deep/dir/a.log", false, true},
+		{"important.log", false, false},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"web/node_modules/pkg/index.js", false, true},
+		{"dist", true, true},
+		{"dist/app.js", false, true},
+		{"src/dist", true, false},
+		{"docs/a/b/c.tmp", false, true},
+		{"docs/c.tmp", false, true},
+		{"c.tmp", false, false},
+		{"#literal", false, true},
+		{"main.go", false, false},
+	} {
+		if got := g.ignored(c.path, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, %v) = %v, want %v", c.path, c.isDir, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package doraemon
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash separated relative path name matches pattern.
+// A pattern without a slash matches the base name, e.g. "*.tmp"; otherwise it matches
+// the whole path, with "**" matching any number of directories, e.g. "build/**/*.o".
+// A malformed pattern matches nothing.
+func MatchGlob(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// MatchAnyGlob reports whether name matches one of patterns, see MatchGlob.
+func MatchAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchGlob(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// gitIgnore matches paths against patterns with the semantics of .gitignore: a pattern
+// without a slash, or with only a trailing one, matches at any depth; other patterns are
+// relative to the root; a trailing slash only matches directories; "!" re-includes a path;
+// the last matching pattern wins; the content of an ignored directory is ignored.
+type gitIgnore struct {
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// newGitIgnore parses the lines of a .gitignore, blank lines and comments are skipped.
+func newGitIgnore(lines []string) *gitIgnore {
+	g := &gitIgnore{}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\") {
+			// \# and \! are literal
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		p.segments = strings.Split(line, "/")
+		g.patterns = append(g.patterns, p)
+	}
+	return g
+}
+
+// ignored reports whether the slash separated relative path name, or one of its parent
+// directories, is ignored.
+func (g *gitIgnore) ignored(name string, isDir bool) bool {
+	if g == nil || len(g.patterns) == 0 {
+		return false
+	}
+	segments := strings.Split(name, "/")
+	for i := 1; i < len(segments); i++ {
+		if g.match(segments[:i], true) {
+			return true
+		}
+	}
+	return g.match(segments, isDir)
+}
+
+func (g *gitIgnore) match(segments []string, isDir bool) bool {
+	ignored := false
+	for _, p := range g.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchGlobSegments(p.segments, segments) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
@@ -6,6 +6,7 @@ require (
 	github.com/arduino/go-win32-utils v1.0.0
 	github.com/axgle/mahonia v0.0.0-20180208002826-3358181d7394
 	github.com/cenkalti/backoff/v5 v5.0.3
+	github.com/cespare/xxhash/v2 v2.3.0
 	github.com/ebitengine/purego v0.8.4
 	github.com/ethereum/go-ethereum v1.16.1
 	github.com/fatih/color v1.18.0
@@ -13,6 +14,7 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/google/gousb v1.1.3
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.17.11
 	github.com/leibnewton/winapi v0.1.2
 	github.com/lxn/win v0.0.0-20210218163916-a377121e959e
 	github.com/mutagen-io/mutagen v0.18.1
@@ -27,6 +29,7 @@ require (
 	golang.org/x/net v0.42.0
 	golang.org/x/sys v0.34.0
 	golang.org/x/text v0.27.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -84,5 +87,4 @@ require (
 	golang.org/x/term v0.33.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
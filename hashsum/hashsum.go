@@ -0,0 +1,186 @@
+// Package hashsum computes several digests of a content in a single read, hashes directory
+// trees in parallel, and writes and verifies manifests in the format of sha256sum.
+//
+//	h := hashsum.NewMultiHasher(hashsum.MD5, hashsum.SHA256)
+//	io.Copy(h, f)
+//	fmt.Println(h.Hex(hashsum.MD5), h.Hex(hashsum.SHA256))
+package hashsum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algorithm is a hash algorithm. The zero value is no algorithm, it selects a default in the options.
+type Algorithm int
+
+const (
+	MD5 Algorithm = iota + 1
+	SHA1
+	SHA256
+	SHA512
+	// BLAKE2b is BLAKE2b-512, the algorithm of b2sum.
+	BLAKE2b
+	// CRC32 is the IEEE CRC-32.
+	CRC32
+	// XXHash is the 64-bit xxHash (XXH64).
+	XXHash
+)
+
+// Algorithms lists all the algorithms.
+var Algorithms = []Algorithm{MD5, SHA1, SHA256, SHA512, BLAKE2b, CRC32, XXHash}
+
+var algorithmNames = map[Algorithm]string{
+	MD5:     "md5",
+	SHA1:    "sha1",
+	SHA256:  "sha256",
+	SHA512:  "sha512",
+	BLAKE2b: "blake2b",
+	CRC32:   "crc32",
+	XXHash:  "xxhash",
+}
+
+func (a Algorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// ParseAlgorithm returns the algorithm named name, e.g. "sha256" or "SHA-256".
+func ParseAlgorithm(name string) (Algorithm, error) {
+	name = strings.ReplaceAll(strings.ToLower(name), "-", "")
+	for a, n := range algorithmNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("hashsum: unknown algorithm %q", name)
+}
+
+// New returns a new hash of the algorithm, it panics for an unknown algorithm.
+func (a Algorithm) New() hash.Hash {
+	switch a {
+	case MD5:
+		return md5.New()
+	case SHA1:
+		return sha1.New()
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	case BLAKE2b:
+		h, _ := blake2b.New512(nil) // only fails for a too long key
+		return h
+	case CRC32:
+		return crc32.NewIEEE()
+	case XXHash:
+		return xxhash.New()
+	}
+	panic("hashsum: unknown algorithm " + a.String())
+}
+
+// MultiHasher is an io.Writer computing the digests of several algorithms at once, so a large
+// file is read once whatever the number of digests.
+type MultiHasher struct {
+	algorithms []Algorithm
+	hashes     []hash.Hash
+	w          io.Writer
+	size       int64
+}
+
+// NewMultiHasher returns a MultiHasher of algorithms, or of all the Algorithms if none is given.
+func NewMultiHasher(algorithms ...Algorithm) *MultiHasher {
+	if len(algorithms) == 0 {
+		algorithms = Algorithms
+	}
+	m := &MultiHasher{algorithms: algorithms}
+	writers := make([]io.Writer, len(algorithms))
+	for i, a := range algorithms {
+		h := a.New()
+		m.hashes = append(m.hashes, h)
+		writers[i] = h
+	}
+	m.w = io.MultiWriter(writers...)
+	return m
+}
+
+// Write adds p to all the hashes, it never returns an error.
+func (m *MultiHasher) Write(p []byte) (int, error) {
+	n, err := m.w.Write(p)
+	m.size += int64(n)
+	return n, err
+}
+
+// Size returns the number of bytes written.
+func (m *MultiHasher) Size() int64 {
+	return m.size
+}
+
+// Reset resets all the hashes.
+func (m *MultiHasher) Reset() {
+	for _, h := range m.hashes {
+		h.Reset()
+	}
+	m.size = 0
+}
+
+// Algorithms returns the algorithms of the hasher.
+func (m *MultiHasher) Algorithms() []Algorithm {
+	return m.algorithms
+}
+
+// Sum returns the digest of a, or nil if a is not an algorithm of the hasher.
+func (m *MultiHasher) Sum(a Algorithm) []byte {
+	for i, alg := range m.algorithms {
+		if alg == a {
+			return m.hashes[i].Sum(nil)
+		}
+	}
+	return nil
+}
+
+// Hex returns the lowercase hex digest of a, or "" if a is not an algorithm of the hasher.
+func (m *MultiHasher) Hex(a Algorithm) string {
+	return hex.EncodeToString(m.Sum(a))
+}
+
+// Sums returns the hex digests of all the algorithms.
+func (m *MultiHasher) Sums() map[Algorithm]string {
+	sums := make(map[Algorithm]string, len(m.algorithms))
+	for i, a := range m.algorithms {
+		sums[a] = hex.EncodeToString(m.hashes[i].Sum(nil))
+	}
+	return sums
+}
+
+// HashReader reads r to the end and returns its hex digests, see NewMultiHasher.
+func HashReader(r io.Reader, algorithms ...Algorithm) (map[Algorithm]string, error) {
+	m := NewMultiHasher(algorithms...)
+	if _, err := io.Copy(m, r); err != nil {
+		return nil, err
+	}
+	return m.Sums(), nil
+}
+
+// HashFile returns the hex digests of the file name, see NewMultiHasher.
+func HashFile(name string, algorithms ...Algorithm) (map[Algorithm]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return HashReader(f, algorithms...)
+}
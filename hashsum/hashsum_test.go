@@ -0,0 +1,138 @@
+package hashsum
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiHasher(t *testing.T) {
+	h := NewMultiHasher()
+	if _, err := h.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[Algorithm]string{
+		MD5:     "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		SHA1:    "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed",
+		SHA256:  "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		SHA512:  "309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+		BLAKE2b: "021ced8799296ceca557832ab941a50b4a11f83478cf141f51f933f653ab9fbcc05a037cddbed06e309bf334942c4e58cdf1a46e237911ccd7fcf9787cbc7fd0",
+		CRC32:   "0d4a1185",
+		XXHash:  "45ab6734b21e6968",
+	}
+	sums := h.Sums()
+	for a, sum := range want {
+		if sums[a] != sum || h.Hex(a) != sum {
+			t.Errorf("%s = %s, want %s", a, sums[a], sum)
+		}
+	}
+	if h.Size() != 11 {
+		t.Fatalf("size %d", h.Size())
+	}
+
+	h = NewMultiHasher(SHA256)
+	if h.Sum(MD5) != nil {
+		t.Fatal("digest of an algorithm not computed")
+	}
+	if a, err := ParseAlgorithm("SHA-256"); err != nil || a != SHA256 {
+		t.Fatalf("ParseAlgorithm = %v, %v", a, err)
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/skip.tmp": "x", "cache/c": "c"})
+	files, err := HashTree(context.Background(), root, TreeOptions{
+		Algorithms: []Algorithm{MD5, CRC32},
+		Workers:    2,
+		Exclude:    []string{"*.tmp", "cache"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Path != "a.txt" || files[1].Path != "sub/b.txt" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if files[0].Sums[MD5] != "0cc175b9c0f1b6a831c399e269772661" || files[0].Size != 1 {
+		t.Fatalf("unexpected sums %+v", files[0])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := HashTree(ctx, root, TreeOptions{}); err == nil {
+		t.Fatal("expected an error for a canceled context")
+	}
+}
+
+func TestManifest_Verify(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{"a.txt": "a", "sub/b.txt": "b", "gone.txt": "g"})
+	manifest := filepath.Join(root, "SHA256SUMS")
+	if err := CreateManifest(context.Background(), root, manifest, TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(manifest)
+	want := "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb  a.txt\n"
+	if !strings.HasPrefix(string(data), want) || strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("unexpected manifest:\n%s", data)
+	}
+
+	report, err := Verify(context.Background(), manifest, VerifyOptions{})
+	if err != nil || !report.Passed() || len(report.OK) != 3 {
+		t.Fatalf("Verify = %+v, %v", report, err)
+	}
+
+	writeFiles(t, root, map[string]string{"sub/b.txt": "changed", "new.txt": "n"})
+	os.Remove(filepath.Join(root, "gone.txt"))
+	report, err = Verify(context.Background(), manifest, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReport := "a.txt: OK\nsub/b.txt: MODIFIED\ngone.txt: MISSING\nnew.txt: EXTRA\n"
+	if report.Passed() || report.String() != wantReport {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	sum := strings.Repeat("ab", 16)
+	var buf bytes.Buffer
+	files := []FileSum{{Path: "dir/we\\ird\nname", Sums: map[Algorithm]string{MD5: sum}}, {Path: "plain", Sums: map[Algorithm]string{MD5: sum}}}
+	if err := WriteManifest(&buf, MD5, files); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "\\"+sum+"  dir/we\\\\ird\\nname\n") {
+		t.Fatalf("unexpected manifest %q", buf.String())
+	}
+	buf.WriteString(strings.ToUpper(sum) + " *./bin/tool\r\n\n")
+	entries, err := ReadManifest(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Path != files[0].Path || entries[1].Path != "plain" ||
+		entries[2] != (ManifestEntry{Sum: sum, Path: "bin/tool", Binary: true}) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if _, err := ReadManifest(strings.NewReader("xyz  file\n")); err == nil {
+		t.Fatal("expected an error for a malformed digest")
+	}
+	if a, err := AlgorithmFromDigest(sum); err != nil || a != MD5 {
+		t.Fatalf("AlgorithmFromDigest = %v, %v", a, err)
+	}
+}
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
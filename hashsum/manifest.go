@@ -0,0 +1,304 @@
+package hashsum
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// ManifestEntry is a line of a manifest.
+type ManifestEntry struct {
+	// Sum is the lowercase hex digest of the file.
+	Sum string
+	// Path is the slash separated path of the file, relative to the root of the tree.
+	Path string
+	// Binary is the "*" mark of sha256sum --binary, it has no effect on the digest.
+	Binary bool
+}
+
+// WriteManifest writes the digests of algorithm of files in the format of sha256sum:
+//
+//	<hex digest>  <path>
+//
+// Like GNU coreutils, a path containing a backslash or a newline is escaped and its line
+// starts with a backslash. The files must have a digest of algorithm, see TreeOptions.Algorithms.
+func WriteManifest(w io.Writer, algorithm Algorithm, files []FileSum) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range files {
+		sum, ok := f.Sums[algorithm]
+		if !ok {
+			return fmt.Errorf("hashsum: no %s digest for %s", algorithm, f.Path)
+		}
+		name := f.Path
+		if strings.ContainsAny(name, "\\\n") {
+			name = strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(name)
+			bw.WriteByte('\\')
+		}
+		bw.WriteString(sum)
+		bw.WriteString("  ")
+		bw.WriteString(name)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadManifest parses a manifest in the format of sha256sum, see WriteManifest.
+// Empty lines are ignored.
+func ReadManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		if !ok || name == "" || len(sum)%2 != 0 {
+			return nil, fmt.Errorf("hashsum: manifest line %d: malformed", lineNum)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("hashsum: manifest line %d: malformed digest", lineNum)
+		}
+		e := ManifestEntry{Sum: strings.ToLower(sum)}
+		// the mode character is " " for text and "*" for binary
+		switch name[0] {
+		case '*':
+			e.Binary = true
+			name = name[1:]
+		case ' ':
+			name = name[1:]
+		}
+		if escaped {
+			name = unescapeManifestPath(name)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("hashsum: manifest line %d: malformed", lineNum)
+		}
+		e.Path = path.Clean(filepath.ToSlash(name))
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func unescapeManifestPath(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			i++
+			switch name[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(name[i])
+			}
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// CreateManifest hashes the tree root and writes the manifest file name atomically, with the
+// digests of the first of opts.Algorithms, SHA256 by default. The manifest itself is excluded
+// when it is inside root.
+func CreateManifest(ctx context.Context, root, name string, opts TreeOptions) error {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []Algorithm{SHA256}
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	self, _ := relativeTo(root, name)
+	paths, err := listTree(root, opts.Exclude, self)
+	if err != nil {
+		return err
+	}
+	files, err := hashFiles(ctx, root, paths, opts.Algorithms[:1], opts.Workers)
+	if err != nil {
+		return err
+	}
+	w, err := doraemon.NewAtomicWriter(name, doraemon.AtomicWriteOptions{Perm: 0644})
+	if err != nil {
+		return err
+	}
+	if err := WriteManifest(w, opts.Algorithms[0], files); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Close()
+}
+
+// relativeTo returns the slash separated path of name relative to root, if name is inside root.
+func relativeTo(root, name string) (string, bool) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return "", false
+	}
+	nameAbs, err := filepath.Abs(name)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(rootAbs, nameAbs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// AlgorithmFromDigest returns the algorithm of a hex digest from its length. The 128 digits of
+// SHA512 and BLAKE2b are ambiguous, SHA512 is returned.
+func AlgorithmFromDigest(sum string) (Algorithm, error) {
+	switch len(sum) {
+	case 8:
+		return CRC32, nil
+	case 16:
+		return XXHash, nil
+	case 32:
+		return MD5, nil
+	case 40:
+		return SHA1, nil
+	case 64:
+		return SHA256, nil
+	case 128:
+		return SHA512, nil
+	}
+	return 0, fmt.Errorf("hashsum: no algorithm with %d hex digits", len(sum))
+}
+
+// VerifyOptions configures Verify.
+type VerifyOptions struct {
+	// Root is the directory the paths of the manifest are relative to, the directory of the
+	// manifest if empty.
+	Root string
+	// Algorithm of the digests of the manifest, detected from their length if 0, see AlgorithmFromDigest.
+	Algorithm Algorithm
+	// Workers is the number of files hashed in parallel, runtime.NumCPU() if 0.
+	Workers int
+	// Exclude lists globs of paths that are not reported as extra files, see doraemon.MatchGlob.
+	Exclude []string
+}
+
+// VerifyReport is the result of Verify, each list holds slash separated paths, sorted.
+type VerifyReport struct {
+	// OK are the files matching their digest.
+	OK []string
+	// Missing are the files of the manifest that do not exist.
+	Missing []string
+	// Modified are the files whose digest differs from the manifest.
+	Modified []string
+	// Extra are the files of the root that are not in the manifest.
+	Extra []string
+}
+
+// Passed reports whether all the files of the manifest match and no file was added.
+func (r *VerifyReport) Passed() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0 && len(r.Extra) == 0
+}
+
+// String returns a line per file, like sha256sum --check:
+//
+//	a.txt: OK
+//	b.txt: MODIFIED
+//	c.txt: MISSING
+//	d.txt: EXTRA
+func (r *VerifyReport) String() string {
+	var b strings.Builder
+	for _, group := range []struct {
+		status string
+		paths  []string
+	}{{"OK", r.OK}, {"MODIFIED", r.Modified}, {"MISSING", r.Missing}, {"EXTRA", r.Extra}} {
+		for _, p := range group.paths {
+			fmt.Fprintf(&b, "%s: %s\n", p, group.status)
+		}
+	}
+	return b.String()
+}
+
+// Verify checks the tree of the manifest file name against its digests, and reports the missing,
+// modified and extra files. The manifest itself is not an extra file.
+func Verify(ctx context.Context, name string, opts VerifyOptions) (*VerifyReport, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ReadManifest(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Root == "" {
+		opts.Root = filepath.Dir(name)
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	algorithm := opts.Algorithm
+	if algorithm == 0 && len(entries) > 0 {
+		if algorithm, err = AlgorithmFromDigest(entries[0].Sum); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &VerifyReport{}
+	expected := make(map[string]string, len(entries))
+	var present []string
+	for _, e := range entries {
+		expected[e.Path] = e.Sum
+		info, err := os.Stat(treePath(opts.Root, e.Path))
+		if errors.Is(err, fs.ErrNotExist) || err == nil && !info.Mode().IsRegular() {
+			report.Missing = append(report.Missing, e.Path)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		present = append(present, e.Path)
+	}
+	files, err := hashFiles(ctx, opts.Root, present, []Algorithm{algorithm}, opts.Workers)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Sums[algorithm] == expected[f.Path] {
+			report.OK = append(report.OK, f.Path)
+		} else {
+			report.Modified = append(report.Modified, f.Path)
+		}
+	}
+
+	self, _ := relativeTo(opts.Root, name)
+	all, err := listTree(opts.Root, opts.Exclude, self)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range all {
+		if _, ok := expected[p]; !ok {
+			report.Extra = append(report.Extra, p)
+		}
+	}
+
+	for _, list := range [][]string{report.OK, report.Missing, report.Modified} {
+		slices.Sort(list)
+	}
+	return report, nil
+}
@@ -0,0 +1,158 @@
+package hashsum
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// TreeOptions configures HashTree.
+type TreeOptions struct {
+	// Algorithms are the digests computed for each file, SHA256 if empty.
+	Algorithms []Algorithm
+	// Workers is the number of files hashed in parallel, runtime.NumCPU() if 0.
+	Workers int
+	// Exclude lists globs of paths that are not hashed, see doraemon.MatchGlob.
+	Exclude []string
+}
+
+// FileSum is the digests of a file of a tree.
+type FileSum struct {
+	// Path is the slash separated path of the file, relative to the root of the tree.
+	Path string
+	Size int64
+	Sums map[Algorithm]string
+}
+
+// HashTree returns the digests of the regular files under root, sorted by path. Each file is
+// read once whatever the number of algorithms. Symbolic links and other special files are
+// skipped.
+//
+// It stops at the first error, or when ctx is done.
+func HashTree(ctx context.Context, root string, opts TreeOptions) ([]FileSum, error) {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []Algorithm{SHA256}
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+	paths, err := listTree(root, opts.Exclude, "")
+	if err != nil {
+		return nil, err
+	}
+	return hashFiles(ctx, root, paths, opts.Algorithms, opts.Workers)
+}
+
+// hashFiles hashes the files paths, relative to root, with workers goroutines.
+func hashFiles(ctx context.Context, root string, paths []string, algorithms []Algorithm, workers int) ([]FileSum, error) {
+	sums := make([]FileSum, len(paths))
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sum, err := hashTreeFile(ctx, root, paths[i], algorithms)
+				if err != nil {
+					cancel(fmt.Errorf("hash %s: %w", paths[i], err))
+					continue
+				}
+				sums[i] = sum
+			}
+		}()
+	}
+send:
+	for i := range paths {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// listTree returns the slash separated paths of the regular files under root, sorted,
+// except skip, e.g. a manifest.
+func listTree(root string, exclude []string, skip string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if doraemon.MatchAnyGlob(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && rel != skip {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func hashTreeFile(ctx context.Context, root, rel string, algorithms []Algorithm) (FileSum, error) {
+	f, err := os.Open(treePath(root, rel))
+	if err != nil {
+		return FileSum{}, err
+	}
+	defer f.Close()
+	m := NewMultiHasher(algorithms...)
+	if _, err := io.Copy(m, &ctxReader{ctx: ctx, r: f}); err != nil {
+		return FileSum{}, err
+	}
+	return FileSum{Path: rel, Size: m.Size(), Sums: m.Sums()}, nil
+}
+
+// treePath returns the path of the slash separated path rel of the tree root, an absolute rel is kept.
+func treePath(root, rel string) string {
+	name := filepath.FromSlash(rel)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(root, name)
+}
+
+// ctxReader stops reading when ctx is done, so that a large file does not delay a cancellation.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := context.Cause(r.ctx); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -125,6 +125,7 @@ func ReadAllWithLimitBuffer(reader io.Reader, buf []byte) (n int, err error) {
 
 // Watchdog monitors a task to ensure it remains "alive".
 // If its Pet() method is not called within a configured interval, a timeout is triggered.
+// See MultiWatchdog to supervise several tasks with their own timeouts.
 type Watchdog struct {
 	checkInterval   time.Duration
 	onTimeout       func()
@@ -0,0 +1,328 @@
+package doraemon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// timedRWMutexWeight is the weight of a writer in the semaphore of a TimedRWMutex,
+// it bounds the number of concurrent readers.
+const timedRWMutexWeight = 1 << 30
+
+// TimedRWMutex is a reader/writer mutex whose locks can be given up with a context or
+// a timeout. It is built on a Bulkhead, so it is fair: once a writer waits, new readers
+// wait behind it. Create it with NewTimedRWMutex.
+type TimedRWMutex struct {
+	sem *Bulkhead
+	// name identifies the lock in the lock debug reports, see lockdebug_on.go
+	name string
+}
+
+func NewTimedRWMutex() *TimedRWMutex {
+	return &TimedRWMutex{sem: NewBulkhead(timedRWMutexWeight)}
+}
+
+func (m *TimedRWMutex) Lock() {
+	_ = m.lock(context.Background(), timedRWMutexWeight)
+}
+
+// LockContext locks m, or returns ctx.Err() if ctx is done first.
+func (m *TimedRWMutex) LockContext(ctx context.Context) error {
+	return m.lock(ctx, timedRWMutexWeight)
+}
+
+func (m *TimedRWMutex) TryLock() bool {
+	return m.tryLock(timedRWMutexWeight)
+}
+
+// TryLockFor tries to lock m for at most d and reports whether it succeeded.
+func (m *TimedRWMutex) TryLockFor(d time.Duration) bool {
+	return m.lockFor(d, timedRWMutexWeight)
+}
+
+func (m *TimedRWMutex) Unlock() {
+	m.unlock(timedRWMutexWeight)
+}
+
+func (m *TimedRWMutex) RLock() {
+	_ = m.lock(context.Background(), 1)
+}
+
+// RLockContext read-locks m, or returns ctx.Err() if ctx is done first.
+func (m *TimedRWMutex) RLockContext(ctx context.Context) error {
+	return m.lock(ctx, 1)
+}
+
+func (m *TimedRWMutex) TryRLock() bool {
+	return m.tryLock(1)
+}
+
+// TryRLockFor tries to read-lock m for at most d and reports whether it succeeded.
+func (m *TimedRWMutex) TryRLockFor(d time.Duration) bool {
+	return m.lockFor(d, 1)
+}
+
+func (m *TimedRWMutex) RUnlock() {
+	m.unlock(1)
+}
+
+func (m *TimedRWMutex) lock(ctx context.Context, weight int64) error {
+	if !lockDebug {
+		return m.sem.Acquire(ctx, weight)
+	}
+	start := time.Now()
+	lockDebugAcquiring(m.debugName())
+	if err := m.sem.Acquire(ctx, weight); err != nil {
+		lockDebugAbandoned(m.debugName())
+		return err
+	}
+	lockDebugAcquired(m.debugName(), time.Since(start))
+	return nil
+}
+
+func (m *TimedRWMutex) tryLock(weight int64) bool {
+	if !m.sem.TryAcquire(weight) {
+		return false
+	}
+	if lockDebug {
+		lockDebugAcquiring(m.debugName())
+		lockDebugAcquired(m.debugName(), 0)
+	}
+	return true
+}
+
+func (m *TimedRWMutex) lockFor(d time.Duration, weight int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.lock(ctx, weight) == nil
+}
+
+func (m *TimedRWMutex) unlock(weight int64) {
+	if lockDebug {
+		lockDebugReleased(m.debugName())
+	}
+	m.sem.Release(weight)
+}
+
+func (m *TimedRWMutex) debugName() string {
+	if m.name != "" {
+		return m.name
+	}
+	return fmt.Sprintf("%p", m)
+}
+
+// TimedMutex is a mutex whose Lock can be given up with a context or a timeout,
+// see TimedRWMutex. Create it with NewTimedMutex.
+type TimedMutex struct {
+	rw *TimedRWMutex
+}
+
+func NewTimedMutex() *TimedMutex {
+	return &TimedMutex{rw: NewTimedRWMutex()}
+}
+
+func (m *TimedMutex) Lock()                                 { m.rw.Lock() }
+func (m *TimedMutex) LockContext(ctx context.Context) error { return m.rw.LockContext(ctx) }
+func (m *TimedMutex) TryLock() bool                         { return m.rw.TryLock() }
+func (m *TimedMutex) TryLockFor(d time.Duration) bool       { return m.rw.TryLockFor(d) }
+func (m *TimedMutex) Unlock()                               { m.rw.Unlock() }
+
+type keyedLock struct {
+	mu   *TimedRWMutex
+	refs int
+}
+
+// RWKeyedMutex is a set of reader/writer locks identified by keys, e.g. a lock per user ID.
+// The lock of a key only exists while it is held or waited for, so any number of keys can
+// be used. The zero value is ready to use.
+type RWKeyedMutex[K comparable] struct {
+	mu    sync.Mutex
+	locks map[K]*keyedLock
+}
+
+// acquire returns the lock of key with a reference taken, release must be called to drop it.
+func (km *RWKeyedMutex[K]) acquire(key K) *TimedRWMutex {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if km.locks == nil {
+		km.locks = make(map[K]*keyedLock)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{mu: NewTimedRWMutex()}
+		if lockDebug {
+			l.mu.name = fmt.Sprintf("%p[%v]", km, key)
+		}
+		km.locks[key] = l
+	}
+	l.refs++
+	return l.mu
+}
+
+func (km *RWKeyedMutex[K]) release(key K) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	l := km.locks[key]
+	if l.refs--; l.refs == 0 {
+		delete(km.locks, key)
+	}
+}
+
+func (km *RWKeyedMutex[K]) held(key K) *TimedRWMutex {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	l, ok := km.locks[key]
+	if !ok {
+		panic(fmt.Sprintf("keyed mutex: unlock of unlocked key %v", key))
+	}
+	return l.mu
+}
+
+func (km *RWKeyedMutex[K]) Lock(key K) {
+	km.acquire(key).Lock()
+}
+
+// LockContext locks key, or returns ctx.Err() if ctx is done first.
+func (km *RWKeyedMutex[K]) LockContext(ctx context.Context, key K) error {
+	if err := km.acquire(key).LockContext(ctx); err != nil {
+		km.release(key)
+		return err
+	}
+	return nil
+}
+
+func (km *RWKeyedMutex[K]) TryLock(key K) bool {
+	if !km.acquire(key).TryLock() {
+		km.release(key)
+		return false
+	}
+	return true
+}
+
+// TryLockFor tries to lock key for at most d and reports whether it succeeded.
+func (km *RWKeyedMutex[K]) TryLockFor(key K, d time.Duration) bool {
+	if !km.acquire(key).TryLockFor(d) {
+		km.release(key)
+		return false
+	}
+	return true
+}
+
+func (km *RWKeyedMutex[K]) Unlock(key K) {
+	km.held(key).Unlock()
+	km.release(key)
+}
+
+func (km *RWKeyedMutex[K]) RLock(key K) {
+	km.acquire(key).RLock()
+}
+
+// RLockContext read-locks key, or returns ctx.Err() if ctx is done first.
+func (km *RWKeyedMutex[K]) RLockContext(ctx context.Context, key K) error {
+	if err := km.acquire(key).RLockContext(ctx); err != nil {
+		km.release(key)
+		return err
+	}
+	return nil
+}
+
+func (km *RWKeyedMutex[K]) TryRLock(key K) bool {
+	if !km.acquire(key).TryRLock() {
+		km.release(key)
+		return false
+	}
+	return true
+}
+
+func (km *RWKeyedMutex[K]) RUnlock(key K) {
+	km.held(key).RUnlock()
+	km.release(key)
+}
+
+// Len returns the number of keys whose lock is held or waited for.
+func (km *RWKeyedMutex[K]) Len() int {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return len(km.locks)
+}
+
+// KeyedMutex is a set of mutexes identified by keys, see RWKeyedMutex.
+// The zero value is ready to use.
+type KeyedMutex[K comparable] struct {
+	rw RWKeyedMutex[K]
+}
+
+func (km *KeyedMutex[K]) Lock(key K) {
+	km.rw.Lock(key)
+}
+
+// LockContext locks key, or returns ctx.Err() if ctx is done first.
+func (km *KeyedMutex[K]) LockContext(ctx context.Context, key K) error {
+	return km.rw.LockContext(ctx, key)
+}
+
+func (km *KeyedMutex[K]) TryLock(key K) bool {
+	return km.rw.TryLock(key)
+}
+
+// TryLockFor tries to lock key for at most d and reports whether it succeeded.
+func (km *KeyedMutex[K]) TryLockFor(key K, d time.Duration) bool {
+	return km.rw.TryLockFor(key, d)
+}
+
+func (km *KeyedMutex[K]) Unlock(key K) {
+	km.rw.Unlock(key)
+}
+
+// Len returns the number of keys whose lock is held or waited for.
+func (km *KeyedMutex[K]) Len() int {
+	return km.rw.Len()
+}
+
+// StripedMutex is a fixed set of reader/writer locks (stripes) shared by all keys: a key
+// is mapped to a stripe by a hash function. Unlike RWKeyedMutex it allocates nothing per
+// key, but unrelated keys may share a stripe.
+type StripedMutex[K comparable] struct {
+	stripes []*TimedRWMutex
+	hash    func(key K) int
+}
+
+// NewStripedMutex creates a StripedMutex with n stripes. If hash is nil, DefaultHashCalc is used.
+func NewStripedMutex[K comparable](n int, hash func(key K) int) *StripedMutex[K] {
+	if n <= 0 {
+		panic("stripe count must be greater than 0")
+	}
+	if hash == nil {
+		hash = DefaultHashCalc[K](n)
+	}
+	sm := &StripedMutex[K]{stripes: make([]*TimedRWMutex, n), hash: hash}
+	for i := range sm.stripes {
+		sm.stripes[i] = NewTimedRWMutex()
+		if lockDebug {
+			sm.stripes[i].name = fmt.Sprintf("%p#%d", sm, i)
+		}
+	}
+	return sm
+}
+
+// Stripe returns the lock of key.
+func (sm *StripedMutex[K]) Stripe(key K) *TimedRWMutex {
+	return sm.stripes[sm.hash(key)]
+}
+
+func (sm *StripedMutex[K]) Lock(key K)    { sm.Stripe(key).Lock() }
+func (sm *StripedMutex[K]) Unlock(key K)  { sm.Stripe(key).Unlock() }
+func (sm *StripedMutex[K]) RLock(key K)   { sm.Stripe(key).RLock() }
+func (sm *StripedMutex[K]) RUnlock(key K) { sm.Stripe(key).RUnlock() }
+
+// LockContext locks the stripe of key, or returns ctx.Err() if ctx is done first.
+func (sm *StripedMutex[K]) LockContext(ctx context.Context, key K) error {
+	return sm.Stripe(key).LockContext(ctx)
+}
+
+// TryLockFor tries to lock the stripe of key for at most d and reports whether it succeeded.
+func (sm *StripedMutex[K]) TryLockFor(key K, d time.Duration) bool {
+	return sm.Stripe(key).TryLockFor(d)
+}
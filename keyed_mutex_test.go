@@ -0,0 +1,116 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var km KeyedMutex[int]
+	counters := make(map[int]int)
+	var countersMu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := i % 5
+			km.Lock(key)
+			defer km.Unlock(key)
+			countersMu.Lock()
+			n := counters[key]
+			countersMu.Unlock()
+			time.Sleep(time.Microsecond)
+			countersMu.Lock()
+			counters[key] = n + 1
+			countersMu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for key, n := range counters {
+		if n != 10 {
+			t.Fatalf("key %d: lost updates, got %d", key, n)
+		}
+	}
+	if km.Len() != 0 {
+		t.Fatalf("unused locks not freed: %d", km.Len())
+	}
+
+	km.Lock(1)
+	if km.TryLock(1) || !km.TryLock(2) {
+		t.Fatal("TryLock ignored the lock of key 1 or was blocked by it")
+	}
+	km.Unlock(2)
+	if km.TryLockFor(1, 5*time.Millisecond) {
+		t.Fatal("TryLockFor acquired a held lock")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := km.LockContext(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if km.Len() != 1 {
+		t.Fatalf("abandoned waits left locks behind: %d", km.Len())
+	}
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		km.Unlock(1)
+	}()
+	if !km.TryLockFor(1, time.Second) {
+		t.Fatal("TryLockFor did not get the released lock")
+	}
+	km.Unlock(1)
+}
+
+func TestRWKeyedMutex(t *testing.T) {
+	var km RWKeyedMutex[string]
+	km.RLock("a")
+	if !km.TryRLock("a") || km.TryLock("a") {
+		t.Fatal("readers did not share the lock or excluded a writer")
+	}
+	km.RUnlock("a")
+	km.RUnlock("a")
+	if !km.TryLock("a") || km.TryRLock("a") {
+		t.Fatal("the writer did not exclude readers")
+	}
+	km.Unlock("a")
+	if km.Len() != 0 {
+		t.Fatalf("unused locks not freed: %d", km.Len())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unlock of an unlocked key did not panic")
+		}
+	}()
+	km.Unlock("b")
+}
+
+func TestStripedMutex(t *testing.T) {
+	sm := NewStripedMutex[string](4, nil)
+	sm.Lock("x")
+	if sm.Stripe("x").TryRLock() {
+		t.Fatal("stripe not locked")
+	}
+	if sm.TryLockFor("x", time.Millisecond) {
+		t.Fatal("TryLockFor acquired a held stripe")
+	}
+	sm.Unlock("x")
+	sm.RLock("x")
+	sm.RLock("x")
+	sm.RUnlock("x")
+	sm.RUnlock("x")
+	if err := sm.LockContext(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	sm.Unlock("x")
+
+	m := NewTimedMutex()
+	m.Lock()
+	if m.TryLock() || m.TryLockFor(time.Millisecond) {
+		t.Fatal("TimedMutex locked twice")
+	}
+	m.Unlock()
+}
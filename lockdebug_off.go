@@ -0,0 +1,13 @@
+//go:build !lockdebug
+
+package doraemon
+
+import "time"
+
+// lockDebug enables the lock debug reports of lockdebug_on.go, build with -tags lockdebug.
+const lockDebug = false
+
+func lockDebugAcquiring(string)               {}
+func lockDebugAcquired(string, time.Duration) {}
+func lockDebugAbandoned(string)               {}
+func lockDebugReleased(string)                {}
@@ -0,0 +1,175 @@
+//go:build lockdebug
+
+package doraemon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// lockDebug enables the lock debug reports, it is set by building with -tags lockdebug.
+// The reports cover the locks of TimedMutex, TimedRWMutex, KeyedMutex, RWKeyedMutex and StripedMutex.
+const lockDebug = true
+
+// LockReportKind is the kind of a LockReport.
+type LockReportKind int
+
+const (
+	// LockContention reports a lock that was waited for longer than LockDebugThreshold.
+	LockContention LockReportKind = iota
+	// LockLongHold reports a lock that was held longer than LockDebugThreshold.
+	LockLongHold
+	// LockOrderInversion reports two locks taken in both orders by different code paths,
+	// which can deadlock.
+	LockOrderInversion
+)
+
+func (k LockReportKind) String() string {
+	switch k {
+	case LockContention:
+		return "contention"
+	case LockLongHold:
+		return "long hold"
+	case LockOrderInversion:
+		return "lock order inversion"
+	default:
+		return "unknown"
+	}
+}
+
+// LockReport is a problem found by the lock debug tracking.
+type LockReport struct {
+	Kind LockReportKind
+	Lock string
+	// Other is the lock taken in the opposite order, for LockOrderInversion.
+	Other    string
+	Duration time.Duration
+	Stack    string
+}
+
+var (
+	// LockDebugThreshold is the wait and hold time above which a lock is reported.
+	LockDebugThreshold = 100 * time.Millisecond
+	// LockDebugReporter receives the lock reports, by default they are printed to stderr.
+	LockDebugReporter = func(r LockReport) {
+		switch r.Kind {
+		case LockOrderInversion:
+			fmt.Fprintf(os.Stderr, "lockdebug: %s: %s is taken after %s, and before it elsewhere\n%s\n", r.Kind, r.Lock, r.Other, r.Stack)
+		default:
+			fmt.Fprintf(os.Stderr, "lockdebug: %s of %s for %s\n%s\n", r.Kind, r.Lock, r.Duration, r.Stack)
+		}
+	}
+)
+
+type heldLock struct {
+	name  string
+	since time.Time
+}
+
+var lockTracker = struct {
+	mu sync.Mutex
+	// goroutine id -> locks held in acquisition order
+	held map[uint64][]heldLock
+	// lock order edges: [before, after]
+	order map[[2]string]bool
+	// inversions already reported
+	reported map[[2]string]bool
+}{
+	held:     make(map[uint64][]heldLock),
+	order:    make(map[[2]string]bool),
+	reported: make(map[[2]string]bool),
+}
+
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// "goroutine 123 [running]:..."
+	field := bytes.Fields(buf[:n])[1]
+	id, _ := strconv.ParseUint(string(field), 10, 64)
+	return id
+}
+
+func lockStack() string {
+	buf := make([]byte, 8192)
+	return string(buf[:runtime.Stack(buf, false)])
+}
+
+func lockDebugAcquiring(name string) {
+	gid := goroutineID()
+	var reports []LockReport
+	lockTracker.mu.Lock()
+	for _, h := range lockTracker.held[gid] {
+		if h.name == name {
+			continue
+		}
+		lockTracker.order[[2]string{h.name, name}] = true
+		pair := [2]string{min(h.name, name), max(h.name, name)}
+		if lockTracker.order[[2]string{name, h.name}] && !lockTracker.reported[pair] {
+			lockTracker.reported[pair] = true
+			reports = append(reports, LockReport{Kind: LockOrderInversion, Lock: name, Other: h.name})
+		}
+	}
+	lockTracker.mu.Unlock()
+	reportLocks(reports)
+}
+
+func lockDebugAcquired(name string, waited time.Duration) {
+	gid := goroutineID()
+	lockTracker.mu.Lock()
+	lockTracker.held[gid] = append(lockTracker.held[gid], heldLock{name: name, since: time.Now()})
+	lockTracker.mu.Unlock()
+	if waited > LockDebugThreshold {
+		reportLocks([]LockReport{{Kind: LockContention, Lock: name, Duration: waited}})
+	}
+}
+
+func lockDebugAbandoned(string) {}
+
+func lockDebugReleased(name string) {
+	gid := goroutineID()
+	var since time.Time
+	lockTracker.mu.Lock()
+	// a lock may be released by another goroutine than the one that took it
+	for _, id := range append([]uint64{gid}, keysOf(lockTracker.held)...) {
+		held := lockTracker.held[id]
+		i := len(held) - 1
+		for i >= 0 && held[i].name != name {
+			i--
+		}
+		if i < 0 {
+			continue
+		}
+		since = held[i].since
+		held = append(held[:i], held[i+1:]...)
+		if len(held) == 0 {
+			delete(lockTracker.held, id)
+		} else {
+			lockTracker.held[id] = held
+		}
+		break
+	}
+	lockTracker.mu.Unlock()
+	if held := time.Since(since); !since.IsZero() && held > LockDebugThreshold {
+		reportLocks([]LockReport{{Kind: LockLongHold, Lock: name, Duration: held}})
+	}
+}
+
+func keysOf(m map[uint64][]heldLock) []uint64 {
+	keys := make([]uint64, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func reportLocks(reports []LockReport) {
+	for _, r := range reports {
+		r.Stack = lockStack()
+		LockDebugReporter(r)
+	}
+}
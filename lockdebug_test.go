@@ -0,0 +1,35 @@
+//go:build lockdebug
+
+package doraemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockDebug(t *testing.T) {
+	var reports []LockReport
+	reporter, threshold := LockDebugReporter, LockDebugThreshold
+	LockDebugReporter = func(r LockReport) { reports = append(reports, r) }
+	LockDebugThreshold = 5 * time.Millisecond
+	defer func() { LockDebugReporter, LockDebugThreshold = reporter, threshold }()
+
+	var km KeyedMutex[string]
+	km.Lock("a")
+	km.Lock("b")
+	km.Unlock("b")
+	km.Unlock("a")
+	km.Lock("b")
+	km.Lock("a")
+	km.Unlock("a")
+	time.Sleep(10 * time.Millisecond)
+	km.Unlock("b")
+
+	kinds := make(map[LockReportKind]int)
+	for _, r := range reports {
+		kinds[r.Kind]++
+	}
+	if kinds[LockOrderInversion] != 1 || kinds[LockLongHold] != 1 {
+		t.Fatalf("unexpected reports %+v", reports)
+	}
+}
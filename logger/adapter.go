@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// stdLoggerHandler is a slog.Handler logging to a doraemon.StdLogger.
+type stdLoggerHandler struct {
+	logger doraemon.StdLogger
+	level  slog.Leveler
+	color  *ColorHandler
+}
+
+// NewStdLoggerHandler returns a slog.Handler logging the records at or above level to l, with the
+// method of their level: Tracef, Debugf, Infof, Warnf or Errorf. The attributes are appended to the
+// message as key=value pairs. A nil level is LevelInfo.
+//
+// It lets the code using slog log to an existing StdLogger; FromHandler adapts the other way.
+func NewStdLoggerHandler(l doraemon.StdLogger, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = LevelInfo
+	}
+	return &stdLoggerHandler{logger: l, level: level, color: NewColorHandler(nil, nil)}
+}
+
+func (h *stdLoggerHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *stdLoggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.color.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		h.color.appendAttr(&b, h.color.group, a)
+		return true
+	})
+	msg := b.String()
+	switch {
+	case r.Level < LevelDebug:
+		h.logger.Tracef("%s", msg)
+	case r.Level < LevelInfo:
+		h.logger.Debugf("%s", msg)
+	case r.Level < LevelWarn:
+		h.logger.Infof("%s", msg)
+	case r.Level < LevelError:
+		h.logger.Warnf("%s", msg)
+	default:
+		// Panicf would panic, the panic of a record is up to the caller
+		h.logger.Errorf("%s", msg)
+	}
+	return nil
+}
+
+func (h *stdLoggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.color = h.color.WithAttrs(attrs).(*ColorHandler)
+	return &clone
+}
+
+func (h *stdLoggerHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.color = h.color.WithGroup(name).(*ColorHandler)
+	return &clone
+}
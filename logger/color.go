@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// levelColors are the colors of the level names in the console, like other.ColorPrint
+// colors are disabled when the output is not a terminal (color.NoColor).
+var levelColors = []struct {
+	level slog.Level
+	color *color.Color
+}{
+	{LevelTrace, color.New(color.FgHiBlack)},
+	{LevelDebug, color.New(color.FgCyan)},
+	{LevelInfo, color.New(color.FgGreen)},
+	{LevelWarn, color.New(color.FgYellow)},
+	{LevelError, color.New(color.FgRed)},
+	{LevelPanic, color.New(color.FgMagenta, color.Bold)},
+}
+
+func levelColor(level slog.Level) *color.Color {
+	c := levelColors[0].color
+	for _, lc := range levelColors {
+		if level >= lc.level {
+			c = lc.color
+		}
+	}
+	return c
+}
+
+// ColorHandler is a slog.Handler writing human readable lines with colored levels:
+//
+//	2024-05-01 10:00:00.000 INFO  listening addr=:8080
+type ColorHandler struct {
+	opts  slog.HandlerOptions
+	mu    *sync.Mutex
+	w     io.Writer
+	attrs string // the formatted attributes of WithAttrs
+	group string // the prefix of the keys, from WithGroup
+}
+
+// NewColorHandler creates a ColorHandler writing to w, opts may be nil.
+func NewColorHandler(w io.Writer, opts *slog.HandlerOptions) *ColorHandler {
+	h := &ColorHandler{mu: &sync.Mutex{}, w: w}
+	if opts != nil {
+		h.opts = *opts
+	}
+	return h
+}
+
+func (h *ColorHandler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+func (h *ColorHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	if !r.Time.IsZero() {
+		b.WriteString(r.Time.Format("2006-01-02 15:04:05.000"))
+		b.WriteByte(' ')
+	}
+	b.WriteString(levelColor(r.Level).Sprintf("%-5s", LevelName(r.Level)))
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		h.appendAttr(&b, h.group, a)
+		return true
+	})
+	if h.opts.AddSource && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fmt.Fprintf(&b, " source=%s:%d", frame.File, frame.Line)
+	}
+	b.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *ColorHandler) appendAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	if h.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		var groups []string
+		if prefix != "" {
+			groups = strings.Split(strings.TrimSuffix(prefix, "."), ".")
+		}
+		a = h.opts.ReplaceAttr(groups, a)
+	}
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			h.appendAttr(b, prefix, ga)
+		}
+		return
+	}
+	b.WriteByte(' ')
+	b.WriteString(prefix)
+	b.WriteString(a.Key)
+	b.WriteByte('=')
+	b.WriteString(formatValue(a.Value))
+}
+
+func formatValue(v slog.Value) string {
+	var s string
+	switch v.Kind() {
+	case slog.KindString:
+		s = v.String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			s = err.Error()
+		} else {
+			s = fmt.Sprint(v.Any())
+		}
+	default:
+		return v.String()
+	}
+	if needsQuoting(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ColorHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	for _, a := range attrs {
+		h.appendAttr(&b, h.group, a)
+	}
+	clone := *h
+	clone.attrs += b.String()
+	return &clone
+}
+
+func (h *ColorHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group += name + "."
+	return &clone
+}
@@ -0,0 +1,210 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewHandler returns the slog.Handler of a Logger created with opts: the output handler
+// of opts.Format, behind the sampling and the package levels.
+func NewHandler(opts Options) slog.Handler {
+	level := opts.Level
+	if level == nil {
+		level = LevelInfo
+	}
+	out := opts.Output
+	if out == nil {
+		out = defaultOutput
+	}
+	// the level is checked by the levelHandler, the output handlers log everything they get
+	handlerOpts := &slog.HandlerOptions{
+		AddSource: opts.AddSource,
+		Level:     slog.Level(-1 << 10),
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.LevelKey {
+				if level, ok := a.Value.Any().(slog.Level); ok {
+					a.Value = slog.StringValue(LevelName(level))
+				}
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	switch opts.Format {
+	case FormatJSON:
+		h = slog.NewJSONHandler(out, handlerOpts)
+	case FormatColor:
+		h = NewColorHandler(out, handlerOpts)
+	default:
+		h = slog.NewTextHandler(out, handlerOpts)
+	}
+	if opts.Sampling != nil {
+		h = NewSamplingHandler(h, *opts.Sampling)
+	}
+	return NewLevelHandler(h, level, opts.PackageLevels)
+}
+
+// levelHandler filters the records by the level of the package of their caller.
+type levelHandler struct {
+	next     slog.Handler
+	level    slog.Leveler
+	packages map[string]slog.Level
+	// cache maps a caller PC to its level
+	cache *sync.Map
+}
+
+// NewLevelHandler returns a handler passing to next the records at or above level, or at
+// or above the level of the package of their caller in packages, see Options.PackageLevels.
+func NewLevelHandler(next slog.Handler, level slog.Leveler, packages map[string]slog.Level) slog.Handler {
+	return &levelHandler{next: next, level: level, packages: packages, cache: &sync.Map{}}
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// the caller is unknown here, the lowest level of the packages applies
+	lowest := h.level.Level()
+	for _, l := range h.packages {
+		lowest = min(lowest, l)
+	}
+	return level >= lowest && h.next.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < h.levelOf(r.PC) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *levelHandler) levelOf(pc uintptr) slog.Level {
+	if len(h.packages) == 0 || pc == 0 {
+		return h.level.Level()
+	}
+	if l, ok := h.cache.Load(pc); ok {
+		return l.(slog.Level)
+	}
+	level := h.level.Level()
+	pkg := callerPackage(pc)
+	best := -1
+	for prefix, l := range h.packages {
+		if (pkg == prefix || strings.HasPrefix(pkg, prefix+"/")) && len(prefix) > best {
+			best, level = len(prefix), l
+		}
+	}
+	// the level of a Leveler may change, only the package overrides are cached
+	if best < 0 {
+		return level
+	}
+	h.cache.Store(pc, level)
+	return level
+}
+
+// callerPackage returns the import path of the package of the function at pc.
+func callerPackage(pc uintptr) string {
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	fn := frame.Function
+	// e.g. github.com/me/app/db.(*Store).Get
+	slash := strings.LastIndexByte(fn, '/')
+	if dot := strings.IndexByte(fn[slash+1:], '.'); dot >= 0 {
+		return fn[:slash+1+dot]
+	}
+	return fn
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{next: h.next.WithAttrs(attrs), level: h.level, packages: h.packages, cache: h.cache}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{next: h.next.WithGroup(name), level: h.level, packages: h.packages, cache: h.cache}
+}
+
+// SamplingOptions limits the records with the same level and message: in each Tick, the
+// First ones are logged, then one in Thereafter. The records at or above LevelError are
+// sampled too, unless SkipErrors is set.
+type SamplingOptions struct {
+	Tick       time.Duration
+	First      int
+	Thereafter int
+	SkipErrors bool
+}
+
+type samplingKey struct {
+	level slog.Level
+	msg   string
+}
+
+type samplingCounter struct {
+	window time.Time
+	count  int
+}
+
+type sampler struct {
+	opts     SamplingOptions
+	mu       sync.Mutex
+	counters map[samplingKey]*samplingCounter
+}
+
+type samplingHandler struct {
+	next    slog.Handler
+	sampler *sampler
+}
+
+// NewSamplingHandler returns a handler passing to next a sample of the repeated records, see SamplingOptions.
+// The windows are based on the time of the records.
+func NewSamplingHandler(next slog.Handler, opts SamplingOptions) slog.Handler {
+	if opts.Tick <= 0 {
+		opts.Tick = time.Second
+	}
+	return &samplingHandler{next: next, sampler: &sampler{opts: opts, counters: make(map[samplingKey]*samplingCounter)}}
+}
+
+func (h *samplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !h.sampler.keep(r) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (s *sampler) keep(r slog.Record) bool {
+	if s.opts.SkipErrors && r.Level >= LevelError {
+		return true
+	}
+	window := r.Time.Truncate(s.opts.Tick)
+	key := samplingKey{level: r.Level, msg: r.Message}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[key]
+	if !ok || !c.window.Equal(window) {
+		if len(s.counters) > 4096 {
+			// forget the messages of the previous windows
+			for k, old := range s.counters {
+				if !old.window.Equal(window) {
+					delete(s.counters, k)
+				}
+			}
+		}
+		c = &samplingCounter{window: window}
+		s.counters[key] = c
+	}
+	c.count++
+	if c.count <= s.opts.First {
+		return true
+	}
+	return s.opts.Thereafter > 0 && (c.count-s.opts.First)%s.opts.Thereafter == 0
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
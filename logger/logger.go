@@ -0,0 +1,228 @@
+// Package logger is a leveled logger built on log/slog, it implements doraemon.StdLogger.
+//
+// A Logger writes text, JSON or colored console output to any writer, e.g. a
+// doraemon.RotatingFileWriter, with levels overridable per package and sampling of
+// repeated messages:
+//
+//	log := logger.New(logger.Options{
+//		Format:        logger.FormatColor,
+//		Level:         logger.LevelInfo,
+//		PackageLevels: map[string]slog.Level{"github.com/me/app/db": logger.LevelDebug},
+//	})
+//	log.Infof("listening on %s", addr)
+//	log.Slog().Info("request", "path", path)
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/doraemonkeys/doraemon"
+)
+
+// The levels of the StdLogger methods, in addition to the levels of slog.
+const (
+	LevelTrace = slog.Level(-8)
+	LevelDebug = slog.LevelDebug
+	LevelInfo  = slog.LevelInfo
+	LevelWarn  = slog.LevelWarn
+	LevelError = slog.LevelError
+	LevelPanic = slog.Level(12)
+)
+
+// LevelName returns the name of level: TRACE, DEBUG, INFO, WARN, ERROR or PANIC,
+// with an offset for the levels in between, e.g. INFO+2.
+func LevelName(level slog.Level) string {
+	name := func(base string, offset slog.Level) string {
+		if offset == 0 {
+			return base
+		}
+		return fmt.Sprintf("%s%+d", base, offset)
+	}
+	switch {
+	case level < LevelDebug:
+		return name("TRACE", level-LevelTrace)
+	case level < LevelInfo:
+		return name("DEBUG", level-LevelDebug)
+	case level < LevelWarn:
+		return name("INFO", level-LevelInfo)
+	case level < LevelError:
+		return name("WARN", level-LevelWarn)
+	case level < LevelPanic:
+		return name("ERROR", level-LevelError)
+	default:
+		return name("PANIC", level-LevelPanic)
+	}
+}
+
+// Format is the output format of a Logger.
+type Format int
+
+const (
+	// FormatText is the key=value format of slog.TextHandler.
+	FormatText Format = iota
+	// FormatJSON is the format of slog.JSONHandler.
+	FormatJSON
+	// FormatColor is a human readable console format with colored levels.
+	FormatColor
+)
+
+// Options configures New.
+type Options struct {
+	// Level is the minimum level logged, LevelInfo if nil.
+	Level slog.Leveler
+	// PackageLevels overrides Level for packages, by import path. A package also applies to
+	// its subpackages, the longest matching path wins, e.g. "github.com/me/app/db".
+	PackageLevels map[string]slog.Level
+	Format        Format
+	// Output is where the logs are written, os.Stderr if nil.
+	Output io.Writer
+	// AddSource adds the file and line of the caller.
+	AddSource bool
+	// Sampling limits repeated messages, see SamplingOptions. Nil logs all messages.
+	Sampling *SamplingOptions
+}
+
+// Logger is a leveled logger implementing doraemon.StdLogger on top of a slog.Handler.
+type Logger struct {
+	handler slog.Handler
+	closer  io.Closer
+}
+
+var _ doraemon.StdLogger = (*Logger)(nil)
+
+// New creates a Logger writing to opts.Output.
+func New(opts Options) *Logger {
+	return FromHandler(NewHandler(opts))
+}
+
+// NewFile creates a Logger writing to the file path, rotated according to rotation,
+// see doraemon.RotatingFileWriter. Close closes the file.
+func NewFile(path string, opts Options, rotation ...doraemon.RotatingFileWriterOption) *Logger {
+	w := doraemon.NewRotatingFileWriter(path, rotation...)
+	opts.Output = w
+	l := New(opts)
+	l.closer = w
+	return l
+}
+
+// FromHandler creates a Logger logging to h, it adapts any slog.Handler to doraemon.StdLogger.
+func FromHandler(h slog.Handler) *Logger {
+	return &Logger{handler: h}
+}
+
+// Handler returns the handler of the logger.
+func (l *Logger) Handler() slog.Handler {
+	return l.handler
+}
+
+// Slog returns a slog.Logger logging to the same handler.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(l.handler)
+}
+
+// With returns a Logger that adds attributes to each record, see slog.Logger.With.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{handler: l.Slog().With(args...).Handler(), closer: l.closer}
+}
+
+// WithGroup returns a Logger that puts the attributes in the group name, see slog.Logger.WithGroup.
+func (l *Logger) WithGroup(name string) *Logger {
+	return &Logger{handler: l.handler.WithGroup(name), closer: l.closer}
+}
+
+// Close closes the file of a Logger created by NewFile, it does nothing otherwise.
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// Log logs msg with the attributes args at level, see slog.Logger.Log.
+func (l *Logger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	l.log(ctx, level, msg, args...)
+}
+
+// log must be called directly by the exported methods, for the caller of the record.
+func (l *Logger) log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !l.handler.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	// skip runtime.Callers, log and the exported method
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(args...)
+	_ = l.handler.Handle(ctx, r)
+}
+
+func sprintln(args ...any) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+func (l *Logger) Tracef(format string, args ...any) {
+	l.log(context.Background(), LevelTrace, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Traceln(args ...any) {
+	l.log(context.Background(), LevelTrace, sprintln(args...))
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.log(context.Background(), LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debugln(args ...any) {
+	l.log(context.Background(), LevelDebug, sprintln(args...))
+}
+
+func (l *Logger) Infof(format string, args ...any) {
+	l.log(context.Background(), LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infoln(args ...any) {
+	l.log(context.Background(), LevelInfo, sprintln(args...))
+}
+
+func (l *Logger) Warnf(format string, args ...any) {
+	l.log(context.Background(), LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnln(args ...any) {
+	l.log(context.Background(), LevelWarn, sprintln(args...))
+}
+
+func (l *Logger) Errorf(format string, args ...any) {
+	l.log(context.Background(), LevelError, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorln(args ...any) {
+	l.log(context.Background(), LevelError, sprintln(args...))
+}
+
+// Panicf logs the message at LevelPanic, then panics with it.
+func (l *Logger) Panicf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	l.log(context.Background(), LevelPanic, msg)
+	panic(msg)
+}
+
+// Panicln logs the message at LevelPanic, then panics with it.
+func (l *Logger) Panicln(args ...any) {
+	msg := sprintln(args...)
+	l.log(context.Background(), LevelPanic, msg)
+	panic(msg)
+}
+
+// defaultOutput is os.Stderr, a variable for tests.
+var defaultOutput io.Writer = os.Stderr
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+func TestLogger_TextAndJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(Options{Output: &buf, Level: LevelTrace})
+	l.Tracef("trace %d", 1)
+	l.Infoln("hello", "world")
+	l.With("user", "bob").Warnf("careful")
+	out := buf.String()
+	for _, want := range []string{`level=TRACE msg="trace 1"`, `level=INFO msg="hello world"`, `level=WARN msg=careful user=bob`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	l = New(Options{Output: &buf, Format: FormatJSON})
+	l.Debugf("hidden")
+	l.Errorf("failed: %v", "boom")
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("%v in %q", err, buf.String())
+	}
+	if record["level"] != "ERROR" || record["msg"] != "failed: boom" {
+		t.Fatalf("unexpected record %v", record)
+	}
+}
+
+func TestLogger_PackageLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(Options{
+		Output: &buf,
+		Level:  LevelWarn,
+		PackageLevels: map[string]slog.Level{
+			"github.com/doraemonkeys/doraemon/logger": LevelDebug,
+			"github.com/doraemonkeys/doraemon/other":  LevelTrace,
+		},
+	})
+	l.Debugf("from this package")
+	l.Tracef("too low")
+	l.Slog().Debug("through slog")
+	out := buf.String()
+	if !strings.Contains(out, "from this package") || !strings.Contains(out, "through slog") || strings.Contains(out, "too low") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	buf.Reset()
+	l = New(Options{Output: &buf, Level: LevelWarn, PackageLevels: map[string]slog.Level{"github.com/doraemonkeys/doraemon/log": LevelDebug}})
+	l.Debugf("not a prefix of this package")
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestSamplingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := NewSamplingHandler(slog.NewTextHandler(&buf, nil), SamplingOptions{Tick: time.Second, First: 2, Thereafter: 3})
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		_ = h.Handle(context.Background(), slog.NewRecord(start.Add(time.Duration(i)*time.Millisecond), LevelInfo, "repeated", 0))
+	}
+	// a new window logs the first ones again
+	_ = h.Handle(context.Background(), slog.NewRecord(start.Add(time.Second), LevelInfo, "repeated", 0))
+	_ = h.Handle(context.Background(), slog.NewRecord(start, LevelInfo, "other", 0))
+	// 1, 2, 5, 8, then the new window and the other message
+	if n := strings.Count(buf.String(), "repeated"); n != 5 {
+		t.Fatalf("expected 5 repeated records, got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "other") {
+		t.Fatal("other message sampled")
+	}
+}
+
+func TestColorHandler(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	defer func() { color.NoColor = noColor }()
+
+	var buf bytes.Buffer
+	l := New(Options{Output: &buf, Format: FormatColor})
+	l.WithGroup("req").With("path", "/a b").Infof("served")
+	l.Slog().Warn("slow", "d", time.Second, "err", fmt.Errorf("timeout"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+	if !strings.HasSuffix(lines[0], `INFO  served req.path="/a b"`) || !strings.HasSuffix(lines[1], "WARN  slow d=1s err=timeout") {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
+
+type recordingLogger struct {
+	Logger
+	lines []string
+}
+
+func (r *recordingLogger) Infof(format string, args ...any) {
+	r.lines = append(r.lines, "info: "+fmt.Sprintf(format, args...))
+}
+
+func (r *recordingLogger) Errorf(format string, args ...any) {
+	r.lines = append(r.lines, "error: "+fmt.Sprintf(format, args...))
+}
+
+func TestStdLoggerHandler(t *testing.T) {
+	std := &recordingLogger{}
+	log := slog.New(NewStdLoggerHandler(std, nil)).With("id", 7)
+	log.Info("started", "port", 80)
+	log.Debug("hidden")
+	log.Error("failed")
+	want := []string{"info: started id=7 port=80", "error: failed id=7"}
+	if strings.Join(std.lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", std.lines, want)
+	}
+}
+
+func TestLogger_PanicAndFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+	l := NewFile(name, Options{})
+	func() {
+		defer func() {
+			if r := recover(); r != "fatal 1" {
+				t.Fatalf("unexpected panic %v", r)
+			}
+		}()
+		l.Panicf("fatal %d", 1)
+	}()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(name)
+	if !strings.Contains(string(data), `level=PANIC msg="fatal 1"`) {
+		t.Fatalf("unexpected file content %q", data)
+	}
+}
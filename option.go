@@ -0,0 +1,123 @@
+package doraemon
+
+// Option is an optional value, it is the value counterpart of SyncOptional
+// and is not safe for concurrent modification.
+type Option[T any] struct {
+	hasItem bool
+	item    T
+}
+
+func Some[T any](item T) Option[T] {
+	return Option[T]{hasItem: true, item: item}
+}
+
+func None[T any]() Option[T] {
+	return Option[T]{}
+}
+
+// OptionOf returns Some(item) if ok, otherwise None, e.g. OptionOf(m[key]).
+func OptionOf[T any](item T, ok bool) Option[T] {
+	if !ok {
+		return None[T]()
+	}
+	return Some(item)
+}
+
+func (o Option[T]) IsSome() bool {
+	return o.hasItem
+}
+
+func (o Option[T]) IsNone() bool {
+	return !o.hasItem
+}
+
+func (o Option[T]) Get() (T, bool) {
+	return o.item, o.hasItem
+}
+
+func (o *Option[T]) Set(item T) {
+	o.item = item
+	o.hasItem = true
+}
+
+// Swap sets item and returns the previous item and whether there was one.
+func (o *Option[T]) Swap(item T) (T, bool) {
+	oldItem, hasItem := o.item, o.hasItem
+	o.Set(item)
+	return oldItem, hasItem
+}
+
+// Take returns the item and leaves the option empty, it panics if there is no item.
+func (o *Option[T]) Take() T {
+	if !o.hasItem {
+		panic("no item")
+	}
+	item := o.item
+	*o = Option[T]{}
+	return item
+}
+
+func (o Option[T]) Unwrap() T {
+	if !o.hasItem {
+		panic("no item")
+	}
+	return o.item
+}
+
+func (o Option[T]) UnwrapOr(defaultValue T) T {
+	if o.hasItem {
+		return o.item
+	}
+	return defaultValue
+}
+
+func (o Option[T]) UnwrapOrElse(f func() T) T {
+	if o.hasItem {
+		return o.item
+	}
+	return f()
+}
+
+// OrElse returns o if it has an item, otherwise the result of f.
+func (o Option[T]) OrElse(f func() Option[T]) Option[T] {
+	if o.hasItem {
+		return o
+	}
+	return f()
+}
+
+// OkOr converts o to a Result with err if there is no item.
+func (o Option[T]) OkOr(err error) Result[T] {
+	if !o.hasItem {
+		return Err[T](err)
+	}
+	return Ok(o.item)
+}
+
+// MapOption applies f to the item of o, if any.
+func MapOption[T, U any](o Option[T], f func(T) U) Option[U] {
+	if !o.hasItem {
+		return None[U]()
+	}
+	return Some(f(o.item))
+}
+
+// AndThenOption calls f with the item of o, if any.
+func AndThenOption[T, U any](o Option[T], f func(T) Option[U]) Option[U] {
+	if !o.hasItem {
+		return None[U]()
+	}
+	return f(o.item)
+}
+
+// CollectOptions returns the items of all options, or None if one of them is empty.
+func CollectOptions[T any](options []Option[T]) Option[[]T] {
+	items := make([]T, 0, len(options))
+	for _, o := range options {
+		if !o.hasItem {
+			return None[[]T]()
+		}
+		items = append(items, o.item)
+	}
+	return Some(items)
+}
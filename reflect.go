@@ -128,7 +128,7 @@ func createStructEmptyInstance(structType reflect.Type, created map[reflect.Type
 			}
 			field.Set(reflect.ValueOf(createStructEmptyInstance(field.Type(), created)))
 		} else {
-			field.Set(reflect.ValueOf(createEmptyInstance(field.Type(), created)))
+			setNonNil(field, createEmptyInstance(field.Type(), created))
 		}
 	}
 	return value.Interface()
@@ -136,6 +136,14 @@ func createStructEmptyInstance(structType reflect.Type, created map[reflect.Type
 
 const defaultMapKey = "key"
 
+// setNonNil sets v to x, a nil x (the zero value of an interface type) leaves v untouched.
+func setNonNil(v reflect.Value, x interface{}) {
+	if x == nil {
+		return
+	}
+	v.Set(reflect.ValueOf(x))
+}
+
 // DeepCreateEmptyInstance create a empty instance of the type,
 // recursively create the instance of the struct field,include the struct field's pointer
 func DeepCreateEmptyInstance(rType reflect.Type) interface{} {
@@ -164,15 +172,19 @@ func createEmptyInstance(rType reflect.Type, created map[reflect.Type]bool) inte
 	switch value.Kind() {
 	case reflect.Slice:
 		slice := reflect.MakeSlice(rType, 1, 1)
-		slice.Index(0).Set(reflect.ValueOf(createEmptyInstance(rType.Elem(), created)))
+		setNonNil(slice.Index(0), createEmptyInstance(rType.Elem(), created))
 		return slice.Interface()
 	case reflect.Map:
 		m := reflect.MakeMap(rType)
+		key := reflect.New(rType.Key()).Elem()
 		if rType.Key().Kind() == reflect.String {
-			m.SetMapIndex(reflect.ValueOf(defaultMapKey), reflect.ValueOf(createEmptyInstance(rType.Elem(), created)))
+			key.SetString(defaultMapKey)
 		} else {
-			m.SetMapIndex(reflect.ValueOf(createEmptyInstance(rType.Key(), created)), reflect.ValueOf(createEmptyInstance(rType.Elem(), created)))
+			setNonNil(key, createEmptyInstance(rType.Key(), created))
 		}
+		elem := reflect.New(rType.Elem()).Elem()
+		setNonNil(elem, createEmptyInstance(rType.Elem(), created))
+		m.SetMapIndex(key, elem)
 		return m.Interface()
 	case reflect.Pointer:
 		if created[rType] {
@@ -180,7 +192,7 @@ func createEmptyInstance(rType reflect.Type, created map[reflect.Type]bool) inte
 		}
 		instance := createEmptyInstance(rType.Elem(), created)
 		ptrInstance := reflect.New(rType.Elem())
-		ptrInstance.Elem().Set(reflect.ValueOf(instance))
+		setNonNil(ptrInstance.Elem(), instance)
 		return ptrInstance.Interface()
 	case reflect.Struct:
 		if created[rType] {
@@ -1,5 +1,7 @@
 package doraemon
 
+import "fmt"
+
 type Pair[T1, T2 any] struct {
 	First  T1
 	Second T2
@@ -62,3 +64,82 @@ func (r Result[T]) UnwrapOrElse(f func(error) T) T {
 func (r Result[T]) GoResult() (T, error) {
 	return r.Value, r.Err
 }
+
+// Context wraps the error of r with msg, e.g. "read config: <err>". An ok result is returned unchanged.
+func (r Result[T]) Context(msg string) Result[T] {
+	if r.IsOk() {
+		return r
+	}
+	return Err[T](fmt.Errorf("%s: %w", msg, r.Err))
+}
+
+// Contextf is like Context with a formatted message.
+func (r Result[T]) Contextf(format string, args ...any) Result[T] {
+	if r.IsOk() {
+		return r
+	}
+	return Err[T](fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), r.Err))
+}
+
+// OrElse returns r if it is ok, otherwise the result of f called with the error.
+func (r Result[T]) OrElse(f func(error) Result[T]) Result[T] {
+	if r.IsOk() {
+		return r
+	}
+	return f(r.Err)
+}
+
+// Ok converts r to an Option, discarding the error.
+func (r Result[T]) Ok() Option[T] {
+	if r.IsErr() {
+		return None[T]()
+	}
+	return Some(r.Value)
+}
+
+// MapResult applies f to the value of an ok result, errors are passed through.
+func MapResult[T, U any](r Result[T], f func(T) U) Result[U] {
+	if r.IsErr() {
+		return Err[U](r.Err)
+	}
+	return Ok(f(r.Value))
+}
+
+// AndThen calls the fallible f with the value of an ok result, errors are passed through.
+func AndThen[T, U any](r Result[T], f func(T) Result[U]) Result[U] {
+	if r.IsErr() {
+		return Err[U](r.Err)
+	}
+	return f(r.Value)
+}
+
+// Collect returns the values of all results, or the first error.
+func Collect[T any](results []Result[T]) Result[[]T] {
+	values := make([]T, 0, len(results))
+	for _, r := range results {
+		if r.IsErr() {
+			return Err[[]T](r.Err)
+		}
+		values = append(values, r.Value)
+	}
+	return Ok(values)
+}
+
+// Try converts the return values of f into a Result. A panic in f is recovered
+// and returned as an error.
+func Try[T any](f func() (T, error)) (r Result[T]) {
+	defer func() {
+		if e := recover(); e != nil {
+			if err, ok := e.(error); ok {
+				r = Err[T](fmt.Errorf("panic: %w", err))
+			} else {
+				r = Err[T](fmt.Errorf("panic: %v", e))
+			}
+		}
+	}()
+	value, err := f()
+	if err != nil {
+		return Err[T](err)
+	}
+	return Ok(value)
+}
@@ -0,0 +1,82 @@
+package doraemon
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestResultCombinators(t *testing.T) {
+	parse := func(s string) Result[int] { return Try(func() (int, error) { return strconv.Atoi(s) }) }
+
+	r := MapResult(parse("21"), func(n int) int { return n * 2 })
+	if r.Unwrap() != 42 {
+		t.Fatalf("MapResult = %v", r)
+	}
+	s := AndThen(parse("7"), func(n int) Result[string] { return Ok(strings.Repeat("a", n)) })
+	if s.Unwrap() != "aaaaaaa" {
+		t.Fatalf("AndThen = %v", s)
+	}
+
+	errBad := errors.New("bad")
+	failed := AndThen(Err[int](errBad), func(n int) Result[string] {
+		t.Fatal("AndThen called f on an error")
+		return Ok("")
+	}).Context("load")
+	if !errors.Is(failed.Err, errBad) || failed.Err.Error() != "load: bad" {
+		t.Fatalf("unexpected error %v", failed.Err)
+	}
+	if e := parse("x").Contextf("parse %q", "x"); !strings.HasPrefix(e.Err.Error(), `parse "x": `) {
+		t.Fatalf("unexpected error %v", e.Err)
+	}
+	if v := parse("x").OrElse(func(error) Result[int] { return Ok(1) }).Unwrap(); v != 1 {
+		t.Fatalf("OrElse = %d", v)
+	}
+
+	all := Collect([]Result[int]{parse("1"), parse("2")})
+	if len(all.Unwrap()) != 2 || all.Value[1] != 2 {
+		t.Fatalf("Collect = %v", all)
+	}
+	if Collect([]Result[int]{parse("1"), parse("x")}).IsOk() {
+		t.Fatal("Collect ignored an error")
+	}
+
+	panicked := Try(func() (int, error) { panic("boom") })
+	if panicked.IsOk() || !strings.Contains(panicked.Err.Error(), "boom") {
+		t.Fatalf("Try did not recover the panic: %v", panicked)
+	}
+}
+
+func TestOption(t *testing.T) {
+	m := map[string]int{"a": 1}
+	a := OptionOf(m["a"], true)
+	if a.Unwrap() != 1 || MapOption(a, strconv.Itoa).Unwrap() != "1" {
+		t.Fatal("unexpected Some")
+	}
+	v, ok := m["b"]
+	b := OptionOf(v, ok)
+	if b.IsSome() || b.UnwrapOr(5) != 5 || b.OrElse(func() Option[int] { return Some(6) }).Unwrap() != 6 {
+		t.Fatal("unexpected None")
+	}
+	errMissing := errors.New("missing")
+	if !errors.Is(b.OkOr(errMissing).Err, errMissing) {
+		t.Fatal("OkOr did not return the error")
+	}
+	if CollectOptions([]Option[int]{a, b}).IsSome() || CollectOptions([]Option[int]{a, a}).IsNone() {
+		t.Fatal("unexpected CollectOptions")
+	}
+
+	if old, had := b.Swap(3); had || old != 0 {
+		t.Fatal("Swap on None reported an item")
+	}
+	if b.Take() != 3 || b.IsSome() {
+		t.Fatal("Take did not empty the option")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Take on None did not panic")
+		}
+	}()
+	b.Take()
+}
@@ -0,0 +1,252 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Clock is the source of time of Retry and other time based utilities,
+// it can be replaced in tests to avoid waiting.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+// BackoffPolicy computes the delay before the next attempt of Retry.
+type BackoffPolicy interface {
+	// NextDelay returns the delay after the failed attempt (1-based), prev is the previous delay (0 after the first attempt).
+	NextDelay(attempt int, prev time.Duration) time.Duration
+}
+
+// ConstantBackoff waits the same Delay between attempts.
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b ConstantBackoff) NextDelay(int, time.Duration) time.Duration {
+	return b.Delay
+}
+
+// ExponentialBackoff waits Initial * Multiplier^(attempt-1), capped at Max.
+// Jitter is the randomization factor in [0, 1], the delay is randomly chosen
+// in [delay*(1-Jitter), delay*(1+Jitter)].
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultExponentialBackoff starts at 100ms and doubles up to 10s with a 0.5 jitter.
+var DefaultExponentialBackoff = ExponentialBackoff{
+	Initial:    100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.5,
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, _ time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if b.Initial <= 0 {
+		return 0
+	}
+	delay := float64(b.Initial) * math.Pow(multiplier, float64(attempt-1))
+	if b.Jitter > 0 {
+		delay *= 1 - b.Jitter + 2*b.Jitter*rand.Float64()
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	// the power overflows after enough attempts without Max, a Duration cannot hold more
+	if delay >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(delay)
+}
+
+// DecorrelatedJitterBackoff waits a random delay in [Base, prev*3], capped at Max,
+// as described in https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+// Base is 100ms if 0.
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+const defaultDecorrelatedJitterBase = 100 * time.Millisecond
+
+func (b DecorrelatedJitterBackoff) NextDelay(_ int, prev time.Duration) time.Duration {
+	base := b.Base
+	if base <= 0 {
+		base = defaultDecorrelatedJitterBase
+	}
+	upper := time.Duration(math.MaxInt64)
+	if prev < math.MaxInt64/3 {
+		upper = max(prev*3, base)
+	}
+	delay := base
+	if upper > base {
+		delay += rand.N(upper - base)
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// PermanentError marks err as not retryable, Retry returns it immediately.
+func PermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanentError reports whether err or an error it wraps was marked by PermanentError.
+func IsPermanentError(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// ErrRetryExhausted is wrapped by the error of Retry when the attempts or the elapsed time are exhausted.
+var ErrRetryExhausted = errors.New("retry exhausted")
+
+type retryConfig struct {
+	policy      BackoffPolicy
+	maxAttempts int
+	maxElapsed  time.Duration
+	retryIf     func(error) bool
+	onRetry     func(attempt int, err error, delay time.Duration)
+	clock       Clock
+}
+
+// RetryOption configures Retry.
+type RetryOption func(*retryConfig)
+
+// RetryWithBackoff sets the backoff policy, DefaultExponentialBackoff by default.
+func RetryWithBackoff(policy BackoffPolicy) RetryOption {
+	return func(c *retryConfig) {
+		if policy != nil {
+			c.policy = policy
+		}
+	}
+}
+
+// RetryWithMaxAttempts limits the number of calls of the operation, 0 means no limit.
+// The default is 5 attempts.
+func RetryWithMaxAttempts(n int) RetryOption {
+	return func(c *retryConfig) {
+		c.maxAttempts = n
+	}
+}
+
+// RetryWithMaxElapsed stops retrying once the next attempt would start more than d after the first one,
+// 0 means no limit.
+func RetryWithMaxElapsed(d time.Duration) RetryOption {
+	return func(c *retryConfig) {
+		c.maxElapsed = d
+	}
+}
+
+// RetryWithRetryIf classifies errors, the errors for which retryIf returns false are permanent.
+func RetryWithRetryIf(retryIf func(error) bool) RetryOption {
+	return func(c *retryConfig) {
+		c.retryIf = retryIf
+	}
+}
+
+// RetryWithOnRetry sets a hook called after each failed attempt that will be retried, with the delay before the next one.
+func RetryWithOnRetry(onRetry func(attempt int, err error, delay time.Duration)) RetryOption {
+	return func(c *retryConfig) {
+		c.onRetry = onRetry
+	}
+}
+
+// RetryWithClock replaces the SystemClock, for tests.
+func RetryWithClock(clock Clock) RetryOption {
+	return func(c *retryConfig) {
+		if clock != nil {
+			c.clock = clock
+		}
+	}
+}
+
+// Retry calls op until it succeeds, returns a permanent error (see PermanentError and RetryWithRetryIf),
+// the attempts or elapsed time are exhausted, or ctx is done. By default op is attempted up to
+// 5 times with DefaultExponentialBackoff between attempts.
+//
+// When retrying is given up, the error wraps the last error of op, and ErrRetryExhausted or ctx.Err().
+// Permanent errors are returned unwrapped from the PermanentError marker.
+func Retry[T any](ctx context.Context, op func() (T, error), opts ...RetryOption) Result[T] {
+	c := retryConfig{
+		policy:      DefaultExponentialBackoff,
+		maxAttempts: 5,
+		clock:       SystemClock,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	start := c.clock.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return Err[T](err)
+		}
+		value, err := op()
+		if err == nil {
+			return Ok(value)
+		}
+		var p *permanentError
+		if errors.As(err, &p) {
+			if p == err {
+				return Err[T](p.err)
+			}
+			return Err[T](err)
+		}
+		if c.retryIf != nil && !c.retryIf(err) {
+			return Err[T](err)
+		}
+		if c.maxAttempts > 0 && attempt >= c.maxAttempts {
+			return Err[T](fmt.Errorf("%w after %d attempts: %w", ErrRetryExhausted, attempt, err))
+		}
+		delay = c.policy.NextDelay(attempt, delay)
+		if c.maxElapsed > 0 && c.clock.Now().Add(delay).Sub(start) > c.maxElapsed {
+			return Err[T](fmt.Errorf("%w after %s: %w", ErrRetryExhausted, c.clock.Now().Sub(start), err))
+		}
+		if c.onRetry != nil {
+			c.onRetry(attempt, err, delay)
+		}
+		select {
+		case <-ctx.Done():
+			return Err[T](fmt.Errorf("%w: %w", ctx.Err(), err))
+		case <-c.clock.After(delay):
+		}
+	}
+}
+
+// RetryResult is like Retry for an operation that returns a Result.
+func RetryResult[T any](ctx context.Context, op func() Result[T], opts ...RetryOption) Result[T] {
+	return Retry(ctx, func() (T, error) { return op().GoResult() }, opts...)
+}
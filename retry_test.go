@@ -0,0 +1,116 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeClock advances its time by the requested duration instead of waiting.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestRetry(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	errFlaky := errors.New("flaky")
+	calls := 0
+	var delays []time.Duration
+	r := Retry(context.Background(), func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errFlaky
+		}
+		return 42, nil
+	},
+		RetryWithBackoff(ExponentialBackoff{Initial: time.Second, Multiplier: 2}),
+		RetryWithClock(clock),
+		RetryWithOnRetry(func(attempt int, err error, delay time.Duration) { delays = append(delays, delay) }),
+	)
+	if r.Unwrap() != 42 || calls != 3 {
+		t.Fatalf("got %v after %d calls", r, calls)
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Fatalf("unexpected delays %v", delays)
+	}
+	if clock.now != time.Unix(3, 0) {
+		t.Fatalf("unexpected elapsed time %v", clock.now)
+	}
+
+	calls = 0
+	r = Retry(context.Background(), func() (int, error) { calls++; return 0, errFlaky },
+		RetryWithBackoff(ConstantBackoff{Delay: time.Second}), RetryWithMaxAttempts(4), RetryWithClock(clock))
+	if calls != 4 || !errors.Is(r.Err, ErrRetryExhausted) || !errors.Is(r.Err, errFlaky) {
+		t.Fatalf("unexpected %v after %d calls", r.Err, calls)
+	}
+
+	calls = 0
+	r = Retry(context.Background(), func() (int, error) { calls++; return 0, errFlaky },
+		RetryWithBackoff(ConstantBackoff{Delay: time.Second}), RetryWithMaxAttempts(0),
+		RetryWithMaxElapsed(5*time.Second), RetryWithClock(clock))
+	if calls != 6 || !errors.Is(r.Err, ErrRetryExhausted) {
+		t.Fatalf("unexpected %v after %d calls", r.Err, calls)
+	}
+
+	calls = 0
+	r = Retry(context.Background(), func() (int, error) { calls++; return 0, PermanentError(errFlaky) }, RetryWithClock(clock))
+	if calls != 1 || r.Err != errFlaky {
+		t.Fatalf("permanent error retried: %v after %d calls", r.Err, calls)
+	}
+	calls = 0
+	r = Retry(context.Background(), func() (int, error) { calls++; return 0, errFlaky },
+		RetryWithRetryIf(func(err error) bool { return !errors.Is(err, errFlaky) }), RetryWithClock(clock))
+	if calls != 1 || r.Err != errFlaky {
+		t.Fatalf("classified error retried: %v after %d calls", r.Err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r = RetryResult(ctx, func() Result[int] { cancel(); return Err[int](errFlaky) })
+	if !errors.Is(r.Err, context.Canceled) || !errors.Is(r.Err, errFlaky) {
+		t.Fatalf("unexpected error after cancel: %v", r.Err)
+	}
+}
+
+func TestBackoffPolicies(t *testing.T) {
+	exp := ExponentialBackoff{Initial: time.Second, Max: 5 * time.Second, Multiplier: 2, Jitter: 0.5}
+	for attempt := 1; attempt < 10; attempt++ {
+		d := exp.NextDelay(attempt, 0)
+		if d < time.Second/2 || d > 5*time.Second {
+			t.Fatalf("exponential delay %v out of range at attempt %d", d, attempt)
+		}
+	}
+	dj := DecorrelatedJitterBackoff{Base: time.Second, Max: 10 * time.Second}
+	var prev time.Duration
+	for attempt := 1; attempt < 20; attempt++ {
+		d := dj.NextDelay(attempt, prev)
+		if d < time.Second || d > 10*time.Second || (prev > 0 && d > prev*3) {
+			t.Fatalf("decorrelated jitter delay %v out of range after %v", d, prev)
+		}
+		prev = d
+	}
+
+	// without Max the exponential delay saturates instead of overflowing
+	unbounded := ExponentialBackoff{Initial: time.Second, Multiplier: 2}
+	for _, attempt := range []int{64, 1100, 1 << 20} {
+		if d := unbounded.NextDelay(attempt, 0); d != math.MaxInt64 {
+			t.Fatalf("unbounded delay %v at attempt %d", d, attempt)
+		}
+	}
+	if d := (DecorrelatedJitterBackoff{}).NextDelay(1, 0); d != defaultDecorrelatedJitterBase {
+		t.Fatalf("zero base gives %v", d)
+	}
+	if d := (DecorrelatedJitterBackoff{}).NextDelay(2, math.MaxInt64/2); d <= 0 {
+		t.Fatalf("decorrelated jitter delay overflowed: %v", d)
+	}
+}
@@ -0,0 +1,414 @@
+package doraemon
+
+import (
+	"cmp"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RotationInterval is the period of the time based rotation of a RotatingFileWriter.
+type RotationInterval int
+
+const (
+	RotateNever RotationInterval = iota
+	RotateHourly
+	RotateDaily
+)
+
+// rotationTimeFormat is the timestamp in the names of the backups, it sorts chronologically.
+const rotationTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotatingFileWriter is a log file that is rotated when it reaches a size, at fixed times, or both.
+// On rotation the file is renamed to a backup named after it with a timestamp, e.g.
+// app-2024-05-01T00-00-00.000.log for app.log, and a new file is started. Old backups are
+// gzipped and removed in the background.
+//
+// Like LazyFileWriter, the file is only created on the first write. It is safe for concurrent
+// use, and implements io.WriteCloser and Sync, so it can be the output of a StdLogger.
+type RotatingFileWriter struct {
+	mu       sync.Mutex
+	path     string
+	file     *LazyFileWriter
+	size     int64
+	opened   bool
+	closed   bool
+	rotateAt time.Time
+
+	maxSize    int64
+	interval   RotationInterval
+	maxBackups int
+	compress   bool
+	utc        bool
+	clock      Clock
+
+	// millMu serializes the background compression and removal of backups
+	millMu sync.Mutex
+	millWg sync.WaitGroup
+}
+
+var _ io.WriteCloser = (*RotatingFileWriter)(nil)
+
+// RotatingFileWriterOption configures a RotatingFileWriter.
+type RotatingFileWriterOption func(*RotatingFileWriter)
+
+// RotatingFileWriterWithMaxSize rotates the file before it exceeds maxSize bytes. 0, the default, disables it.
+func RotatingFileWriterWithMaxSize(maxSize int64) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		if maxSize >= 0 {
+			w.maxSize = maxSize
+		}
+	}
+}
+
+// RotatingFileWriterWithInterval rotates the file at each hour or day, RotateNever by default.
+func RotatingFileWriterWithInterval(interval RotationInterval) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		w.interval = interval
+	}
+}
+
+// RotatingFileWriterWithMaxBackups keeps at most n backups, the oldest are removed. 0, the default, keeps all.
+func RotatingFileWriterWithMaxBackups(n int) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		if n >= 0 {
+			w.maxBackups = n
+		}
+	}
+}
+
+// RotatingFileWriterWithCompress gzips the backups in the background.
+func RotatingFileWriterWithCompress(compress bool) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		w.compress = compress
+	}
+}
+
+// RotatingFileWriterWithUTC uses UTC for the rotation times and the backup names, instead of the local time.
+func RotatingFileWriterWithUTC(utc bool) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		w.utc = utc
+	}
+}
+
+// RotatingFileWriterWithClock replaces the SystemClock, for tests.
+func RotatingFileWriterWithClock(clock Clock) RotatingFileWriterOption {
+	return func(w *RotatingFileWriter) {
+		if clock != nil {
+			w.clock = clock
+		}
+	}
+}
+
+func NewRotatingFileWriter(filePath string, opts ...RotatingFileWriterOption) *RotatingFileWriter {
+	w := &RotatingFileWriter{path: filePath, file: NewLazyFileWriter(filePath), clock: SystemClock}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Write writes p to the file, rotating it first if needed. A single write is never split across files.
+func (w *RotatingFileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	now := w.now()
+	if !w.opened {
+		w.openExisting(now)
+	}
+	if w.shouldRotate(now, int64(len(p))) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotatingFileWriter) now() time.Time {
+	now := w.clock.Now()
+	if w.utc {
+		return now.UTC()
+	}
+	return now.Local()
+}
+
+// openExisting continues an existing file, its rotation time is computed from its modification time.
+func (w *RotatingFileWriter) openExisting(now time.Time) {
+	w.opened = true
+	w.size = 0
+	start := now
+	if info, err := os.Stat(w.path); err == nil {
+		w.size = info.Size()
+		start = info.ModTime().In(now.Location())
+	}
+	w.rotateAt = nextRotation(start, w.interval)
+}
+
+func (w *RotatingFileWriter) shouldRotate(now time.Time, n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.maxSize > 0 && w.size+n > w.maxSize {
+		return true
+	}
+	return w.interval != RotateNever && !now.Before(w.rotateAt)
+}
+
+// nextRotation returns the start of the period after the one of t.
+func nextRotation(t time.Time, interval RotationInterval) time.Time {
+	switch interval {
+	case RotateHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+	case RotateDaily:
+		return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Time{}
+}
+
+// Rotate closes the file, renames it to a backup and starts a new file.
+func (w *RotatingFileWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate(w.now())
+}
+
+func (w *RotatingFileWriter) rotate(now time.Time) error {
+	if w.file.IsCreated() {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+	}
+	w.file = NewLazyFileWriter(w.path)
+	if err := os.Rename(w.path, GenerateUniqueFilepath(w.backupName(now))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	w.size = 0
+	w.rotateAt = nextRotation(now, w.interval)
+
+	w.millWg.Add(1)
+	go func() {
+		defer w.millWg.Done()
+		w.mill()
+	}()
+	return nil
+}
+
+func (w *RotatingFileWriter) backupName(t time.Time) string {
+	dir, base := filepath.Split(w.path)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+t.Format(rotationTimeFormat)+ext)
+}
+
+// Backups returns the paths of the backups, the oldest first.
+func (w *RotatingFileWriter) Backups() ([]string, error) {
+	dir, base := filepath.Split(w.path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		path string
+		time time.Time
+		n    int
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := name[len(prefix):]
+		if len(stamp) < len(rotationTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(rotationTimeFormat, stamp[:len(rotationTimeFormat)])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), time: t, n: uniqueSuffix(stamp[len(rotationTimeFormat):])})
+	}
+	// (10) must come after (9), and a timestamp without suffix before (1)
+	slices.SortFunc(backups, func(a, b backup) int {
+		if c := a.time.Compare(b.time); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.n, b.n); c != 0 {
+			return c
+		}
+		return strings.Compare(a.path, b.path)
+	})
+	paths := make([]string, len(backups))
+	for i, b := range backups {
+		paths[i] = b.path
+	}
+	return paths, nil
+}
+
+// uniqueSuffix returns n of the (n) suffix added by GenerateUniqueFilepath at the start of
+// rest, 0 if there is none.
+func uniqueSuffix(rest string) int {
+	if !strings.HasPrefix(rest, "(") {
+		return 0
+	}
+	digits, _, ok := strings.Cut(rest[1:], ")")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// mill compresses the backups and removes the oldest ones.
+func (w *RotatingFileWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+	backups, err := w.Backups()
+	if err != nil {
+		return
+	}
+	if w.maxBackups > 0 && len(backups) > w.maxBackups {
+		for _, b := range backups[:len(backups)-w.maxBackups] {
+			_ = os.Remove(b)
+		}
+		backups = backups[len(backups)-w.maxBackups:]
+	}
+	if !w.compress {
+		return
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".gz") {
+			_ = gzipFile(b)
+		}
+	}
+}
+
+// gzipFile replaces name by name.gz.
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := NewAtomicWriter(name+".gz", AtomicWriteOptions{Perm: info.Mode().Perm()})
+	if err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		_ = out.Abort()
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		_ = out.Abort()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Reopen closes the file and opens it again on the next write, e.g. after it was moved by
+// an external tool like logrotate.
+func (w *RotatingFileWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	var err error
+	if w.file.IsCreated() {
+		err = w.file.Close()
+	}
+	w.file = NewLazyFileWriter(w.path)
+	w.opened = false
+	return err
+}
+
+// ReopenOnSignal calls Reopen each time one of sigs is received, SIGHUP by default,
+// until stop is called.
+func (w *RotatingFileWriter) ReopenOnSignal(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		for {
+			select {
+			case <-ch:
+				_ = w.Reopen()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// Sync flushes the file to disk, it does nothing if the file was not created yet.
+func (w *RotatingFileWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if !w.file.IsCreated() {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Close closes the file and waits for the background compression of the backups.
+func (w *RotatingFileWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	var err error
+	if w.file.IsCreated() {
+		err = w.file.Close()
+	}
+	w.mu.Unlock()
+	w.millWg.Wait()
+	return err
+}
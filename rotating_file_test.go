@@ -0,0 +1,164 @@
+package doraemon
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileWriter_Size(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	w := NewRotatingFileWriter(name,
+		RotatingFileWriterWithMaxSize(10),
+		RotatingFileWriterWithMaxBackups(2),
+		RotatingFileWriterWithCompress(true),
+		RotatingFileWriterWithUTC(true),
+		RotatingFileWriterWithClock(clock),
+	)
+	for i := 0; i < 4; i++ {
+		clock.now = clock.now.Add(time.Second)
+		if _, err := w.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed, got %v", err)
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"app-2024-05-01T10-00-03.000.log.gz", "app-2024-05-01T10-00-04.000.log.gz"}
+	if len(backups) != 2 || filepath.Base(backups[0]) != want[0] || filepath.Base(backups[1]) != want[1] {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+	f, err := os.Open(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(gr); string(data) != "12345678\n" {
+		t.Fatalf("unexpected backup content %q", data)
+	}
+	if data, _ := os.ReadFile(name); string(data) != "12345678\n" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestRotatingFileWriter_Daily(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)}
+	w := NewRotatingFileWriter(name,
+		RotatingFileWriterWithInterval(RotateDaily),
+		RotatingFileWriterWithUTC(true),
+		RotatingFileWriterWithClock(clock),
+	)
+	defer w.Close()
+	_, _ = w.Write([]byte("day 1\n"))
+	clock.now = clock.now.Add(30 * time.Second)
+	_, _ = w.Write([]byte("day 1 again\n"))
+	clock.now = clock.now.Add(time.Minute)
+	_, _ = w.Write([]byte("day 2\n"))
+
+	backups, _ := w.Backups()
+	if len(backups) != 1 || filepath.Base(backups[0]) != "app-2024-05-02T00-00-30.000.log" {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != "day 1\nday 1 again\n" {
+		t.Fatalf("unexpected backup content %q", data)
+	}
+}
+
+func TestRotatingFileWriter_BackupsOrder(t *testing.T) {
+	dir := t.TempDir()
+	w := NewRotatingFileWriter(filepath.Join(dir, "app.log"))
+	defer w.Close()
+	want := []string{
+		"app-2024-05-01T09-00-00.000(2).log.gz",
+		"app-2024-05-01T10-00-00.000.log.gz",
+		"app-2024-05-01T10-00-00.000(1).log",
+		"app-2024-05-01T10-00-00.000(2).log.gz",
+		"app-2024-05-01T10-00-00.000(10).log.gz",
+		"app-2024-05-01T11-00-00.000.log",
+	}
+	for _, name := range want {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := w.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != len(want) {
+		t.Fatalf("unexpected backups %v", backups)
+	}
+	for i, b := range backups {
+		if filepath.Base(b) != want[i] {
+			t.Fatalf("unexpected order %v", backups)
+		}
+	}
+}
+
+func TestRotatingFileWriter_ReopenAndConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	w := NewRotatingFileWriter(name, RotatingFileWriterWithMaxSize(1000))
+	defer w.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = w.Write([]byte("0123456789\n"))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an external tool moves the file away, Reopen starts a new one
+	if err := os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("after reopen\n"))
+	if data, _ := os.ReadFile(name); string(data) != "after reopen\n" {
+		t.Fatalf("unexpected content %q", data)
+	}
+
+	total := 0
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		data, _ := os.ReadFile(filepath.Join(dir, e.Name()))
+		if len(data) > 1000 {
+			t.Fatalf("%s exceeds the max size: %d", e.Name(), len(data))
+		}
+		total += strings.Count(string(data), "0123456789\n")
+	}
+	if total != 400 {
+		t.Fatalf("expected 400 lines, got %d", total)
+	}
+}
@@ -36,7 +36,7 @@ func (kv *SimpleKV) save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(kv.dbPath, jsonData, 0644)
+	return WriteFileAtomic(kv.dbPath, jsonData, AtomicWriteOptions{Perm: 0644})
 }
 
 func (kv *SimpleKV) Get(key string) (string, bool) {
@@ -61,6 +61,29 @@ func (kv *SimpleKV) Delete(key string) error {
 	return nil
 }
 
+// DeleteMany deletes keys with a single save of the database.
+func (kv *SimpleKV) DeleteMany(keys ...string) error {
+	kv.dataLock.Lock()
+	defer kv.dataLock.Unlock()
+	deleted := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if v, ok := kv.data[key]; ok {
+			deleted[key] = v
+			delete(kv.data, key)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	if err := kv.save(); err != nil {
+		for key, v := range deleted {
+			kv.data[key] = v
+		}
+		return err
+	}
+	return nil
+}
+
 func (kv *SimpleKV) Set(key, value string) error {
 	kv.dataLock.Lock()
 	defer kv.dataLock.Unlock()
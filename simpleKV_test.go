@@ -2,6 +2,7 @@ package doraemon
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -191,6 +192,10 @@ func TestSimpleKV_Set2(t *testing.T) {
 			t.Fatal(err)
 		}
 		defer f.Close()
+		if probe, err := os.OpenFile(fileName, os.O_WRONLY, 0); err == nil {
+			probe.Close()
+			t.Skip("files without permissions are writable by this user, e.g. root")
+		}
 		err = db.Set(key, value)
 		if err == nil {
 			t.Error("Expected an error but got nil")
@@ -202,3 +207,29 @@ func TestSimpleKV_Set2(t *testing.T) {
 		}
 	})
 }
+
+func TestSimpleKV_DeleteMany(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "test.db")
+	kv, err := NewSimpleKV(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := kv.Set(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := kv.DeleteMany("a", "c", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	kv, err = NewSimpleKV(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, hasA := kv.Get("a")
+	_, hasB := kv.Get("b")
+	_, hasC := kv.Get("c")
+	if hasA || !hasB || hasC {
+		t.Fatalf("unexpected keys after DeleteMany: a=%v b=%v c=%v", hasA, hasB, hasC)
+	}
+}
@@ -0,0 +1,445 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RestartPolicy tells a Supervisor when to restart a child.
+type RestartPolicy int
+
+const (
+	// RestartPermanent always restarts the child when it returns.
+	RestartPermanent RestartPolicy = iota
+	// RestartTransient restarts the child only when it fails, with an error or a panic.
+	RestartTransient
+	// RestartTemporary never restarts the child.
+	RestartTemporary
+)
+
+// SupervisorStrategy tells a Supervisor which children to restart when one is restarted.
+type SupervisorStrategy int
+
+const (
+	// OneForOne restarts only the child that returned.
+	OneForOne SupervisorStrategy = iota
+	// OneForAll stops all the other children and restarts them with the child that returned.
+	// A child is only started again once its previous run has returned, even after its
+	// shutdown timeout, so that two runs of a child never overlap.
+	OneForAll
+)
+
+// ErrRestartIntensity is returned by Supervisor.Run when the children are restarted too often.
+var ErrRestartIntensity = errors.New("supervisor: restart intensity exceeded")
+
+// PanicError is the error of a child of a Supervisor that panicked.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// ChildSpec describes a child of a Supervisor.
+type ChildSpec struct {
+	Name string
+	// Run is the child, it must return when ctx is done.
+	Run     func(ctx context.Context) error
+	Restart RestartPolicy
+	// ShutdownTimeout is how long the supervisor waits for Run to return after canceling its context,
+	// the default of the supervisor if 0.
+	ShutdownTimeout time.Duration
+}
+
+type supervisedChild struct {
+	spec ChildSpec
+	// generation identifies the current run, the exits of previous runs are ignored
+	generation int
+	running    bool
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+type childExit struct {
+	child      *supervisedChild
+	generation int
+	err        error
+}
+
+// Supervisor runs long-running goroutines (children) and restarts them when they return,
+// following their RestartPolicy and the SupervisorStrategy. If the children are restarted
+// more than the intensity allows, all children are stopped and Run fails.
+//
+// A Supervisor is a child itself through its Run method, so supervisors can be nested into a tree:
+//
+//	root.Add("workers", workers.Run)
+type Supervisor struct {
+	mu       sync.Mutex
+	children []*supervisedChild
+	running  bool
+	// ctx and the channels are those of the current or last run, see Run
+	ctx   context.Context
+	adds  chan *supervisedChild
+	exits chan childExit
+	quit  chan struct{}
+
+	strategy        SupervisorStrategy
+	maxRestarts     int
+	period          time.Duration
+	restarts        []time.Time
+	backoff         BackoffPolicy
+	shutdownTimeout time.Duration
+	panicHandlers   []func(any)
+	onRestart       func(name string, err error)
+	clock           Clock
+}
+
+// SupervisorOption configures a Supervisor.
+type SupervisorOption func(*Supervisor)
+
+// SupervisorWithStrategy sets the restart strategy, OneForOne by default.
+func SupervisorWithStrategy(strategy SupervisorStrategy) SupervisorOption {
+	return func(s *Supervisor) {
+		s.strategy = strategy
+	}
+}
+
+// SupervisorWithIntensity allows at most maxRestarts restarts within period, 3 in 5 seconds by default.
+func SupervisorWithIntensity(maxRestarts int, period time.Duration) SupervisorOption {
+	return func(s *Supervisor) {
+		if maxRestarts >= 0 && period > 0 {
+			s.maxRestarts = maxRestarts
+			s.period = period
+		}
+	}
+}
+
+// SupervisorWithBackoff sets the delay before a restart, the attempt passed to the policy is
+// the number of restarts within the intensity period. The default grows from 100ms to 5s.
+func SupervisorWithBackoff(policy BackoffPolicy) SupervisorOption {
+	return func(s *Supervisor) {
+		if policy != nil {
+			s.backoff = policy
+		}
+	}
+}
+
+// SupervisorWithShutdownTimeout sets the default ChildSpec.ShutdownTimeout, 5 seconds by default.
+func SupervisorWithShutdownTimeout(d time.Duration) SupervisorOption {
+	return func(s *Supervisor) {
+		if d > 0 {
+			s.shutdownTimeout = d
+		}
+	}
+}
+
+// SupervisorWithPanicHandlers adds handlers called with the value of a panic in a child,
+// after the global PanicHandlers.
+func SupervisorWithPanicHandlers(handlers ...func(recoveredErr any)) SupervisorOption {
+	return func(s *Supervisor) {
+		s.panicHandlers = append(s.panicHandlers, handlers...)
+	}
+}
+
+// SupervisorWithOnRestart sets a hook called before a child is restarted, with the error it returned.
+func SupervisorWithOnRestart(onRestart func(name string, err error)) SupervisorOption {
+	return func(s *Supervisor) {
+		s.onRestart = onRestart
+	}
+}
+
+// SupervisorWithClock replaces the SystemClock, for tests.
+func SupervisorWithClock(clock Clock) SupervisorOption {
+	return func(s *Supervisor) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+func NewSupervisor(opts ...SupervisorOption) *Supervisor {
+	s := &Supervisor{
+		maxRestarts:     3,
+		period:          5 * time.Second,
+		backoff:         ExponentialBackoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second, Multiplier: 2},
+		shutdownTimeout: 5 * time.Second,
+		clock:           SystemClock,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Add adds a permanent child, see AddChild.
+func (s *Supervisor) Add(name string, run func(ctx context.Context) error) error {
+	return s.AddChild(ChildSpec{Name: name, Run: run})
+}
+
+// AddChild adds a child, it is started immediately if the supervisor is running.
+// The children are started in the order they are added and stopped in reverse order.
+func (s *Supervisor) AddChild(spec ChildSpec) error {
+	if spec.Run == nil {
+		return fmt.Errorf("supervisor: child %s has no Run function", spec.Name)
+	}
+	if spec.ShutdownTimeout <= 0 {
+		spec.ShutdownTimeout = s.shutdownTimeout
+	}
+	c := &supervisedChild{spec: spec}
+
+	s.mu.Lock()
+	for _, other := range s.children {
+		if other.spec.Name == spec.Name {
+			s.mu.Unlock()
+			return fmt.Errorf("supervisor: child %s already exists", spec.Name)
+		}
+	}
+	if !s.running {
+		s.children = append(s.children, c)
+		s.mu.Unlock()
+		return nil
+	}
+	adds, quit := s.adds, s.quit
+	s.mu.Unlock()
+
+	select {
+	case adds <- c:
+		return nil
+	case <-quit:
+		return errors.New("supervisor: stopped")
+	}
+}
+
+// Run starts the children and supervises them until ctx is done, then stops them in
+// reverse order and returns nil. It also returns nil when all children have returned
+// and none is to be restarted. When the restart intensity is exceeded, all children
+// are stopped and the error wraps ErrRestartIntensity and the error of the last child.
+//
+// Run can be called again once it has returned, which is how a parent supervisor restarts a
+// nested one; the remaining children are started again once their previous runs have returned.
+// It must not be called concurrently.
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return errors.New("supervisor: already running")
+	}
+	s.running = true
+	s.ctx = ctx
+	s.adds = make(chan *supervisedChild)
+	s.exits = make(chan childExit)
+	s.quit = make(chan struct{})
+	s.restarts = nil
+	children := slices.Clone(s.children)
+	adds, exits, quit := s.adds, s.exits, s.quit
+	s.mu.Unlock()
+	defer close(quit)
+
+	for _, c := range children {
+		if !s.waitStopped(ctx, c) {
+			break
+		}
+		s.start(c)
+	}
+	for {
+		if s.runningCount() == 0 {
+			s.setStopped()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.setStopped()
+			s.stopAll()
+			return nil
+		case c := <-adds:
+			s.mu.Lock()
+			s.children = append(s.children, c)
+			s.mu.Unlock()
+			s.start(c)
+		case exit := <-exits:
+			if exit.generation != exit.child.generation {
+				continue
+			}
+			exit.child.running = false
+			if err := s.handleExit(ctx, exit); err != nil {
+				s.setStopped()
+				s.stopAll()
+				return err
+			}
+		}
+	}
+}
+
+func (s *Supervisor) setStopped() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) runningCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.children {
+		if c.running {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Supervisor) handleExit(ctx context.Context, exit childExit) error {
+	c := exit.child
+	restart := c.spec.Restart == RestartPermanent || (c.spec.Restart == RestartTransient && exit.err != nil)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if !restart {
+		s.remove(c)
+		return nil
+	}
+
+	now := s.clock.Now()
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.period {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = recent
+	if len(s.restarts) >= s.maxRestarts {
+		return fmt.Errorf("%w: %d restarts in %s, child %s: %w", ErrRestartIntensity, len(s.restarts), s.period, c.spec.Name, exit.err)
+	}
+	s.restarts = append(s.restarts, now)
+
+	if s.onRestart != nil {
+		s.onRestart(c.spec.Name, exit.err)
+	}
+	delay := s.backoff.NextDelay(len(s.restarts), 0)
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-s.clock.After(delay):
+	}
+
+	if s.strategy == OneForOne {
+		s.start(c)
+		return nil
+	}
+	// OneForAll: stop the others in reverse order and start the children again in order,
+	// except the temporary ones
+	s.stopAll()
+	s.mu.Lock()
+	children := make([]*supervisedChild, 0, len(s.children))
+	for _, other := range s.children {
+		if other == c || other.spec.Restart != RestartTemporary {
+			children = append(children, other)
+		}
+	}
+	s.children = children
+	s.mu.Unlock()
+	for _, other := range children {
+		if !s.waitStopped(ctx, other) {
+			return nil
+		}
+		s.start(other)
+	}
+	return nil
+}
+
+// waitStopped waits for the previous run of c to return, so that two runs never overlap.
+// It reports false if ctx is done first.
+func (s *Supervisor) waitStopped(ctx context.Context, c *supervisedChild) bool {
+	s.mu.Lock()
+	done := c.done
+	s.mu.Unlock()
+	if done == nil {
+		return true
+	}
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Supervisor) remove(c *supervisedChild) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.children {
+		if other == c {
+			s.children = append(s.children[:i], s.children[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Supervisor) start(c *supervisedChild) {
+	// the children are canceled by stopAll one by one, not all at once by the context of Run
+	ctx, cancel := context.WithCancel(context.WithoutCancel(s.ctx))
+	s.mu.Lock()
+	c.generation++
+	c.running = true
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	generation, done := c.generation, c.done
+	exits, quit := s.exits, s.quit
+	s.mu.Unlock()
+
+	go func() {
+		err := s.runChild(ctx, c.spec.Run)
+		cancel()
+		close(done)
+		select {
+		case exits <- childExit{child: c, generation: generation, err: err}:
+		case <-quit:
+		}
+	}()
+}
+
+func (s *Supervisor) runChild(ctx context.Context, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			for _, fn := range PanicHandlers {
+				fn(r)
+			}
+			for _, fn := range s.panicHandlers {
+				fn(r)
+			}
+			err = &PanicError{Value: r}
+		}
+	}()
+	return run(ctx)
+}
+
+// stopAll stops the running children in reverse order, waiting for each up to its shutdown timeout.
+func (s *Supervisor) stopAll() {
+	s.mu.Lock()
+	children := append([]*supervisedChild(nil), s.children...)
+	s.mu.Unlock()
+	for i := len(children) - 1; i >= 0; i-- {
+		c := children[i]
+		s.mu.Lock()
+		running, cancel, done := c.running, c.cancel, c.done
+		c.running = false
+		// the exit of the stopped run is ignored
+		c.generation++
+		s.mu.Unlock()
+		if !running {
+			continue
+		}
+		cancel()
+		timer := time.NewTimer(c.spec.ShutdownTimeout)
+		select {
+		case <-done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,232 @@
+package doraemon
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestSupervisor(opts ...SupervisorOption) *Supervisor {
+	opts = append([]SupervisorOption{SupervisorWithBackoff(ConstantBackoff{Delay: time.Millisecond})}, opts...)
+	return NewSupervisor(opts...)
+}
+
+func TestSupervisor_RestartPolicies(t *testing.T) {
+	handlers := PanicHandlers
+	PanicHandlers = nil
+	defer func() { PanicHandlers = handlers }()
+
+	var panics atomic.Int32
+	s := newTestSupervisor(
+		SupervisorWithIntensity(10, time.Minute),
+		SupervisorWithPanicHandlers(func(any) { panics.Add(1) }),
+	)
+	var permanent, transient, temporary atomic.Int32
+	_ = s.Add("permanent", func(ctx context.Context) error {
+		if permanent.Add(1) < 3 {
+			return nil
+		}
+		<-ctx.Done()
+		return nil
+	})
+	_ = s.AddChild(ChildSpec{Name: "transient", Restart: RestartTransient, Run: func(ctx context.Context) error {
+		if transient.Add(1) == 1 {
+			panic("boom")
+		}
+		return nil
+	}})
+	_ = s.AddChild(ChildSpec{Name: "temporary", Restart: RestartTemporary, Run: func(ctx context.Context) error {
+		temporary.Add(1)
+		return errors.New("failed")
+	}})
+	if err := s.Add("permanent", func(ctx context.Context) error { return nil }); err == nil {
+		t.Fatal("expected an error for a duplicate child")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- s.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for permanent.Load() < 3 || transient.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("children not restarted: permanent %d, transient %d", permanent.Load(), transient.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if transient.Load() != 2 || temporary.Load() != 1 || panics.Load() != 1 {
+		t.Fatalf("transient %d, temporary %d, panics %d", transient.Load(), temporary.Load(), panics.Load())
+	}
+}
+
+func TestSupervisor_Intensity(t *testing.T) {
+	errCrash := errors.New("crash")
+	var restarted []string
+	s := newTestSupervisor(
+		SupervisorWithIntensity(2, time.Minute),
+		SupervisorWithOnRestart(func(name string, err error) { restarted = append(restarted, name) }),
+	)
+	_ = s.Add("crasher", func(ctx context.Context) error { return errCrash })
+	err := s.Run(context.Background())
+	if !errors.Is(err, ErrRestartIntensity) || !errors.Is(err, errCrash) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(restarted) != 2 {
+		t.Fatalf("expected 2 restarts, got %v", restarted)
+	}
+}
+
+func TestSupervisor_OneForAllAndShutdownOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(e string) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	s := newTestSupervisor(SupervisorWithStrategy(OneForAll))
+	var starts, bRuns atomic.Int32
+	for _, name := range []string{"a", "b"} {
+		_ = s.Add(name, func(ctx context.Context) error {
+			record("start " + name)
+			starts.Add(1)
+			if name == "b" && bRuns.Add(1) == 1 {
+				return errors.New("b failed")
+			}
+			<-ctx.Done()
+			record("stop " + name)
+			return nil
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- s.Run(ctx) }()
+	for starts.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	_ = s.Add("c", func(ctx context.Context) error {
+		record("start c")
+		<-ctx.Done()
+		record("stop c")
+		return nil
+	})
+	for {
+		mu.Lock()
+		started := slices.Contains(events, "start c")
+		mu.Unlock()
+		if started {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the start order of a and b is not deterministic, the stops are
+	stops := []string{}
+	for _, e := range events {
+		if e[:4] == "stop" {
+			stops = append(stops, e)
+		}
+	}
+	want := []string{"stop a", "stop c", "stop b", "stop a"}
+	if !slices.Equal(stops, want) {
+		t.Fatalf("got stops %v, want %v (events %v)", stops, want, events)
+	}
+}
+
+func TestSupervisor_OneForAllWaitsForOldRuns(t *testing.T) {
+	s := newTestSupervisor(SupervisorWithStrategy(OneForAll), SupervisorWithShutdownTimeout(time.Millisecond))
+	var bRuns, active, overlaps atomic.Int32
+	_ = s.Add("a", func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	})
+	_ = s.Add("b", func(ctx context.Context) error {
+		if active.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer active.Add(-1)
+		if bRuns.Add(1) == 1 {
+			time.Sleep(10 * time.Millisecond)
+			return errors.New("b failed")
+		}
+		<-ctx.Done()
+		// slower than the shutdown timeout
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	_ = s.Add("c", func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return errors.New("c failed")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- s.Run(ctx) }()
+	for bRuns.Load() < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if overlaps.Load() != 0 {
+		t.Fatalf("%d runs of b overlapped a previous run", overlaps.Load())
+	}
+}
+
+func TestSupervisor_NestedRestart(t *testing.T) {
+	var runs atomic.Int32
+	inner := newTestSupervisor(SupervisorWithIntensity(0, time.Minute))
+	_ = inner.Add("job", func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			return errors.New("job failed")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	var innerErrs []error
+	root := newTestSupervisor(SupervisorWithOnRestart(func(name string, err error) { innerErrs = append(innerErrs, err) }))
+	_ = root.Add("inner", inner.Run)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- root.Run(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); runs.Load() < 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the nested supervisor was not run again, %d runs of its child", runs.Load())
+		}
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if len(innerErrs) != 1 || !errors.Is(innerErrs[0], ErrRestartIntensity) {
+		t.Fatalf("expected one restart of the nested supervisor, got %v", innerErrs)
+	}
+
+	// it can run again on its own
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { result <- inner.Run(ctx) }()
+	for deadline := time.Now().Add(5 * time.Second); runs.Load() < 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the nested supervisor was not run again, %d runs of its child", runs.Load())
+		}
+	}
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -84,23 +84,7 @@ func (rl *SlidingWindowRateLimiter) Allow() bool {
 	rl.bucketsMu.Lock()
 	defer rl.bucketsMu.Unlock()
 
-	now := time.Now()
-	subWindowDuration := rl.windowSize / time.Duration(rl.subWindowNum)
-	timePassed := now.Sub(rl.lastUpdateTime)
-	elapsedBuckets := int(timePassed / subWindowDuration)
-
-	if elapsedBuckets > 0 {
-		if elapsedBuckets > rl.subWindowNum {
-			// Maximum to clear all sub-windows
-			elapsedBuckets = rl.subWindowNum
-		}
-		// Move to the next sub-window and clear the current sub-window count
-		for range elapsedBuckets {
-			rl.currentBucket = (rl.currentBucket + 1) % rl.subWindowNum
-			rl.buckets[rl.currentBucket] = 0
-		}
-		rl.lastUpdateTime = now
-	}
+	rotateBuckets(rl.buckets, &rl.currentBucket, &rl.lastUpdateTime, rl.windowSize, time.Now())
 
 	totalRequests := 0
 	for _, count := range rl.buckets {
@@ -115,6 +99,29 @@ func (rl *SlidingWindowRateLimiter) Allow() bool {
 	return true
 }
 
+// rotateBuckets moves a ring of sub-window buckets covering windowSize forward to now,
+// resetting the buckets of the sub-windows that elapsed since lastUpdateTime.
+func rotateBuckets[B any](buckets []B, currentBucket *int, lastUpdateTime *time.Time, windowSize time.Duration, now time.Time) {
+	subWindowNum := len(buckets)
+	subWindowDuration := windowSize / time.Duration(subWindowNum)
+	timePassed := now.Sub(*lastUpdateTime)
+	elapsedBuckets := int(timePassed / subWindowDuration)
+
+	if elapsedBuckets > 0 {
+		if elapsedBuckets > subWindowNum {
+			// Maximum to clear all sub-windows
+			elapsedBuckets = subWindowNum
+		}
+		// Move to the next sub-window and clear the current sub-window count
+		var zero B
+		for range elapsedBuckets {
+			*currentBucket = (*currentBucket + 1) % subWindowNum
+			buckets[*currentBucket] = zero
+		}
+		*lastUpdateTime = now
+	}
+}
+
 type RateLimiter struct {
 	limiters      map[string]*SlidingWindowRateLimiter
 	limitersMu    sync.RWMutex
@@ -0,0 +1,358 @@
+package doraemon
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SyncAction is an action of a SyncPlan.
+type SyncAction int
+
+const (
+	// SyncAdd copies a file missing in the destination.
+	SyncAdd SyncAction = iota
+	// SyncUpdate copies a file that differs in the destination.
+	SyncUpdate
+	// SyncDelete removes a file or directory of the destination that is not in the source.
+	SyncDelete
+)
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncAdd:
+		return "add"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+func (a SyncAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// SyncEntry is a change made by SyncDir.
+type SyncEntry struct {
+	Action SyncAction `json:"action"`
+	// Path is relative to the source and destination, with slashes.
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// IsDir is set for the deletion of a directory, its content is not listed.
+	IsDir bool `json:"isDir,omitempty"`
+}
+
+// SyncPlan lists the changes of a SyncDir, deletions first, then additions and updates by path.
+type SyncPlan struct {
+	Entries []SyncEntry `json:"entries"`
+	// Skipped lists the symbolic links of the source that are not mirrored: dangling links,
+	// and links to one of their parent directories.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Count returns the number of entries with action.
+func (p *SyncPlan) Count(action SyncAction) int {
+	n := 0
+	for _, e := range p.Entries {
+		if e.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// String formats the plan like a diff, one "+" (add), "~" (update) or "-" (delete) line per entry.
+func (p *SyncPlan) String() string {
+	var b strings.Builder
+	for _, e := range p.Entries {
+		sign := map[SyncAction]string{SyncAdd: "+", SyncUpdate: "~", SyncDelete: "-"}[e.Action]
+		name := e.Path
+		if e.IsDir {
+			name += "/"
+		}
+		fmt.Fprintf(&b, "%s %s (%s)\n", sign, name, e.Reason)
+	}
+	return b.String()
+}
+
+// SyncOptions configures SyncDir.
+type SyncOptions struct {
+	// DryRun only computes the plan, nothing is changed.
+	DryRun bool
+	// Compare selects how changed files are detected, CompareNone updates all files.
+	Compare CopyCompare
+	// KeepExtraneous keeps the files of the destination that are not in the source.
+	KeepExtraneous bool
+	// Exclude lists globs of paths that are neither copied nor deleted, see MatchGlob.
+	Exclude []string
+}
+
+// SyncDir makes the directory dst a mirror of the directory src, like rsync --delete: new and
+// changed files are copied, with their modes and modification times, and the files and directories
+// that are not in src are removed. Symbolic links in src are followed: a link to a file is
+// copied as a file, a link to a directory as a directory with its content. Dangling links and
+// links to a parent directory (loops) are skipped and listed in SyncPlan.Skipped.
+//
+// It returns the plan of the changes, which are only computed with DryRun.
+func SyncDir(src, dst string, opts SyncOptions) (*SyncPlan, error) {
+	if is, _, err := IsDir(src); err != nil || !is {
+		return nil, fmt.Errorf("%s is not a folder", src)
+	}
+	if IsSubPath(src, dst) || IsSubPath(dst, src) {
+		return nil, fmt.Errorf("\"%s\" and \"%s\" overlap", src, dst)
+	}
+
+	srcFiles, skipped, err := listSyncSource(src, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	dstFiles := map[string]fs.FileInfo{}
+	if FileOrDirIsExist(dst) {
+		if dstFiles, err = listSyncTree(dst, opts.Exclude); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &SyncPlan{Skipped: skipped}
+	var deletes, copies []SyncEntry
+	for rel, dstInfo := range dstFiles {
+		srcInfo, inSrc := srcFiles[rel]
+		switch {
+		case !inSrc:
+			if !opts.KeepExtraneous {
+				deletes = append(deletes, SyncEntry{Action: SyncDelete, Path: rel, Reason: "not in source", IsDir: dstInfo.IsDir()})
+			}
+		case srcInfo.IsDir() && !dstInfo.IsDir():
+			deletes = append(deletes, SyncEntry{Action: SyncDelete, Path: rel, Reason: "directory in source"})
+		case !srcInfo.IsDir() && dstInfo.IsDir():
+			deletes = append(deletes, SyncEntry{Action: SyncDelete, Path: rel, Reason: "file in source", IsDir: true})
+		}
+	}
+	// only the topmost deleted directory is listed
+	slices.SortFunc(deletes, func(a, b SyncEntry) int { return strings.Compare(a.Path, b.Path) })
+	for _, e := range deletes {
+		if n := len(plan.Entries); n > 0 && plan.Entries[n-1].IsDir && strings.HasPrefix(e.Path, plan.Entries[n-1].Path+"/") {
+			continue
+		}
+		plan.Entries = append(plan.Entries, e)
+	}
+
+	for rel, srcInfo := range srcFiles {
+		if srcInfo.IsDir() {
+			continue
+		}
+		dstInfo, inDst := dstFiles[rel]
+		if !inDst || dstInfo.IsDir() {
+			copies = append(copies, SyncEntry{Action: SyncAdd, Path: rel, Reason: "missing in destination"})
+			continue
+		}
+		reason, err := syncChangeReason(filepath.Join(src, rel), filepath.Join(dst, rel), srcInfo, dstInfo, opts.Compare)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			copies = append(copies, SyncEntry{Action: SyncUpdate, Path: rel, Reason: reason})
+		}
+	}
+	slices.SortFunc(copies, func(a, b SyncEntry) int { return strings.Compare(a.Path, b.Path) })
+	plan.Entries = append(plan.Entries, copies...)
+
+	if opts.DryRun {
+		return plan, nil
+	}
+	return plan, applySyncPlan(src, dst, plan, srcFiles)
+}
+
+// listSyncSource lists the files and directories under root by relative slash path, root
+// excluded, following the symbolic links. It also returns the skipped links, see SyncPlan.Skipped.
+func listSyncSource(root string, exclude []string) (map[string]fs.FileInfo, []string, error) {
+	rootInfo, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree := make(map[string]fs.FileInfo)
+	var skipped []string
+	// ancestors are the directories being listed, a link to one of them is a loop
+	var walk func(dir, rel string, ancestors []fs.FileInfo) error
+	walk = func(dir, rel string, ancestors []fs.FileInfo) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			childRel := path.Join(rel, e.Name())
+			if syncExcluded(exclude, childRel) {
+				continue
+			}
+			p := filepath.Join(dir, e.Name())
+			info, err := os.Stat(p)
+			if err != nil {
+				if e.Type()&fs.ModeSymlink != 0 && errors.Is(err, fs.ErrNotExist) {
+					skipped = append(skipped, childRel)
+					continue
+				}
+				return err
+			}
+			if !info.IsDir() {
+				tree[childRel] = info
+				continue
+			}
+			if slices.ContainsFunc(ancestors, func(a fs.FileInfo) bool { return os.SameFile(a, info) }) {
+				skipped = append(skipped, childRel)
+				continue
+			}
+			tree[childRel] = info
+			if err := walk(p, childRel, append(slices.Clip(ancestors), info)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root, "", []fs.FileInfo{rootInfo}); err != nil {
+		return nil, nil, err
+	}
+	slices.Sort(skipped)
+	return tree, skipped, nil
+}
+
+// listSyncTree lists the files and directories under root by relative slash path, root excluded,
+// without following the symbolic links.
+func listSyncTree(root string, exclude []string) (map[string]fs.FileInfo, error) {
+	paths, err := ListAllRecursively(root)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]fs.FileInfo, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if syncExcluded(exclude, rel) {
+			continue
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		tree[rel] = info
+	}
+	return tree, nil
+}
+
+// syncExcluded reports whether rel or one of its parent directories matches an exclude glob.
+func syncExcluded(exclude []string, rel string) bool {
+	for p := rel; p != "."; p = path.Dir(p) {
+		if MatchAnyGlob(exclude, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// syncChangeReason returns why the destination file differs from the source file, or "" if it does not.
+func syncChangeReason(srcPath, dstPath string, srcInfo, dstInfo fs.FileInfo, compare CopyCompare) (string, error) {
+	if !dstInfo.Mode().IsRegular() {
+		return "not a regular file in destination", nil
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return fmt.Sprintf("size differs (%d != %d)", srcInfo.Size(), dstInfo.Size()), nil
+	}
+	switch compare {
+	case CompareNone:
+		return "forced", nil
+	case CompareHash:
+		srcHash := computeFileSHA256(srcPath)
+		if srcHash.IsErr() {
+			return "", srcHash.Err
+		}
+		dstHash := computeFileSHA256(dstPath)
+		if dstHash.IsErr() {
+			return "", dstHash.Err
+		}
+		if string(srcHash.Value) != string(dstHash.Value) {
+			return "content differs", nil
+		}
+	default:
+		if !srcInfo.ModTime().Equal(dstInfo.ModTime()) {
+			return fmt.Sprintf("modification time differs (%s != %s)",
+				srcInfo.ModTime().Format("2006-01-02 15:04:05.000"), dstInfo.ModTime().Format("2006-01-02 15:04:05.000")), nil
+		}
+	}
+	if srcInfo.Mode().Perm() != dstInfo.Mode().Perm() {
+		return fmt.Sprintf("mode differs (%v != %v)", srcInfo.Mode().Perm(), dstInfo.Mode().Perm()), nil
+	}
+	return "", nil
+}
+
+func applySyncPlan(src, dst string, plan *SyncPlan, srcFiles map[string]fs.FileInfo) error {
+	for _, e := range plan.Entries {
+		if e.Action == SyncDelete {
+			if err := os.RemoveAll(filepath.Join(dst, e.Path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	dirs := []string{"."}
+	for rel, info := range srcFiles {
+		if info.IsDir() {
+			dirs = append(dirs, rel)
+		}
+	}
+	slices.Sort(dirs)
+	for _, rel := range dirs {
+		// the directories stay writable until their content is copied
+		if err := os.MkdirAll(filepath.Join(dst, rel), 0755); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range plan.Entries {
+		if e.Action == SyncDelete {
+			continue
+		}
+		target := filepath.Join(dst, e.Path)
+		if e.Action == SyncUpdate {
+			// CopyFile cannot overwrite a read-only file
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+		if err := CopyFile(filepath.Join(src, e.Path), filepath.Dir(target), true); err != nil {
+			return err
+		}
+	}
+
+	// children first, so that setting their times does not change the times of the parents
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info := srcInfo
+		if dirs[i] != "." {
+			info = srcFiles[dirs[i]]
+		}
+		target := filepath.Join(dst, dirs[i])
+		if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
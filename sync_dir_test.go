@@ -0,0 +1,139 @@
+package doraemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestTree(t, src, map[string]string{
+		"same.txt":     "same",
+		"changed.txt":  "new content",
+		"new/file.txt": "new",
+		"keep/a.txt":   "a",
+		"typed":        "now a file",
+	})
+	writeTestTree(t, dst, map[string]string{
+		"changed.txt":       "old",
+		"extra.txt":         "extra",
+		"old/deep/file.txt": "old",
+		"typed/inner.txt":   "was a dir",
+		"cache/x.tmp":       "excluded",
+	})
+	// same.txt is identical, with the same mtime
+	if err := CopyFile(filepath.Join(src, "same.txt"), dst, true); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := SyncOptions{DryRun: true, Exclude: []string{"cache"}}
+	plan, err := SyncDir(src, dst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"- extra.txt (not in source)",
+		"- old/ (not in source)",
+		"- typed/ (file in source)",
+		"~ changed.txt (size differs (11 != 3))",
+		"+ keep/a.txt (missing in destination)",
+		"+ new/file.txt (missing in destination)",
+		"+ typed (missing in destination)",
+	}, "\n") + "\n"
+	if plan.String() != want {
+		t.Fatalf("unexpected plan:\n%s\nwant:\n%s", plan, want)
+	}
+	if FileOrDirIsExist(filepath.Join(dst, "new")) || !FileOrDirIsExist(filepath.Join(dst, "extra.txt")) {
+		t.Fatal("dry run changed the destination")
+	}
+
+	opts.DryRun = false
+	if _, err := SyncDir(src, dst, opts); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"changed.txt": "new content", "typed": "now a file", "new/file.txt": "new", "cache/x.tmp": "excluded"} {
+		if data, _ := os.ReadFile(filepath.Join(dst, name)); string(data) != content {
+			t.Fatalf("%s: unexpected content %q", name, data)
+		}
+	}
+	if FileOrDirIsExist(filepath.Join(dst, "extra.txt")) || FileOrDirIsExist(filepath.Join(dst, "old")) {
+		t.Fatal("extraneous files not deleted")
+	}
+
+	plan, err = SyncDir(src, dst, SyncOptions{DryRun: true, Exclude: []string{"cache"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 0 {
+		t.Fatalf("expected an empty plan after sync, got:\n%s", plan)
+	}
+}
+
+func TestSyncDir_CompareHash(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeTestTree(t, src, map[string]string{"a.txt": "aaaa", "b.txt": "bbbb"})
+	writeTestTree(t, dst, map[string]string{"a.txt": "aaaa", "b.txt": "xxxx"})
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(filepath.Join(dst, "a.txt"), old, old)
+	_ = os.Chtimes(filepath.Join(dst, "b.txt"), old, old)
+
+	plan, err := SyncDir(src, dst, SyncOptions{DryRun: true, Compare: CompareHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Entries) != 1 || plan.Entries[0].Path != "b.txt" || plan.Entries[0].Reason != "content differs" {
+		t.Fatalf("unexpected plan:\n%s", plan)
+	}
+	plan, _ = SyncDir(src, dst, SyncOptions{DryRun: true})
+	if plan.Count(SyncUpdate) != 2 {
+		t.Fatalf("expected 2 updates by modification time, got:\n%s", plan)
+	}
+}
+
+func TestSyncDir_Symlinks(t *testing.T) {
+	src, dst, outside := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTestTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	writeTestTree(t, outside, map[string]string{"linked.txt": "linked", "deep/c.txt": "c"})
+	for link, target := range map[string]string{
+		"dirlink":      outside,
+		"filelink":     filepath.Join(src, "a.txt"),
+		"dangling":     filepath.Join(src, "missing"),
+		"sub/loop":     src,
+		"sub/dangling": "../nowhere",
+	} {
+		if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+			t.Skip("symbolic links not supported:", err)
+		}
+	}
+
+	plan, err := SyncDir(src, dst, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(plan.Skipped, ","); got != "dangling,sub/dangling,sub/loop" {
+		t.Fatalf("unexpected skipped links %q", got)
+	}
+	// the links are followed, the targets are copied
+	for name, content := range map[string]string{"dirlink/linked.txt": "linked", "dirlink/deep/c.txt": "c", "filelink": "a", "sub/b.txt": "b"} {
+		info, err := os.Lstat(filepath.Join(dst, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Fatalf("%s: not copied as a regular file: %v", name, err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dst, name)); string(data) != content {
+			t.Fatalf("%s: unexpected content %q", name, data)
+		}
+	}
+	for _, name := range []string{"dangling", "sub/loop", "sub/dangling"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Fatalf("skipped link %s mirrored", name)
+		}
+	}
+
+	plan, err = SyncDir(src, dst, SyncOptions{DryRun: true})
+	if err != nil || len(plan.Entries) != 0 {
+		t.Fatalf("expected an empty plan after sync, got %v:\n%s", err, plan)
+	}
+}
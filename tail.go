@@ -0,0 +1,307 @@
+package doraemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"time"
+)
+
+// reverseBlockSize is the size of the blocks read by ReverseLines.
+const reverseBlockSize = 64 << 10
+
+// ReverseLines returns an iterator over the lines of the first size bytes of r, from the last
+// line to the first one. The content is read backwards by blocks, so only the lines consumed
+// are read. Lines are split on '\n' and a '\r' before it is removed (CRLF); like strings.Split,
+// a content ending with a newline has an empty last line, which comes first.
+//
+// Iteration stops after yielding a read error.
+func ReverseLines(r io.ReaderAt, size int64) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		buf := make([]byte, reverseBlockSize)
+		// pieces of the current line, from the end, they are joined when the line is complete
+		var pieces [][]byte
+		terminated := false
+		emit := func(head []byte) bool {
+			line := head
+			if len(pieces) > 0 {
+				line = append([]byte(nil), head...)
+				for i := len(pieces) - 1; i >= 0; i-- {
+					line = append(line, pieces[i]...)
+				}
+				pieces = pieces[:0]
+			}
+			if terminated {
+				line = bytes.TrimSuffix(line, []byte{'\r'})
+			}
+			terminated = true
+			return yield(string(line), nil)
+		}
+
+		for pos := size; pos > 0; {
+			n := int64(len(buf))
+			if pos < n {
+				n = pos
+			}
+			pos -= n
+			chunk := buf[:n]
+			if _, err := r.ReadAt(chunk, pos); err != nil && !(errors.Is(err, io.EOF) && pos+n == size) {
+				yield("", err)
+				return
+			}
+			for {
+				i := bytes.LastIndexByte(chunk, '\n')
+				if i < 0 {
+					pieces = append(pieces, append([]byte(nil), chunk...))
+					break
+				}
+				if !emit(chunk[i+1:]) {
+					return
+				}
+				chunk = chunk[:i]
+			}
+		}
+		emit(nil)
+	}
+}
+
+// ReverseFileLines returns an iterator over the lines of the file name from the last one,
+// see ReverseLines. The file is closed when the iteration ends.
+func ReverseFileLines(name string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		f, err := os.Open(name)
+		if err != nil {
+			yield("", err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			yield("", err)
+			return
+		}
+		for line, err := range ReverseLines(f, info.Size()) {
+			if !yield(line, err) {
+				return
+			}
+		}
+	}
+}
+
+// FollowOptions configures FollowFile.
+type FollowOptions struct {
+	// FromStart follows the file from its beginning instead of its end.
+	FromStart bool
+	// Lines is the number of existing last lines to yield first, like tail -n. Ignored with FromStart.
+	Lines int
+	// PollInterval is how often the file is checked without a change notification, 1s by default.
+	PollInterval time.Duration
+}
+
+// FollowFile returns an iterator over the lines appended to the file name, like tail -F.
+// It waits for the file if it does not exist yet. When the file is rotated (renamed or removed
+// and created again), the rest of the old file is read and the new file is followed from its
+// beginning; when it is truncated, it is followed from its beginning. Lines are split like
+// ReverseLines does, an incomplete last line is only yielded once its newline is written.
+//
+// The iteration ends when ctx is done, or after yielding an error.
+func FollowFile(ctx context.Context, name string, opts FollowOptions) iter.Seq2[string, error] {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultFilePollInterval
+	}
+	return func(yield func(string, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		changes, err := WatchFile(ctx, name, opts.PollInterval)
+		if err != nil {
+			yield("", err)
+			return
+		}
+		t := &follower{name: name, opts: opts, yield: yield, buf: make([]byte, 32<<10)}
+		defer t.close()
+
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+		first := true
+		for {
+			ok, err := t.poll(first)
+			if err != nil {
+				yield("", err)
+				return
+			}
+			if !ok {
+				return
+			}
+			first = false
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+type follower struct {
+	name    string
+	opts    FollowOptions
+	yield   func(string, error) bool
+	f       *os.File
+	info    fs.FileInfo
+	offset  int64
+	pending []byte
+	buf     []byte
+}
+
+func (t *follower) close() {
+	if t.f != nil {
+		t.f.Close()
+	}
+}
+
+// poll reads what was appended to the file, handling rotation and truncation.
+// It reports false when the consumer stopped the iteration.
+func (t *follower) poll(first bool) (bool, error) {
+	if t.f == nil {
+		opened, err := t.open(first)
+		if !opened {
+			return true, err
+		}
+	}
+	if ok, err := t.readAppended(); !ok || err != nil {
+		return ok, err
+	}
+
+	info, err := os.Stat(t.name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return true, err
+	}
+	switch {
+	case err != nil || !os.SameFile(info, t.info):
+		// rotated: the old file is read to its end, it may have been written since the read
+		// above, then the new one is read from its beginning
+		if ok, err := t.readAppended(); !ok || err != nil {
+			return ok, err
+		}
+		t.f.Close()
+		t.f = nil
+		if len(t.pending) > 0 {
+			// the old file will not be completed
+			line := string(bytes.TrimSuffix(t.pending, []byte{'\r'}))
+			t.pending = t.pending[:0]
+			if !t.yield(line, nil) {
+				return false, nil
+			}
+		}
+		if _, err := t.open(false); err != nil {
+			return true, err
+		}
+		if t.f != nil {
+			return t.readAppended()
+		}
+	case info.Size() < t.offset:
+		// truncated
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return true, err
+		}
+		t.offset, t.pending = 0, t.pending[:0]
+		return t.readAppended()
+	}
+	return true, nil
+}
+
+// open opens the file if it exists, positioned according to the options on the first open
+// and at its beginning after a rotation.
+func (t *follower) open(first bool) (bool, error) {
+	f, err := os.Open(t.name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return false, err
+	}
+	var offset int64
+	if first && !t.opts.FromStart {
+		offset = info.Size()
+		if t.opts.Lines > 0 {
+			if offset, err = lastLinesOffset(f, info.Size(), t.opts.Lines); err != nil {
+				f.Close()
+				return false, err
+			}
+		}
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return false, err
+	}
+	t.f, t.info, t.offset = f, info, offset
+	return true, nil
+}
+
+// readAppended yields the complete lines appended since the last read.
+func (t *follower) readAppended() (bool, error) {
+	for {
+		n, err := t.f.Read(t.buf)
+		t.offset += int64(n)
+		data := t.buf[:n]
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				t.pending = append(t.pending, data...)
+				break
+			}
+			line := data[:i]
+			if len(t.pending) > 0 {
+				line = append(t.pending, line...)
+				t.pending = t.pending[:0]
+			}
+			if !t.yield(string(bytes.TrimSuffix(line, []byte{'\r'})), nil) {
+				return false, nil
+			}
+			data = data[i+1:]
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// lastLinesOffset returns the offset of the start of the last n complete lines of r.
+func lastLinesOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	buf := make([]byte, reverseBlockSize)
+	// a final newline ends the last line, it does not start a new one
+	skip := size
+	for pos := size; pos > 0; {
+		m := int64(len(buf))
+		if pos < m {
+			m = pos
+		}
+		pos -= m
+		chunk := buf[:m]
+		if _, err := r.ReadAt(chunk, pos); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' || pos+int64(i) == skip-1 {
+				continue
+			}
+			if n--; n == 0 {
+				return pos + int64(i) + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
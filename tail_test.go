@@ -0,0 +1,145 @@
+package doraemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReverseLines(t *testing.T) {
+	long := strings.Repeat("x", reverseBlockSize+10)
+	tests := []string{
+		"",
+		"a",
+		"a\nb\n",
+		"a\r\nb\r\nc",
+		"\n\n",
+		"first\n" + long + "\nlast\r\n",
+	}
+	for _, content := range tests {
+		want := strings.Split(content, "\n")
+		for i := range want[:len(want)-1] {
+			want[i] = strings.TrimSuffix(want[i], "\r")
+		}
+		slices.Reverse(want)
+		var got []string
+		for line, err := range ReverseLines(strings.NewReader(content), int64(len(content))) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, line)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("content %.20q: got %d lines, want %d", content, len(got), len(want))
+		}
+	}
+}
+
+func TestReverseRead(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "log.txt")
+	var b strings.Builder
+	for i := 1; i <= 20000; i++ {
+		fmt.Fprintf(&b, "line %d\r\n", i)
+	}
+	if err := os.WriteFile(name, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := ReverseRead(name, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []string{"", "line 20000", "line 19999"}) {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if all, _ := ReverseRead(name, 0); len(all) != 20001 {
+		t.Fatalf("expected all lines, got %d", len(all))
+	}
+	if line, err := ReadStartWithLastLine(name, 20001); err != nil || line != "line 1" {
+		t.Fatalf("got %q, %v", line, err)
+	}
+	if _, err := ReadStartWithLastLine(name, 20002); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func appendTo(t *testing.T, name, s string) {
+	t.Helper()
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestFollowFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+	appendTo(t, name, "old 1\nold 2\nold 3\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		for line, err := range FollowFile(ctx, name, FollowOptions{Lines: 2, PollInterval: 10 * time.Millisecond}) {
+			if err != nil {
+				done <- err
+				return
+			}
+			lines <- line
+		}
+		done <- nil
+	}()
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case got := <-lines:
+				if got != w {
+					t.Fatalf("got %q, want %q", got, w)
+				}
+			case <-ctx.Done():
+				t.Fatalf("timeout waiting for %q", w)
+			}
+		}
+	}
+
+	expect("old 2", "old 3")
+	appendTo(t, name, "new 1\r\npart")
+	expect("new 1")
+	appendTo(t, name, "ial\n")
+	expect("partial")
+
+	// truncation
+	if err := os.WriteFile(name, []byte("after truncate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("after truncate")
+
+	// rotation
+	appendTo(t, name, "before rotate\n")
+	expect("before rotate")
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, name, "rotated 1\n")
+	expect("rotated 1")
+
+	cancel()
+	select {
+	case <-lines:
+	default:
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
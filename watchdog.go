@@ -0,0 +1,335 @@
+package doraemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Escalation is an action taken by a MultiWatchdog on an overdue probe.
+type Escalation int
+
+const (
+	// EscalateWarn calls the OnWarn callback of the probe.
+	EscalateWarn Escalation = iota
+	// EscalateCancel cancels the context of the probe.
+	EscalateCancel
+	// EscalateRestart calls the Restart function of the probe.
+	EscalateRestart
+	// EscalateExit exits the process.
+	EscalateExit
+)
+
+func (e Escalation) String() string {
+	switch e {
+	case EscalateWarn:
+		return "warn"
+	case EscalateCancel:
+		return "cancel"
+	case EscalateRestart:
+		return "restart"
+	case EscalateExit:
+		return "exit"
+	default:
+		return "unknown"
+	}
+}
+
+func (e Escalation) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// ProbeOptions configures a probe registered in a MultiWatchdog.
+type ProbeOptions struct {
+	// Timeout is the maximum time between two pets, it is required.
+	Timeout time.Duration
+	// Escalation lists the actions taken while the probe is overdue, the first one when
+	// the timeout elapses and each next one after another Timeout without a pet.
+	// A pet resets the escalation. The default is EscalateWarn only.
+	Escalation []Escalation
+	// OnWarn is called by EscalateWarn, by default a message is printed to stderr.
+	OnWarn func(status ProbeStatus)
+	// Cancel is called by EscalateCancel, e.g. the cancel function of the context of the supervised loop.
+	Cancel context.CancelFunc
+	// Restart is called by EscalateRestart, it should start the supervised loop again.
+	Restart func() error
+	// ExitCode is the exit code of EscalateExit, 1 if 0.
+	ExitCode int
+}
+
+// ProbeStatus is the status of a probe in a WatchdogStatus.
+type ProbeStatus struct {
+	Name    string        `json:"name"`
+	Healthy bool          `json:"healthy"`
+	Timeout time.Duration `json:"timeout"`
+	LastPet time.Time     `json:"lastPet"`
+	// Overdue is the time elapsed since the timeout, 0 if the probe is healthy.
+	Overdue time.Duration `json:"overdue"`
+	// Escalations are the actions taken since the last pet.
+	Escalations []Escalation `json:"escalations,omitempty"`
+	Restarts    int          `json:"restarts"`
+	LastError   string       `json:"lastError,omitempty"`
+}
+
+// WatchdogStatus is the status report of a MultiWatchdog, it is meant to be
+// served as JSON by health endpoints.
+type WatchdogStatus struct {
+	Healthy bool          `json:"healthy"`
+	Time    time.Time     `json:"time"`
+	Probes  []ProbeStatus `json:"probes"`
+}
+
+// Probe is a named task supervised by a MultiWatchdog.
+type Probe struct {
+	name string
+	opts ProbeOptions
+	w    *MultiWatchdog
+
+	// protected by w.mu
+	lastPet     time.Time
+	deadline    time.Time
+	escalations []Escalation
+	restarts    int
+	lastErr     error
+}
+
+func (p *Probe) Name() string {
+	return p.name
+}
+
+// Pet signals that the task of the probe is alive, it resets the escalation.
+func (p *Probe) Pet() {
+	w := p.w
+	now := w.clock.Now()
+	w.mu.Lock()
+	p.lastPet = now
+	p.deadline = now.Add(p.opts.Timeout)
+	p.escalations = nil
+	w.mu.Unlock()
+}
+
+// MultiWatchdog supervises several named probes, each with its own timeout.
+// When a probe is not pet in time, its escalation actions are taken one by one.
+// It is safe for concurrent use.
+type MultiWatchdog struct {
+	mu     sync.Mutex
+	probes map[string]*Probe
+
+	checkInterval time.Duration
+	clock         Clock
+	exit          func(code int)
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+	stopCh    chan struct{}
+}
+
+// MultiWatchdogOption configures a MultiWatchdog.
+type MultiWatchdogOption func(*MultiWatchdog)
+
+// MultiWatchdogWithCheckInterval sets how often the probes are checked, one second by default.
+func MultiWatchdogWithCheckInterval(interval time.Duration) MultiWatchdogOption {
+	return func(w *MultiWatchdog) {
+		if interval > 0 {
+			w.checkInterval = interval
+		}
+	}
+}
+
+// MultiWatchdogWithClock replaces the SystemClock, for tests.
+func MultiWatchdogWithClock(clock Clock) MultiWatchdogOption {
+	return func(w *MultiWatchdog) {
+		if clock != nil {
+			w.clock = clock
+		}
+	}
+}
+
+// MultiWatchdogWithExit replaces os.Exit for EscalateExit.
+func MultiWatchdogWithExit(exit func(code int)) MultiWatchdogOption {
+	return func(w *MultiWatchdog) {
+		if exit != nil {
+			w.exit = exit
+		}
+	}
+}
+
+func NewMultiWatchdog(opts ...MultiWatchdogOption) *MultiWatchdog {
+	w := &MultiWatchdog{
+		probes:        make(map[string]*Probe),
+		checkInterval: time.Second,
+		clock:         SystemClock,
+		exit:          os.Exit,
+		stopCh:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Register adds a probe, its timeout starts now.
+func (w *MultiWatchdog) Register(name string, opts ProbeOptions) (*Probe, error) {
+	if opts.Timeout <= 0 {
+		return nil, fmt.Errorf("probe %s: timeout must be greater than 0", name)
+	}
+	if len(opts.Escalation) == 0 {
+		opts.Escalation = []Escalation{EscalateWarn}
+	}
+	for _, e := range opts.Escalation {
+		if (e == EscalateCancel && opts.Cancel == nil) || (e == EscalateRestart && opts.Restart == nil) {
+			return nil, fmt.Errorf("probe %s: escalation %s requires its function", name, e)
+		}
+	}
+	if opts.OnWarn == nil {
+		opts.OnWarn = func(status ProbeStatus) {
+			fmt.Fprintf(os.Stderr, "Watchdog: probe %s is overdue by %s.\n", status.Name, status.Overdue)
+		}
+	}
+	now := w.clock.Now()
+	p := &Probe{name: name, opts: opts, w: w, lastPet: now, deadline: now.Add(opts.Timeout)}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, exists := w.probes[name]; exists {
+		return nil, fmt.Errorf("probe %s is already registered", name)
+	}
+	w.probes[name] = p
+	return p, nil
+}
+
+func (w *MultiWatchdog) Unregister(name string) {
+	w.mu.Lock()
+	delete(w.probes, name)
+	w.mu.Unlock()
+}
+
+// Pet pets the probe name, it reports false if there is no such probe.
+func (w *MultiWatchdog) Pet(name string) bool {
+	w.mu.Lock()
+	p, ok := w.probes[name]
+	w.mu.Unlock()
+	if ok {
+		p.Pet()
+	}
+	return ok
+}
+
+// Start begins checking the probes. It is safe to call Start multiple times.
+func (w *MultiWatchdog) Start() {
+	w.startOnce.Do(func() {
+		w.wg.Add(1)
+		go w.monitor()
+	})
+}
+
+// Stop terminates the checks, blocking until they have stopped.
+func (w *MultiWatchdog) Stop() {
+	w.stopOnce.Do(func() { close(w.stopCh) })
+	w.wg.Wait()
+}
+
+func (w *MultiWatchdog) monitor() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+type pendingEscalation struct {
+	probe  *Probe
+	action Escalation
+	status ProbeStatus
+}
+
+// check takes the next escalation action of each overdue probe.
+func (w *MultiWatchdog) check() {
+	now := w.clock.Now()
+	var pending []pendingEscalation
+	w.mu.Lock()
+	for _, p := range w.probes {
+		if now.Before(p.deadline) || len(p.escalations) >= len(p.opts.Escalation) {
+			continue
+		}
+		action := p.opts.Escalation[len(p.escalations)]
+		p.escalations = append(p.escalations, action)
+		p.deadline = now.Add(p.opts.Timeout)
+		pending = append(pending, pendingEscalation{probe: p, action: action, status: p.statusLocked(now)})
+	}
+	w.mu.Unlock()
+
+	// the actions may block or pet, they run without the lock
+	for _, e := range pending {
+		p := e.probe
+		switch e.action {
+		case EscalateWarn:
+			p.opts.OnWarn(e.status)
+		case EscalateCancel:
+			p.opts.Cancel()
+		case EscalateRestart:
+			err := p.opts.Restart()
+			w.mu.Lock()
+			p.restarts++
+			p.lastErr = err
+			w.mu.Unlock()
+		case EscalateExit:
+			code := p.opts.ExitCode
+			if code == 0 {
+				code = 1
+			}
+			w.exit(code)
+		}
+	}
+}
+
+func (p *Probe) statusLocked(now time.Time) ProbeStatus {
+	s := ProbeStatus{
+		Name:        p.name,
+		Timeout:     p.opts.Timeout,
+		LastPet:     p.lastPet,
+		Escalations: slices.Clone(p.escalations),
+		Restarts:    p.restarts,
+	}
+	if overdue := now.Sub(p.lastPet) - p.opts.Timeout; overdue > 0 {
+		s.Overdue = overdue
+	}
+	s.Healthy = s.Overdue == 0 && len(p.escalations) == 0
+	if p.lastErr != nil {
+		s.LastError = p.lastErr.Error()
+	}
+	return s
+}
+
+// Status returns the status of all probes sorted by name, the watchdog is
+// healthy if all its probes are.
+func (w *MultiWatchdog) Status() WatchdogStatus {
+	now := w.clock.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := WatchdogStatus{Healthy: true, Time: now, Probes: make([]ProbeStatus, 0, len(w.probes))}
+	for _, p := range w.probes {
+		s := p.statusLocked(now)
+		status.Healthy = status.Healthy && s.Healthy
+		status.Probes = append(status.Probes, s)
+	}
+	slices.SortFunc(status.Probes, func(a, b ProbeStatus) int { return strings.Compare(a.Name, b.Name) })
+	return status
+}
+
+// StatusJSON returns the status report as JSON, e.g. for a health endpoint.
+func (w *MultiWatchdog) StatusJSON() ([]byte, error) {
+	return json.Marshal(w.Status())
+}
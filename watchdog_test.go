@@ -0,0 +1,120 @@
+package doraemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMultiWatchdog_Escalation(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	exitCode := 0
+	w := NewMultiWatchdog(MultiWatchdogWithClock(clock), MultiWatchdogWithExit(func(code int) { exitCode = code }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var warned []ProbeStatus
+	restarts := 0
+	worker, err := w.Register("worker", ProbeOptions{
+		Timeout:    10 * time.Second,
+		Escalation: []Escalation{EscalateWarn, EscalateCancel, EscalateRestart, EscalateExit},
+		OnWarn:     func(s ProbeStatus) { warned = append(warned, s) },
+		Cancel:     cancel,
+		Restart:    func() error { restarts++; return errors.New("restart failed") },
+		ExitCode:   3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Register("poller", ProbeOptions{Timeout: time.Minute, OnWarn: func(ProbeStatus) {}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Register("worker", ProbeOptions{Timeout: time.Second}); err == nil {
+		t.Fatal("expected an error for a duplicate probe")
+	}
+	if _, err := w.Register("bad", ProbeOptions{Timeout: time.Second, Escalation: []Escalation{EscalateCancel}}); err == nil {
+		t.Fatal("expected an error for a cancel escalation without Cancel")
+	}
+
+	advance := func(d time.Duration) {
+		clock.now = clock.now.Add(d)
+		w.check()
+	}
+	advance(5 * time.Second)
+	worker.Pet()
+	advance(9 * time.Second)
+	if len(warned) != 0 || !w.Status().Healthy {
+		t.Fatal("escalated a probe that was pet in time")
+	}
+
+	advance(time.Second)
+	if len(warned) != 1 || warned[0].Name != "worker" || ctx.Err() != nil {
+		t.Fatalf("expected a warning only, got %v", warned)
+	}
+	advance(10 * time.Second)
+	if ctx.Err() == nil || restarts != 0 {
+		t.Fatal("expected the context to be canceled")
+	}
+	advance(10 * time.Second)
+	if restarts != 1 || exitCode != 0 {
+		t.Fatal("expected a restart")
+	}
+	advance(10 * time.Second)
+	if exitCode != 3 {
+		t.Fatalf("expected exit code 3, got %d", exitCode)
+	}
+
+	status := w.Status()
+	if status.Healthy || len(status.Probes) != 2 || status.Probes[1].Name != "worker" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	s := status.Probes[1]
+	if s.Healthy || s.Restarts != 1 || s.LastError != "restart failed" || len(s.Escalations) != 4 || s.Overdue != 30*time.Second {
+		t.Fatalf("unexpected probe status %+v", s)
+	}
+
+	data, err := w.StatusJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Healthy bool
+		Probes  []struct {
+			Name        string
+			Escalations []string
+		}
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Healthy || decoded.Probes[1].Escalations[3] != "exit" {
+		t.Fatalf("unexpected JSON status %s", data)
+	}
+
+	worker.Pet()
+	if !w.Status().Healthy {
+		t.Fatal("a pet did not reset the escalation")
+	}
+}
+
+func TestMultiWatchdog_Start(t *testing.T) {
+	w := NewMultiWatchdog(MultiWatchdogWithCheckInterval(5 * time.Millisecond))
+	warned := make(chan ProbeStatus, 1)
+	if _, err := w.Register("loop", ProbeOptions{
+		Timeout: 20 * time.Millisecond,
+		OnWarn:  func(s ProbeStatus) { warned <- s },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	w.Start()
+	defer w.Stop()
+	select {
+	case s := <-warned:
+		if s.Name != "loop" {
+			t.Fatalf("unexpected probe %s", s.Name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the overdue probe was not reported")
+	}
+}